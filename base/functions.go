@@ -49,6 +49,59 @@ func RandVec32(n uint32, norm float32) []float32 {
 	return vec
 }
 
+// HashVec32 is RandVec32 with values derived from key and seed instead of the global random source,
+// so a key gets the same vector whatever order it is created in
+func HashVec32(key, seed uint64, n uint32, norm float32) []float32 {
+	next := HashSource(key, seed)
+	vec := make([]float32, n, n)
+	for i := uint32(0); i < n; i++ {
+		vec[i] = float32(next()-0.5) / norm
+	}
+	return vec
+}
+
+// HashSource returns a stream of uniform floats in [0, 1) derived from key and seed
+func HashSource(key, seed uint64) func() float64 {
+	state := key ^ (seed * 0x9e3779b97f4a7c15)
+	return func() float64 {
+		var x uint64
+		state, x = splitMix64(state)
+		// top 53 bits to a float in [0, 1)
+		return float64(x>>11) / (1 << 53)
+	}
+}
+
+func splitMix64(state uint64) (uint64, uint64) {
+	state += 0x9e3779b97f4a7c15
+	z := state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return state, z ^ (z >> 31)
+}
+
+// UniformVec32 draws n values in (-scale, scale) from next, a source of uniform floats in [0, 1)
+func UniformVec32(n uint32, scale float32, next func() float64) []float32 {
+	vec := make([]float32, n, n)
+	for i := uint32(0); i < n; i++ {
+		vec[i] = float32(2.0*next()-1.0) * scale
+	}
+	return vec
+}
+
+// TruncNormalVec32 draws n normal values with the stddev, values beyond 2 stddev are drawn again
+func TruncNormalVec32(n uint32, stddev float32, next func() float64) []float32 {
+	vec := make([]float32, n, n)
+	for i := uint32(0); i < n; i++ {
+		z := 3.0
+		for math.Abs(z) > 2.0 {
+			// box muller, 1 - next() is in (0, 1]
+			z = math.Sqrt(-2.0*math.Log(1.0-next())) * math.Cos(2.0*math.Pi*next())
+		}
+		vec[i] = float32(z) * stddev
+	}
+	return vec
+}
+
 func Sigmoid(x float64) float64 {
 	return 1.0 / (1.0 + math.Exp(-x))
 }
@@ -1,6 +1,9 @@
 package base
 
 import (
+	"encoding/binary"
+	"strings"
+
 	"github.com/dgryski/go-farm"
 )
 
@@ -10,6 +13,17 @@ type Feature struct {
 	Fea  uint64
 	Slot uint16
 	Text string
+	// Value multiplies the feature in the linear and fm terms, 0 stands for the implicit 1 of
+	// categorical features. A feature whose value is really 0 adds nothing and is not kept.
+	Value float32
+}
+
+// Val is the value of f, 1 unless it is numeric
+func (f *Feature) Val() float32 {
+	if f.Value == 0 {
+		return 1
+	}
+	return f.Value
 }
 
 func (f *Feature) Encode() {
@@ -20,12 +34,39 @@ func (f *Feature) Encode() {
 	f.Fea = uint64(f.Slot)*KMAXSIGN + fea
 }
 
+// Cross sets f to the cross of feas in the slot of f, keyed like Encode by a hash of their keys
+func (f *Feature) Cross(feas []*Feature) {
+	buf := make([]byte, 0, 8*len(feas))
+	texts := make([]string, len(feas))
+	value := float32(1)
+	for i, x := range feas {
+		buf = binary.LittleEndian.AppendUint64(buf, x.Fea)
+		texts[i] = x.Text
+		value *= x.Val()
+	}
+	fea := farm.Hash64WithSeed(buf, uint64(f.Slot))
+	if fea >= KMAXSIGN {
+		fea = fea >> 11
+	}
+	f.Fea = uint64(f.Slot)*KMAXSIGN + fea
+	f.Text = strings.Join(texts, "|")
+	if value != 1 {
+		f.Value = value
+	}
+}
+
+// Bucket folds the key of f into one of buckets keys of its slot, the hashing trick
+func (f *Feature) Bucket(buckets uint64) {
+	f.Fea = uint64(f.Slot)*KMAXSIGN + f.Fea%KMAXSIGN%buckets
+}
+
 func (f *Feature) ExtractSlot() uint16 {
 	return uint16(f.Fea / KMAXSIGN)
 }
 
 type Instance struct {
-	Label     int
+	Label     float32
+	Labels    []float32 // one label per task in multi-task mode, Labels[0] == Label
 	Len       int
 	UserId    uint64
 	ItemId    uint64
@@ -35,9 +76,13 @@ type Instance struct {
 }
 
 type Result struct {
-	Label  int
+	Label  float32
 	Score  float32
 	UserId uint64
+
+	// multi-task labels and scores, indexed by task
+	Labels []float32
+	Scores []float32
 }
 
 type Parameter struct {
@@ -56,6 +101,10 @@ type Parameter struct {
 	VecW []float32
 	VecN []float32
 	VecZ []float32
+
+	// optimizer state other than ftrl z/n, the layout is owned by the optimizer
+	State    []float32
+	VecState []float32
 }
 
 type Weight struct {
@@ -63,6 +112,16 @@ type Weight struct {
 	VecW []float32
 }
 
+// NewParameterWithVec starts the embedding from vec, which is owned by the parameter
+func NewParameterWithVec(vec []float32) *Parameter {
+	size := len(vec)
+	return &Parameter{W: 0.0, Z: 0.0, N: 0.0,
+		VecW: vec,
+		VecZ: make([]float32, size),
+		VecN: make([]float32, size),
+	}
+}
+
 func NewParameter(size uint32, norm float32) *Parameter {
 	return &Parameter{W: 0.0, Z: 0.0, N: 0.0,
 		VecW: RandVec32(size, norm),
@@ -1,6 +1,11 @@
 wget https://s3-eu-west-1.amazonaws.com/reco-dataset/CriteoBannerFillingChallenge.tar.gz
 tar -xvf train.tar.gz
 mkdir -p data
-python3 process_data.py dac/train.txt data
+# shuffled 90% train, 10% valid, read raw with input_config { format: "criteo" }
+shuf dac/train.txt > data/all_sample
+n=$(wc -l < data/all_sample)
+head -n $((n * 9 / 10)) data/all_sample > data/train_sample
+tail -n +$((n * 9 / 10 + 1)) data/all_sample > data/valid_sample
+rm data/all_sample
 
 ../trainer -v=3 -logtostderr -conf criteo.conf -parallel 10 -model ffm
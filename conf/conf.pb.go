@@ -74,15 +74,33 @@ type OptimConfig struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	L1       float32 `protobuf:"fixed32,1,opt,name=l1,proto3" json:"l1,omitempty"`
-	L2       float32 `protobuf:"fixed32,2,opt,name=l2,proto3" json:"l2,omitempty"`
-	Alpha    float32 `protobuf:"fixed32,3,opt,name=alpha,proto3" json:"alpha,omitempty"`
-	Beta     float32 `protobuf:"fixed32,4,opt,name=beta,proto3" json:"beta,omitempty"`
-	EmbAlpha float32 `protobuf:"fixed32,5,opt,name=emb_alpha,json=embAlpha,proto3" json:"emb_alpha,omitempty"`
-	EmbBeta  float32 `protobuf:"fixed32,6,opt,name=emb_beta,json=embBeta,proto3" json:"emb_beta,omitempty"`
-	EmbL1    float32 `protobuf:"fixed32,7,opt,name=emb_l1,json=embL1,proto3" json:"emb_l1,omitempty"`
-	EmbL2    float32 `protobuf:"fixed32,8,opt,name=emb_l2,json=embL2,proto3" json:"emb_l2,omitempty"`
-	EmbSize  uint32  `protobuf:"varint,9,opt,name=emb_size,json=embSize,proto3" json:"emb_size,omitempty"`
+	L1           float32 `protobuf:"fixed32,1,opt,name=l1,proto3" json:"l1,omitempty"`
+	L2           float32 `protobuf:"fixed32,2,opt,name=l2,proto3" json:"l2,omitempty"`
+	Alpha        float32 `protobuf:"fixed32,3,opt,name=alpha,proto3" json:"alpha,omitempty"`
+	Beta         float32 `protobuf:"fixed32,4,opt,name=beta,proto3" json:"beta,omitempty"`
+	EmbAlpha     float32 `protobuf:"fixed32,5,opt,name=emb_alpha,json=embAlpha,proto3" json:"emb_alpha,omitempty"`
+	EmbBeta      float32 `protobuf:"fixed32,6,opt,name=emb_beta,json=embBeta,proto3" json:"emb_beta,omitempty"`
+	EmbL1        float32 `protobuf:"fixed32,7,opt,name=emb_l1,json=embL1,proto3" json:"emb_l1,omitempty"`
+	EmbL2        float32 `protobuf:"fixed32,8,opt,name=emb_l2,json=embL2,proto3" json:"emb_l2,omitempty"`
+	EmbSize      uint32  `protobuf:"varint,9,opt,name=emb_size,json=embSize,proto3" json:"emb_size,omitempty"`
+	Optimizer    string  `protobuf:"bytes,10,opt,name=optimizer,proto3" json:"optimizer,omitempty"`                           // ftrl(default), sgd, adagrad, adagrad_l1, adam, rmsprop
+	EmbOptimizer string  `protobuf:"bytes,11,opt,name=emb_optimizer,json=embOptimizer,proto3" json:"emb_optimizer,omitempty"` // same as optimizer if empty
+	Beta1        float32 `protobuf:"fixed32,12,opt,name=beta1,proto3" json:"beta1,omitempty"`                                 // adam first moment decay
+	Beta2        float32 `protobuf:"fixed32,13,opt,name=beta2,proto3" json:"beta2,omitempty"`                                 // adam second moment decay
+	Epsilon      float32 `protobuf:"fixed32,14,opt,name=epsilon,proto3" json:"epsilon,omitempty"`
+	Rho          float32 `protobuf:"fixed32,15,opt,name=rho,proto3" json:"rho,omitempty"` // rmsprop decay
+	// learning rate schedule over the global step (instances trained), applied to alpha and emb_alpha
+	LrSchedule  string  `protobuf:"bytes,16,opt,name=lr_schedule,json=lrSchedule,proto3" json:"lr_schedule,omitempty"`     // constant(default), step, cosine, inverse_sqrt
+	WarmupSteps uint64  `protobuf:"varint,17,opt,name=warmup_steps,json=warmupSteps,proto3" json:"warmup_steps,omitempty"` // linear warmup before the schedule starts
+	DecaySteps  uint64  `protobuf:"varint,18,opt,name=decay_steps,json=decaySteps,proto3" json:"decay_steps,omitempty"`    // step: decay interval, inverse_sqrt: time scale
+	DecayRate   float32 `protobuf:"fixed32,19,opt,name=decay_rate,json=decayRate,proto3" json:"decay_rate,omitempty"`      // step: multiplier every decay_steps
+	TotalSteps  uint64  `protobuf:"varint,20,opt,name=total_steps,json=totalSteps,proto3" json:"total_steps,omitempty"`    // cosine: steps to reach min_lr_rate
+	MinLrRate   float32 `protobuf:"fixed32,21,opt,name=min_lr_rate,json=minLrRate,proto3" json:"min_lr_rate,omitempty"`    // lower bound of the multiplier
+	SgdDecay    float32 `protobuf:"fixed32,22,opt,name=sgd_decay,json=sgdDecay,proto3" json:"sgd_decay,omitempty"`         // sgd per parameter rate alpha / (1 + sgd_decay * updates)
+	// embedding init of new keys
+	EmbInit      string  `protobuf:"bytes,23,opt,name=emb_init,json=embInit,proto3" json:"emb_init,omitempty"`                    // uniform(default), zero, truncated_normal, xavier, he
+	EmbInitScale float32 `protobuf:"fixed32,24,opt,name=emb_init_scale,json=embInitScale,proto3" json:"emb_init_scale,omitempty"` // uniform: half range, truncated_normal: stddev, 0 keeps (-0.5, 0.5) / norm
+	EmbInitFile  string  `protobuf:"bytes,25,opt,name=emb_init_file,json=embInitFile,proto3" json:"emb_init_file,omitempty"`      // pretrained embeddings, one "slot\ttext\tv1,v2,..." per line
 }
 
 func (x *OptimConfig) Reset() {
@@ -180,34 +198,592 @@ func (x *OptimConfig) GetEmbSize() uint32 {
 	return 0
 }
 
+func (x *OptimConfig) GetOptimizer() string {
+	if x != nil {
+		return x.Optimizer
+	}
+	return ""
+}
+
+func (x *OptimConfig) GetEmbOptimizer() string {
+	if x != nil {
+		return x.EmbOptimizer
+	}
+	return ""
+}
+
+func (x *OptimConfig) GetBeta1() float32 {
+	if x != nil {
+		return x.Beta1
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetBeta2() float32 {
+	if x != nil {
+		return x.Beta2
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetEpsilon() float32 {
+	if x != nil {
+		return x.Epsilon
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetRho() float32 {
+	if x != nil {
+		return x.Rho
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetLrSchedule() string {
+	if x != nil {
+		return x.LrSchedule
+	}
+	return ""
+}
+
+func (x *OptimConfig) GetWarmupSteps() uint64 {
+	if x != nil {
+		return x.WarmupSteps
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetDecaySteps() uint64 {
+	if x != nil {
+		return x.DecaySteps
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetDecayRate() float32 {
+	if x != nil {
+		return x.DecayRate
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetTotalSteps() uint64 {
+	if x != nil {
+		return x.TotalSteps
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetMinLrRate() float32 {
+	if x != nil {
+		return x.MinLrRate
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetSgdDecay() float32 {
+	if x != nil {
+		return x.SgdDecay
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetEmbInit() string {
+	if x != nil {
+		return x.EmbInit
+	}
+	return ""
+}
+
+func (x *OptimConfig) GetEmbInitScale() float32 {
+	if x != nil {
+		return x.EmbInitScale
+	}
+	return 0
+}
+
+func (x *OptimConfig) GetEmbInitFile() string {
+	if x != nil {
+		return x.EmbInitFile
+	}
+	return ""
+}
+
+type LossConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name         string  `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"` // logistic, squared, huber, poisson, tweedie, ranknet, bpr, lambdarank
+	HuberDelta   float32 `protobuf:"fixed32,2,opt,name=huber_delta,json=huberDelta,proto3" json:"huber_delta,omitempty"`
+	TweediePower float32 `protobuf:"fixed32,3,opt,name=tweedie_power,json=tweediePower,proto3" json:"tweedie_power,omitempty"`
+	RankSigma    float32 `protobuf:"fixed32,4,opt,name=rank_sigma,json=rankSigma,proto3" json:"rank_sigma,omitempty"`
+	RankTopK     uint32  `protobuf:"varint,5,opt,name=rank_top_k,json=rankTopK,proto3" json:"rank_top_k,omitempty"` // truncation of lambdarank and ndcg@k
+}
+
+func (x *LossConfig) Reset() {
+	*x = LossConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_conf_conf_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *LossConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LossConfig) ProtoMessage() {}
+
+func (x *LossConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_conf_conf_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LossConfig.ProtoReflect.Descriptor instead.
+func (*LossConfig) Descriptor() ([]byte, []int) {
+	return file_conf_conf_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *LossConfig) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *LossConfig) GetHuberDelta() float32 {
+	if x != nil {
+		return x.HuberDelta
+	}
+	return 0
+}
+
+func (x *LossConfig) GetTweediePower() float32 {
+	if x != nil {
+		return x.TweediePower
+	}
+	return 0
+}
+
+func (x *LossConfig) GetRankSigma() float32 {
+	if x != nil {
+		return x.RankSigma
+	}
+	return 0
+}
+
+func (x *LossConfig) GetRankTopK() uint32 {
+	if x != nil {
+		return x.RankTopK
+	}
+	return 0
+}
+
+type MultiTaskConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TaskName []string `protobuf:"bytes,1,rep,name=task_name,json=taskName,proto3" json:"task_name,omitempty"` // one task per label column, e.g. "ctr", "cvr"
+	Esmm     bool     `protobuf:"varint,2,opt,name=esmm,proto3" json:"esmm,omitempty"`                        // second task is trained on ctcvr = p(first task) * p(second task)
+}
+
+func (x *MultiTaskConfig) Reset() {
+	*x = MultiTaskConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_conf_conf_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MultiTaskConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MultiTaskConfig) ProtoMessage() {}
+
+func (x *MultiTaskConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_conf_conf_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MultiTaskConfig.ProtoReflect.Descriptor instead.
+func (*MultiTaskConfig) Descriptor() ([]byte, []int) {
+	return file_conf_conf_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MultiTaskConfig) GetTaskName() []string {
+	if x != nil {
+		return x.TaskName
+	}
+	return nil
+}
+
+func (x *MultiTaskConfig) GetEsmm() bool {
+	if x != nil {
+		return x.Esmm
+	}
+	return false
+}
+
 type FeatureConfig struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	SlotId  uint64     `protobuf:"varint,1,opt,name=slot_id,json=slotId,proto3" json:"slot_id,omitempty"`
-	Name    string     `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
-	VecType VectorType `protobuf:"varint,3,opt,name=vec_type,json=vecType,proto3,enum=conf.VectorType" json:"vec_type,omitempty"`
-	Cross   int32      `protobuf:"varint,4,opt,name=cross,proto3" json:"cross,omitempty"`
+	SlotId  uint64     `protobuf:"varint,1,opt,name=slot_id,json=slotId,proto3" json:"slot_id,omitempty"`
+	Name    string     `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	VecType VectorType `protobuf:"varint,3,opt,name=vec_type,json=vecType,proto3,enum=conf.VectorType" json:"vec_type,omitempty"`
+	Cross   int32      `protobuf:"varint,4,opt,name=cross,proto3" json:"cross,omitempty"`
+	// per slot overrides of optim_config, unset fields use the global value
+	L1          *float32           `protobuf:"fixed32,5,opt,name=l1,proto3,oneof" json:"l1,omitempty"`
+	L2          *float32           `protobuf:"fixed32,6,opt,name=l2,proto3,oneof" json:"l2,omitempty"`
+	Alpha       *float32           `protobuf:"fixed32,7,opt,name=alpha,proto3,oneof" json:"alpha,omitempty"`
+	EmbSize     *uint32            `protobuf:"varint,8,opt,name=emb_size,json=embSize,proto3,oneof" json:"emb_size,omitempty"` // lr ignores it, ffm does not support it
+	EmbL2       *float32           `protobuf:"fixed32,9,opt,name=emb_l2,json=embL2,proto3,oneof" json:"emb_l2,omitempty"`
+	HashBuckets *uint64            `protobuf:"varint,10,opt,name=hash_buckets,json=hashBuckets,proto3,oneof" json:"hash_buckets,omitempty"` // hashing trick buckets of the slot, 0 keeps unbounded keys
+	Transform   []*TransformConfig `protobuf:"bytes,11,rep,name=transform,proto3" json:"transform,omitempty"`                               // transforms of a numeric slot, applied in order
+	Pooling     string             `protobuf:"bytes,12,opt,name=pooling,proto3" json:"pooling,omitempty"`                                   // features of the slot in a line form a bag: sum (default), mean or sqrtn
+	MaxBag      uint32             `protobuf:"varint,13,opt,name=max_bag,json=maxBag,proto3" json:"max_bag,omitempty"`                      // keep the first max_bag features of the slot in a line, 0 keeps all
+	CrossOf     []uint64           `protobuf:"varint,14,rep,packed,name=cross_of,json=crossOf,proto3" json:"cross_of,omitempty"`            // the features of the slot are crosses of the features of these slots
+	Numeric     bool               `protobuf:"varint,15,opt,name=numeric,proto3" json:"numeric,omitempty"`                                  // features carry a value, fea:value, slots with transform always do
+}
+
+func (x *FeatureConfig) Reset() {
+	*x = FeatureConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_conf_conf_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FeatureConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FeatureConfig) ProtoMessage() {}
+
+func (x *FeatureConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_conf_conf_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FeatureConfig.ProtoReflect.Descriptor instead.
+func (*FeatureConfig) Descriptor() ([]byte, []int) {
+	return file_conf_conf_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FeatureConfig) GetSlotId() uint64 {
+	if x != nil {
+		return x.SlotId
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FeatureConfig) GetVecType() VectorType {
+	if x != nil {
+		return x.VecType
+	}
+	return VectorType_BIAS
+}
+
+func (x *FeatureConfig) GetCross() int32 {
+	if x != nil {
+		return x.Cross
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetL1() float32 {
+	if x != nil && x.L1 != nil {
+		return *x.L1
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetL2() float32 {
+	if x != nil && x.L2 != nil {
+		return *x.L2
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetAlpha() float32 {
+	if x != nil && x.Alpha != nil {
+		return *x.Alpha
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetEmbSize() uint32 {
+	if x != nil && x.EmbSize != nil {
+		return *x.EmbSize
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetEmbL2() float32 {
+	if x != nil && x.EmbL2 != nil {
+		return *x.EmbL2
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetHashBuckets() uint64 {
+	if x != nil && x.HashBuckets != nil {
+		return *x.HashBuckets
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetTransform() []*TransformConfig {
+	if x != nil {
+		return x.Transform
+	}
+	return nil
+}
+
+func (x *FeatureConfig) GetPooling() string {
+	if x != nil {
+		return x.Pooling
+	}
+	return ""
+}
+
+func (x *FeatureConfig) GetMaxBag() uint32 {
+	if x != nil {
+		return x.MaxBag
+	}
+	return 0
+}
+
+func (x *FeatureConfig) GetCrossOf() []uint64 {
+	if x != nil {
+		return x.CrossOf
+	}
+	return nil
+}
+
+func (x *FeatureConfig) GetNumeric() bool {
+	if x != nil {
+		return x.Numeric
+	}
+	return false
+}
+
+// TransformConfig maps the value of a numeric feature
+type TransformConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"` // log: sign(x)*log(1+|x|), bucket: categorical bucket of x, standardize: (x-mean)/std,
+	// quantile: bucket of x by boundaries fitted on train_list
+	Boundaries []float32 `protobuf:"fixed32,2,rep,packed,name=boundaries,proto3" json:"boundaries,omitempty"` // bucket: ascending upper bounds, x < boundaries[i] falls in bucket i
+	Mean       float32   `protobuf:"fixed32,3,opt,name=mean,proto3" json:"mean,omitempty"`                    // standardize
+	Std        float32   `protobuf:"fixed32,4,opt,name=std,proto3" json:"std,omitempty"`                      // standardize
+	Buckets    uint32    `protobuf:"varint,5,opt,name=buckets,proto3" json:"buckets,omitempty"`               // quantile: number of buckets of about the same count
+}
+
+func (x *TransformConfig) Reset() {
+	*x = TransformConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_conf_conf_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TransformConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransformConfig) ProtoMessage() {}
+
+func (x *TransformConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_conf_conf_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransformConfig.ProtoReflect.Descriptor instead.
+func (*TransformConfig) Descriptor() ([]byte, []int) {
+	return file_conf_conf_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TransformConfig) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *TransformConfig) GetBoundaries() []float32 {
+	if x != nil {
+		return x.Boundaries
+	}
+	return nil
+}
+
+func (x *TransformConfig) GetMean() float32 {
+	if x != nil {
+		return x.Mean
+	}
+	return 0
+}
+
+func (x *TransformConfig) GetStd() float32 {
+	if x != nil {
+		return x.Std
+	}
+	return 0
+}
+
+func (x *TransformConfig) GetBuckets() uint32 {
+	if x != nil {
+		return x.Buckets
+	}
+	return 0
+}
+
+// ColumnConfig maps a column of csv/tsv, by position, or a field of json lines, by name
+type ColumnConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name   string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                    // json field, for csv/tsv only a note
+	SlotId uint64 `protobuf:"varint,2,opt,name=slot_id,json=slotId,proto3" json:"slot_id,omitempty"` // feature slot of the column, 0 with label unset skips it
+	Label  bool   `protobuf:"varint,3,opt,name=label,proto3" json:"label,omitempty"`                 // label column, several label columns are the tasks of multi task in order
+	Split  string `protobuf:"bytes,4,opt,name=split,proto3" json:"split,omitempty"`                  // separator of a multi valued column, every value is a feature
+}
+
+func (x *ColumnConfig) Reset() {
+	*x = ColumnConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_conf_conf_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ColumnConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ColumnConfig) ProtoMessage() {}
+
+func (x *ColumnConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_conf_conf_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ColumnConfig.ProtoReflect.Descriptor instead.
+func (*ColumnConfig) Descriptor() ([]byte, []int) {
+	return file_conf_conf_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ColumnConfig) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ColumnConfig) GetSlotId() uint64 {
+	if x != nil {
+		return x.SlotId
+	}
+	return 0
+}
+
+func (x *ColumnConfig) GetLabel() bool {
+	if x != nil {
+		return x.Label
+	}
+	return false
+}
+
+func (x *ColumnConfig) GetSplit() string {
+	if x != nil {
+		return x.Split
+	}
+	return ""
+}
+
+type InputConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Format  string          `protobuf:"bytes,1,opt,name=format,proto3" json:"format,omitempty"`   // slot(default): label\tslot:fea ..., csv, tsv, json, criteo
+	Columns []*ColumnConfig `protobuf:"bytes,2,rep,name=columns,proto3" json:"columns,omitempty"` // csv, tsv and json schema
+	Header  bool            `protobuf:"varint,3,opt,name=header,proto3" json:"header,omitempty"`  // csv and tsv files start with a header line, other formats refuse it
 }
 
-func (x *FeatureConfig) Reset() {
-	*x = FeatureConfig{}
+func (x *InputConfig) Reset() {
+	*x = InputConfig{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_conf_conf_proto_msgTypes[1]
+		mi := &file_conf_conf_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *FeatureConfig) String() string {
+func (x *InputConfig) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*FeatureConfig) ProtoMessage() {}
+func (*InputConfig) ProtoMessage() {}
 
-func (x *FeatureConfig) ProtoReflect() protoreflect.Message {
-	mi := &file_conf_conf_proto_msgTypes[1]
+func (x *InputConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_conf_conf_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -218,39 +794,104 @@ func (x *FeatureConfig) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use FeatureConfig.ProtoReflect.Descriptor instead.
-func (*FeatureConfig) Descriptor() ([]byte, []int) {
-	return file_conf_conf_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use InputConfig.ProtoReflect.Descriptor instead.
+func (*InputConfig) Descriptor() ([]byte, []int) {
+	return file_conf_conf_proto_rawDescGZIP(), []int{6}
 }
 
-func (x *FeatureConfig) GetSlotId() uint64 {
+func (x *InputConfig) GetFormat() string {
 	if x != nil {
-		return x.SlotId
+		return x.Format
 	}
-	return 0
+	return ""
 }
 
-func (x *FeatureConfig) GetName() string {
+func (x *InputConfig) GetColumns() []*ColumnConfig {
 	if x != nil {
-		return x.Name
+		return x.Columns
 	}
-	return ""
+	return nil
 }
 
-func (x *FeatureConfig) GetVecType() VectorType {
+func (x *InputConfig) GetHeader() bool {
 	if x != nil {
-		return x.VecType
+		return x.Header
 	}
-	return VectorType_BIAS
+	return false
 }
 
-func (x *FeatureConfig) GetCross() int32 {
+// ValidationConfig bounds the bad input a run accepts, lines that fail to parse are dropped
+type ValidationConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Strict       bool    `protobuf:"varint,1,opt,name=strict,proto3" json:"strict,omitempty"`                                    // drop a line with any bad feature too, instead of the bad features only
+	MaxErrorRate float32 `protobuf:"fixed32,2,opt,name=max_error_rate,json=maxErrorRate,proto3" json:"max_error_rate,omitempty"` // abort when more than this share of lines is bad, 0 never aborts
+	MinLines     uint64  `protobuf:"varint,3,opt,name=min_lines,json=minLines,proto3" json:"min_lines,omitempty"`                // lines read before the error rate is checked within a file, 1000 by default
+	Quarantine   string  `protobuf:"bytes,4,opt,name=quarantine,proto3" json:"quarantine,omitempty"`                             // file bad lines are written to with their reasons
+}
+
+func (x *ValidationConfig) Reset() {
+	*x = ValidationConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_conf_conf_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ValidationConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidationConfig) ProtoMessage() {}
+
+func (x *ValidationConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_conf_conf_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidationConfig.ProtoReflect.Descriptor instead.
+func (*ValidationConfig) Descriptor() ([]byte, []int) {
+	return file_conf_conf_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ValidationConfig) GetStrict() bool {
 	if x != nil {
-		return x.Cross
+		return x.Strict
+	}
+	return false
+}
+
+func (x *ValidationConfig) GetMaxErrorRate() float32 {
+	if x != nil {
+		return x.MaxErrorRate
+	}
+	return 0
+}
+
+func (x *ValidationConfig) GetMinLines() uint64 {
+	if x != nil {
+		return x.MinLines
 	}
 	return 0
 }
 
+func (x *ValidationConfig) GetQuarantine() string {
+	if x != nil {
+		return x.Quarantine
+	}
+	return ""
+}
+
 type AllConfig struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -262,12 +903,31 @@ type AllConfig struct {
 	GroupSparse     bool             `protobuf:"varint,4,opt,name=group_sparse,json=groupSparse,proto3" json:"group_sparse,omitempty"`
 	TrainList       []string         `protobuf:"bytes,5,rep,name=train_list,json=trainList,proto3" json:"train_list,omitempty"`
 	PredictList     []string         `protobuf:"bytes,6,rep,name=predict_list,json=predictList,proto3" json:"predict_list,omitempty"`
+	LossConfig      *LossConfig      `protobuf:"bytes,7,opt,name=loss_config,json=lossConfig,proto3" json:"loss_config,omitempty"`
+	MultiTaskConfig *MultiTaskConfig `protobuf:"bytes,8,opt,name=multi_task_config,json=multiTaskConfig,proto3" json:"multi_task_config,omitempty"`
+	MiniBatch       bool             `protobuf:"varint,9,opt,name=mini_batch,json=miniBatch,proto3" json:"mini_batch,omitempty"`    // lr/fm sum gradients of a batch per key and update each key once
+	Seed            uint64           `protobuf:"varint,10,opt,name=seed,proto3" json:"seed,omitempty"`                              // non zero seed makes training deterministic
+	ParamStore      string           `protobuf:"bytes,11,opt,name=param_store,json=paramStore,proto3" json:"param_store,omitempty"` // map(default), arena: open addressing tables over float32 chunks, mmap: arena layout in a file,
+	// dense: preallocated entries of hashed slots, ps: parameter servers of ps_servers
+	MmapPath     string   `protobuf:"bytes,12,opt,name=mmap_path,json=mmapPath,proto3" json:"mmap_path,omitempty"`              // file of the mmap store, it is reused by the next run with the same layout
+	MmapCapacity uint64   `protobuf:"varint,13,opt,name=mmap_capacity,json=mmapCapacity,proto3" json:"mmap_capacity,omitempty"` // keys of the mmap store, the file is sparse so it may be generous
+	HashBuckets  uint64   `protobuf:"varint,14,opt,name=hash_buckets,json=hashBuckets,proto3" json:"hash_buckets,omitempty"`    // hashing trick buckets of slots without their own hash_buckets, 0 keeps unbounded keys
+	PsServers    []string `protobuf:"bytes,15,rep,name=ps_servers,json=psServers,proto3" json:"ps_servers,omitempty"`           // host:port of the parameter servers, key k is owned by server k % n
+	PsWorker     uint64   `protobuf:"varint,21,opt,name=ps_worker,json=psWorker,proto3" json:"ps_worker,omitempty"`             // id of the worker on the parameter servers, every worker of a job needs its own
+	// data parallel training: every worker trains its own model on a shard of train_list and
+	// averages it with the others through the coordinator every avg_interval instances
+	AvgCoordinator   string            `protobuf:"bytes,16,opt,name=avg_coordinator,json=avgCoordinator,proto3" json:"avg_coordinator,omitempty"` // host:port of the coordinator
+	AvgWorkers       uint32            `protobuf:"varint,17,opt,name=avg_workers,json=avgWorkers,proto3" json:"avg_workers,omitempty"`
+	AvgInterval      uint64            `protobuf:"varint,18,opt,name=avg_interval,json=avgInterval,proto3" json:"avg_interval,omitempty"`
+	AvgTimeout       uint64            `protobuf:"varint,22,opt,name=avg_timeout,json=avgTimeout,proto3" json:"avg_timeout,omitempty"` // seconds a round waits for the workers, missing ones are dropped then, 600 by default
+	InputConfig      *InputConfig      `protobuf:"bytes,19,opt,name=input_config,json=inputConfig,proto3" json:"input_config,omitempty"`
+	ValidationConfig *ValidationConfig `protobuf:"bytes,20,opt,name=validation_config,json=validationConfig,proto3" json:"validation_config,omitempty"`
 }
 
 func (x *AllConfig) Reset() {
 	*x = AllConfig{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_conf_conf_proto_msgTypes[2]
+		mi := &file_conf_conf_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -280,7 +940,7 @@ func (x *AllConfig) String() string {
 func (*AllConfig) ProtoMessage() {}
 
 func (x *AllConfig) ProtoReflect() protoreflect.Message {
-	mi := &file_conf_conf_proto_msgTypes[2]
+	mi := &file_conf_conf_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -293,7 +953,7 @@ func (x *AllConfig) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AllConfig.ProtoReflect.Descriptor instead.
 func (*AllConfig) Descriptor() ([]byte, []int) {
-	return file_conf_conf_proto_rawDescGZIP(), []int{2}
+	return file_conf_conf_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *AllConfig) GetOptimConfig() *OptimConfig {
@@ -338,11 +998,123 @@ func (x *AllConfig) GetPredictList() []string {
 	return nil
 }
 
+func (x *AllConfig) GetLossConfig() *LossConfig {
+	if x != nil {
+		return x.LossConfig
+	}
+	return nil
+}
+
+func (x *AllConfig) GetMultiTaskConfig() *MultiTaskConfig {
+	if x != nil {
+		return x.MultiTaskConfig
+	}
+	return nil
+}
+
+func (x *AllConfig) GetMiniBatch() bool {
+	if x != nil {
+		return x.MiniBatch
+	}
+	return false
+}
+
+func (x *AllConfig) GetSeed() uint64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+func (x *AllConfig) GetParamStore() string {
+	if x != nil {
+		return x.ParamStore
+	}
+	return ""
+}
+
+func (x *AllConfig) GetMmapPath() string {
+	if x != nil {
+		return x.MmapPath
+	}
+	return ""
+}
+
+func (x *AllConfig) GetMmapCapacity() uint64 {
+	if x != nil {
+		return x.MmapCapacity
+	}
+	return 0
+}
+
+func (x *AllConfig) GetHashBuckets() uint64 {
+	if x != nil {
+		return x.HashBuckets
+	}
+	return 0
+}
+
+func (x *AllConfig) GetPsServers() []string {
+	if x != nil {
+		return x.PsServers
+	}
+	return nil
+}
+
+func (x *AllConfig) GetPsWorker() uint64 {
+	if x != nil {
+		return x.PsWorker
+	}
+	return 0
+}
+
+func (x *AllConfig) GetAvgCoordinator() string {
+	if x != nil {
+		return x.AvgCoordinator
+	}
+	return ""
+}
+
+func (x *AllConfig) GetAvgWorkers() uint32 {
+	if x != nil {
+		return x.AvgWorkers
+	}
+	return 0
+}
+
+func (x *AllConfig) GetAvgInterval() uint64 {
+	if x != nil {
+		return x.AvgInterval
+	}
+	return 0
+}
+
+func (x *AllConfig) GetAvgTimeout() uint64 {
+	if x != nil {
+		return x.AvgTimeout
+	}
+	return 0
+}
+
+func (x *AllConfig) GetInputConfig() *InputConfig {
+	if x != nil {
+		return x.InputConfig
+	}
+	return nil
+}
+
+func (x *AllConfig) GetValidationConfig() *ValidationConfig {
+	if x != nil {
+		return x.ValidationConfig
+	}
+	return nil
+}
+
 var File_conf_conf_proto protoreflect.FileDescriptor
 
 var file_conf_conf_proto_rawDesc = []byte{
 	0x0a, 0x0f, 0x63, 0x6f, 0x6e, 0x66, 0x2f, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x12, 0x04, 0x63, 0x6f, 0x6e, 0x66, 0x22, 0xd8, 0x01, 0x0a, 0x0b, 0x4f, 0x70, 0x74, 0x69,
+	0x6f, 0x12, 0x04, 0x63, 0x6f, 0x6e, 0x66, 0x22, 0xba, 0x05, 0x0a, 0x0b, 0x4f, 0x70, 0x74, 0x69,
 	0x6d, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x0e, 0x0a, 0x02, 0x6c, 0x31, 0x18, 0x01, 0x20,
 	0x01, 0x28, 0x02, 0x52, 0x02, 0x6c, 0x31, 0x12, 0x0e, 0x0a, 0x02, 0x6c, 0x32, 0x18, 0x02, 0x20,
 	0x01, 0x28, 0x02, 0x52, 0x02, 0x6c, 0x32, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x6c, 0x70, 0x68, 0x61,
@@ -356,35 +1128,175 @@ var file_conf_conf_proto_rawDesc = []byte{
 	0x12, 0x15, 0x0a, 0x06, 0x65, 0x6d, 0x62, 0x5f, 0x6c, 0x32, 0x18, 0x08, 0x20, 0x01, 0x28, 0x02,
 	0x52, 0x05, 0x65, 0x6d, 0x62, 0x4c, 0x32, 0x12, 0x19, 0x0a, 0x08, 0x65, 0x6d, 0x62, 0x5f, 0x73,
 	0x69, 0x7a, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x65, 0x6d, 0x62, 0x53, 0x69,
-	0x7a, 0x65, 0x22, 0x7f, 0x0a, 0x0d, 0x46, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x43, 0x6f, 0x6e,
-	0x66, 0x69, 0x67, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x6c, 0x6f, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x73, 0x6c, 0x6f, 0x74, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04,
-	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65,
-	0x12, 0x2b, 0x0a, 0x08, 0x76, 0x65, 0x63, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x0e, 0x32, 0x10, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x56, 0x65, 0x63, 0x74, 0x6f, 0x72,
-	0x54, 0x79, 0x70, 0x65, 0x52, 0x07, 0x76, 0x65, 0x63, 0x54, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a,
-	0x05, 0x63, 0x72, 0x6f, 0x73, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x63, 0x72,
-	0x6f, 0x73, 0x73, 0x22, 0x8a, 0x02, 0x0a, 0x09, 0x41, 0x6c, 0x6c, 0x43, 0x6f, 0x6e, 0x66, 0x69,
-	0x67, 0x12, 0x34, 0x0a, 0x0c, 0x6f, 0x70, 0x74, 0x69, 0x6d, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69,
-	0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x4f,
-	0x70, 0x74, 0x69, 0x6d, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x0b, 0x6f, 0x70, 0x74, 0x69,
-	0x6d, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x36, 0x0a, 0x0c, 0x66, 0x65, 0x61, 0x74, 0x75,
-	0x72, 0x65, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e,
-	0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x46, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x43, 0x6f, 0x6e, 0x66,
-	0x69, 0x67, 0x52, 0x0b, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x12,
-	0x2a, 0x0a, 0x11, 0x69, 0x73, 0x5f, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x5f, 0x73, 0x69,
-	0x67, 0x6e, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x69, 0x73, 0x46, 0x65,
-	0x61, 0x74, 0x75, 0x72, 0x65, 0x53, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x67,
-	0x72, 0x6f, 0x75, 0x70, 0x5f, 0x73, 0x70, 0x61, 0x72, 0x73, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x08, 0x52, 0x0b, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x53, 0x70, 0x61, 0x72, 0x73, 0x65, 0x12, 0x1d,
-	0x0a, 0x0a, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x05, 0x20, 0x03,
-	0x28, 0x09, 0x52, 0x09, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x12, 0x21, 0x0a,
-	0x0c, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x06, 0x20,
-	0x03, 0x28, 0x09, 0x52, 0x0b, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x4c, 0x69, 0x73, 0x74,
-	0x2a, 0x2b, 0x0a, 0x0a, 0x56, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x54, 0x79, 0x70, 0x65, 0x12, 0x08,
-	0x0a, 0x04, 0x42, 0x49, 0x41, 0x53, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x4c, 0x45, 0x46, 0x54,
-	0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x52, 0x49, 0x47, 0x48, 0x54, 0x10, 0x02, 0x42, 0x08, 0x5a,
-	0x06, 0x2e, 0x2f, 0x63, 0x6f, 0x6e, 0x66, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x7a, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x6f, 0x70, 0x74, 0x69, 0x6d, 0x69, 0x7a, 0x65, 0x72, 0x18,
+	0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6f, 0x70, 0x74, 0x69, 0x6d, 0x69, 0x7a, 0x65, 0x72,
+	0x12, 0x23, 0x0a, 0x0d, 0x65, 0x6d, 0x62, 0x5f, 0x6f, 0x70, 0x74, 0x69, 0x6d, 0x69, 0x7a, 0x65,
+	0x72, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x65, 0x6d, 0x62, 0x4f, 0x70, 0x74, 0x69,
+	0x6d, 0x69, 0x7a, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x65, 0x74, 0x61, 0x31, 0x18, 0x0c,
+	0x20, 0x01, 0x28, 0x02, 0x52, 0x05, 0x62, 0x65, 0x74, 0x61, 0x31, 0x12, 0x14, 0x0a, 0x05, 0x62,
+	0x65, 0x74, 0x61, 0x32, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x02, 0x52, 0x05, 0x62, 0x65, 0x74, 0x61,
+	0x32, 0x12, 0x18, 0x0a, 0x07, 0x65, 0x70, 0x73, 0x69, 0x6c, 0x6f, 0x6e, 0x18, 0x0e, 0x20, 0x01,
+	0x28, 0x02, 0x52, 0x07, 0x65, 0x70, 0x73, 0x69, 0x6c, 0x6f, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x72,
+	0x68, 0x6f, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x02, 0x52, 0x03, 0x72, 0x68, 0x6f, 0x12, 0x1f, 0x0a,
+	0x0b, 0x6c, 0x72, 0x5f, 0x73, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x18, 0x10, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0a, 0x6c, 0x72, 0x53, 0x63, 0x68, 0x65, 0x64, 0x75, 0x6c, 0x65, 0x12, 0x21,
+	0x0a, 0x0c, 0x77, 0x61, 0x72, 0x6d, 0x75, 0x70, 0x5f, 0x73, 0x74, 0x65, 0x70, 0x73, 0x18, 0x11,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x77, 0x61, 0x72, 0x6d, 0x75, 0x70, 0x53, 0x74, 0x65, 0x70,
+	0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x64, 0x65, 0x63, 0x61, 0x79, 0x5f, 0x73, 0x74, 0x65, 0x70, 0x73,
+	0x18, 0x12, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x64, 0x65, 0x63, 0x61, 0x79, 0x53, 0x74, 0x65,
+	0x70, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x64, 0x65, 0x63, 0x61, 0x79, 0x5f, 0x72, 0x61, 0x74, 0x65,
+	0x18, 0x13, 0x20, 0x01, 0x28, 0x02, 0x52, 0x09, 0x64, 0x65, 0x63, 0x61, 0x79, 0x52, 0x61, 0x74,
+	0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x73, 0x74, 0x65, 0x70, 0x73,
+	0x18, 0x14, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x53, 0x74, 0x65,
+	0x70, 0x73, 0x12, 0x1e, 0x0a, 0x0b, 0x6d, 0x69, 0x6e, 0x5f, 0x6c, 0x72, 0x5f, 0x72, 0x61, 0x74,
+	0x65, 0x18, 0x15, 0x20, 0x01, 0x28, 0x02, 0x52, 0x09, 0x6d, 0x69, 0x6e, 0x4c, 0x72, 0x52, 0x61,
+	0x74, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x67, 0x64, 0x5f, 0x64, 0x65, 0x63, 0x61, 0x79, 0x18,
+	0x16, 0x20, 0x01, 0x28, 0x02, 0x52, 0x08, 0x73, 0x67, 0x64, 0x44, 0x65, 0x63, 0x61, 0x79, 0x12,
+	0x19, 0x0a, 0x08, 0x65, 0x6d, 0x62, 0x5f, 0x69, 0x6e, 0x69, 0x74, 0x18, 0x17, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x07, 0x65, 0x6d, 0x62, 0x49, 0x6e, 0x69, 0x74, 0x12, 0x24, 0x0a, 0x0e, 0x65, 0x6d,
+	0x62, 0x5f, 0x69, 0x6e, 0x69, 0x74, 0x5f, 0x73, 0x63, 0x61, 0x6c, 0x65, 0x18, 0x18, 0x20, 0x01,
+	0x28, 0x02, 0x52, 0x0c, 0x65, 0x6d, 0x62, 0x49, 0x6e, 0x69, 0x74, 0x53, 0x63, 0x61, 0x6c, 0x65,
+	0x12, 0x22, 0x0a, 0x0d, 0x65, 0x6d, 0x62, 0x5f, 0x69, 0x6e, 0x69, 0x74, 0x5f, 0x66, 0x69, 0x6c,
+	0x65, 0x18, 0x19, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x65, 0x6d, 0x62, 0x49, 0x6e, 0x69, 0x74,
+	0x46, 0x69, 0x6c, 0x65, 0x22, 0xa3, 0x01, 0x0a, 0x0a, 0x4c, 0x6f, 0x73, 0x73, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x68, 0x75, 0x62, 0x65, 0x72,
+	0x5f, 0x64, 0x65, 0x6c, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x02, 0x52, 0x0a, 0x68, 0x75,
+	0x62, 0x65, 0x72, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x12, 0x23, 0x0a, 0x0d, 0x74, 0x77, 0x65, 0x65,
+	0x64, 0x69, 0x65, 0x5f, 0x70, 0x6f, 0x77, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x02, 0x52,
+	0x0c, 0x74, 0x77, 0x65, 0x65, 0x64, 0x69, 0x65, 0x50, 0x6f, 0x77, 0x65, 0x72, 0x12, 0x1d, 0x0a,
+	0x0a, 0x72, 0x61, 0x6e, 0x6b, 0x5f, 0x73, 0x69, 0x67, 0x6d, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x02, 0x52, 0x09, 0x72, 0x61, 0x6e, 0x6b, 0x53, 0x69, 0x67, 0x6d, 0x61, 0x12, 0x1c, 0x0a, 0x0a,
+	0x72, 0x61, 0x6e, 0x6b, 0x5f, 0x74, 0x6f, 0x70, 0x5f, 0x6b, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x08, 0x72, 0x61, 0x6e, 0x6b, 0x54, 0x6f, 0x70, 0x4b, 0x22, 0x42, 0x0a, 0x0f, 0x4d, 0x75,
+	0x6c, 0x74, 0x69, 0x54, 0x61, 0x73, 0x6b, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x1b, 0x0a,
+	0x09, 0x74, 0x61, 0x73, 0x6b, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x08, 0x74, 0x61, 0x73, 0x6b, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x65, 0x73,
+	0x6d, 0x6d, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x65, 0x73, 0x6d, 0x6d, 0x22, 0x86,
+	0x04, 0x0a, 0x0d, 0x46, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x12, 0x17, 0x0a, 0x07, 0x73, 0x6c, 0x6f, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x06, 0x73, 0x6c, 0x6f, 0x74, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x2b, 0x0a,
+	0x08, 0x76, 0x65, 0x63, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x10, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x56, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x54, 0x79, 0x70,
+	0x65, 0x52, 0x07, 0x76, 0x65, 0x63, 0x54, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x72,
+	0x6f, 0x73, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x63, 0x72, 0x6f, 0x73, 0x73,
+	0x12, 0x13, 0x0a, 0x02, 0x6c, 0x31, 0x18, 0x05, 0x20, 0x01, 0x28, 0x02, 0x48, 0x00, 0x52, 0x02,
+	0x6c, 0x31, 0x88, 0x01, 0x01, 0x12, 0x13, 0x0a, 0x02, 0x6c, 0x32, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x02, 0x48, 0x01, 0x52, 0x02, 0x6c, 0x32, 0x88, 0x01, 0x01, 0x12, 0x19, 0x0a, 0x05, 0x61, 0x6c,
+	0x70, 0x68, 0x61, 0x18, 0x07, 0x20, 0x01, 0x28, 0x02, 0x48, 0x02, 0x52, 0x05, 0x61, 0x6c, 0x70,
+	0x68, 0x61, 0x88, 0x01, 0x01, 0x12, 0x1e, 0x0a, 0x08, 0x65, 0x6d, 0x62, 0x5f, 0x73, 0x69, 0x7a,
+	0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x03, 0x52, 0x07, 0x65, 0x6d, 0x62, 0x53, 0x69,
+	0x7a, 0x65, 0x88, 0x01, 0x01, 0x12, 0x1a, 0x0a, 0x06, 0x65, 0x6d, 0x62, 0x5f, 0x6c, 0x32, 0x18,
+	0x09, 0x20, 0x01, 0x28, 0x02, 0x48, 0x04, 0x52, 0x05, 0x65, 0x6d, 0x62, 0x4c, 0x32, 0x88, 0x01,
+	0x01, 0x12, 0x26, 0x0a, 0x0c, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74,
+	0x73, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x04, 0x48, 0x05, 0x52, 0x0b, 0x68, 0x61, 0x73, 0x68, 0x42,
+	0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x88, 0x01, 0x01, 0x12, 0x33, 0x0a, 0x09, 0x74, 0x72, 0x61,
+	0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x18, 0x0b, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x63,
+	0x6f, 0x6e, 0x66, 0x2e, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x52, 0x09, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x12, 0x18,
+	0x0a, 0x07, 0x70, 0x6f, 0x6f, 0x6c, 0x69, 0x6e, 0x67, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x07, 0x70, 0x6f, 0x6f, 0x6c, 0x69, 0x6e, 0x67, 0x12, 0x17, 0x0a, 0x07, 0x6d, 0x61, 0x78, 0x5f,
+	0x62, 0x61, 0x67, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6d, 0x61, 0x78, 0x42, 0x61,
+	0x67, 0x12, 0x19, 0x0a, 0x08, 0x63, 0x72, 0x6f, 0x73, 0x73, 0x5f, 0x6f, 0x66, 0x18, 0x0e, 0x20,
+	0x03, 0x28, 0x04, 0x52, 0x07, 0x63, 0x72, 0x6f, 0x73, 0x73, 0x4f, 0x66, 0x12, 0x18, 0x0a, 0x07,
+	0x6e, 0x75, 0x6d, 0x65, 0x72, 0x69, 0x63, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x6e,
+	0x75, 0x6d, 0x65, 0x72, 0x69, 0x63, 0x42, 0x05, 0x0a, 0x03, 0x5f, 0x6c, 0x31, 0x42, 0x05, 0x0a,
+	0x03, 0x5f, 0x6c, 0x32, 0x42, 0x08, 0x0a, 0x06, 0x5f, 0x61, 0x6c, 0x70, 0x68, 0x61, 0x42, 0x0b,
+	0x0a, 0x09, 0x5f, 0x65, 0x6d, 0x62, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x42, 0x09, 0x0a, 0x07, 0x5f,
+	0x65, 0x6d, 0x62, 0x5f, 0x6c, 0x32, 0x42, 0x0f, 0x0a, 0x0d, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x5f,
+	0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x22, 0x85, 0x01, 0x0a, 0x0f, 0x54, 0x72, 0x61, 0x6e,
+	0x73, 0x66, 0x6f, 0x72, 0x6d, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x74,
+	0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12,
+	0x1e, 0x0a, 0x0a, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x61, 0x72, 0x69, 0x65, 0x73, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x02, 0x52, 0x0a, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x61, 0x72, 0x69, 0x65, 0x73, 0x12,
+	0x12, 0x0a, 0x04, 0x6d, 0x65, 0x61, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x02, 0x52, 0x04, 0x6d,
+	0x65, 0x61, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x74, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x02,
+	0x52, 0x03, 0x73, 0x74, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x22,
+	0x67, 0x0a, 0x0c, 0x43, 0x6f, 0x6c, 0x75, 0x6d, 0x6e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12,
+	0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x6c, 0x6f, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x73, 0x6c, 0x6f, 0x74, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05,
+	0x6c, 0x61, 0x62, 0x65, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x6c, 0x61, 0x62,
+	0x65, 0x6c, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x70, 0x6c, 0x69, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x73, 0x70, 0x6c, 0x69, 0x74, 0x22, 0x6b, 0x0a, 0x0b, 0x49, 0x6e, 0x70, 0x75,
+	0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61,
+	0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12,
+	0x2c, 0x0a, 0x07, 0x63, 0x6f, 0x6c, 0x75, 0x6d, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x12, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x43, 0x6f, 0x6c, 0x75, 0x6d, 0x6e, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x52, 0x07, 0x63, 0x6f, 0x6c, 0x75, 0x6d, 0x6e, 0x73, 0x12, 0x16, 0x0a,
+	0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x68,
+	0x65, 0x61, 0x64, 0x65, 0x72, 0x22, 0x8d, 0x01, 0x0a, 0x10, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74,
+	0x72, 0x69, 0x63, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x73, 0x74, 0x72, 0x69,
+	0x63, 0x74, 0x12, 0x24, 0x0a, 0x0e, 0x6d, 0x61, 0x78, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x5f,
+	0x72, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x02, 0x52, 0x0c, 0x6d, 0x61, 0x78, 0x45,
+	0x72, 0x72, 0x6f, 0x72, 0x52, 0x61, 0x74, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x6d, 0x69, 0x6e, 0x5f,
+	0x6c, 0x69, 0x6e, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x6d, 0x69, 0x6e,
+	0x4c, 0x69, 0x6e, 0x65, 0x73, 0x12, 0x1e, 0x0a, 0x0a, 0x71, 0x75, 0x61, 0x72, 0x61, 0x6e, 0x74,
+	0x69, 0x6e, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x71, 0x75, 0x61, 0x72, 0x61,
+	0x6e, 0x74, 0x69, 0x6e, 0x65, 0x22, 0xfe, 0x06, 0x0a, 0x09, 0x41, 0x6c, 0x6c, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x12, 0x34, 0x0a, 0x0c, 0x6f, 0x70, 0x74, 0x69, 0x6d, 0x5f, 0x63, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x63, 0x6f, 0x6e, 0x66,
+	0x2e, 0x4f, 0x70, 0x74, 0x69, 0x6d, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x0b, 0x6f, 0x70,
+	0x74, 0x69, 0x6d, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x36, 0x0a, 0x0c, 0x66, 0x65, 0x61,
+	0x74, 0x75, 0x72, 0x65, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x13, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x46, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x52, 0x0b, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x4c, 0x69, 0x73,
+	0x74, 0x12, 0x2a, 0x0a, 0x11, 0x69, 0x73, 0x5f, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x5f,
+	0x73, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x69, 0x73,
+	0x46, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x53, 0x69, 0x67, 0x6e, 0x65, 0x64, 0x12, 0x21, 0x0a,
+	0x0c, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x5f, 0x73, 0x70, 0x61, 0x72, 0x73, 0x65, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x0b, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x53, 0x70, 0x61, 0x72, 0x73, 0x65,
+	0x12, 0x1d, 0x0a, 0x0a, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x05,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x4c, 0x69, 0x73, 0x74, 0x12,
+	0x21, 0x0a, 0x0c, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18,
+	0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b, 0x70, 0x72, 0x65, 0x64, 0x69, 0x63, 0x74, 0x4c, 0x69,
+	0x73, 0x74, 0x12, 0x31, 0x0a, 0x0b, 0x6c, 0x6f, 0x73, 0x73, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x4c,
+	0x6f, 0x73, 0x73, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x0a, 0x6c, 0x6f, 0x73, 0x73, 0x43,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x41, 0x0a, 0x11, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x5f, 0x74,
+	0x61, 0x73, 0x6b, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x15, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x4d, 0x75, 0x6c, 0x74, 0x69, 0x54, 0x61, 0x73,
+	0x6b, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x0f, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x54, 0x61,
+	0x73, 0x6b, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x1d, 0x0a, 0x0a, 0x6d, 0x69, 0x6e, 0x69,
+	0x5f, 0x62, 0x61, 0x74, 0x63, 0x68, 0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x6d, 0x69,
+	0x6e, 0x69, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x65, 0x65, 0x64, 0x18,
+	0x0a, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x73, 0x65, 0x65, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x70,
+	0x61, 0x72, 0x61, 0x6d, 0x5f, 0x73, 0x74, 0x6f, 0x72, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0a, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x12, 0x1b, 0x0a, 0x09,
+	0x6d, 0x6d, 0x61, 0x70, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x6d, 0x6d, 0x61, 0x70, 0x50, 0x61, 0x74, 0x68, 0x12, 0x23, 0x0a, 0x0d, 0x6d, 0x6d, 0x61,
+	0x70, 0x5f, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x0c, 0x6d, 0x6d, 0x61, 0x70, 0x43, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x12, 0x21,
+	0x0a, 0x0c, 0x68, 0x61, 0x73, 0x68, 0x5f, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x0e,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x68, 0x61, 0x73, 0x68, 0x42, 0x75, 0x63, 0x6b, 0x65, 0x74,
+	0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x70, 0x73, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x73, 0x18,
+	0x0f, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x70, 0x73, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x73,
+	0x12, 0x1b, 0x0a, 0x09, 0x70, 0x73, 0x5f, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x18, 0x15, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x08, 0x70, 0x73, 0x57, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x12, 0x27, 0x0a,
+	0x0f, 0x61, 0x76, 0x67, 0x5f, 0x63, 0x6f, 0x6f, 0x72, 0x64, 0x69, 0x6e, 0x61, 0x74, 0x6f, 0x72,
+	0x18, 0x10, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x61, 0x76, 0x67, 0x43, 0x6f, 0x6f, 0x72, 0x64,
+	0x69, 0x6e, 0x61, 0x74, 0x6f, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x61, 0x76, 0x67, 0x5f, 0x77, 0x6f,
+	0x72, 0x6b, 0x65, 0x72, 0x73, 0x18, 0x11, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x61, 0x76, 0x67,
+	0x57, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x61, 0x76, 0x67, 0x5f, 0x69,
+	0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x18, 0x12, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0b, 0x61,
+	0x76, 0x67, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x12, 0x1f, 0x0a, 0x0b, 0x61, 0x76,
+	0x67, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x18, 0x16, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x0a, 0x61, 0x76, 0x67, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x12, 0x34, 0x0a, 0x0c, 0x69,
+	0x6e, 0x70, 0x75, 0x74, 0x5f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x13, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x11, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x2e, 0x49, 0x6e, 0x70, 0x75, 0x74, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x52, 0x0b, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x12, 0x43, 0x0a, 0x11, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x5f,
+	0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x14, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x63,
+	0x6f, 0x6e, 0x66, 0x2e, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x52, 0x10, 0x76, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2a, 0x2b, 0x0a, 0x0a, 0x56, 0x65, 0x63, 0x74, 0x6f, 0x72,
+	0x54, 0x79, 0x70, 0x65, 0x12, 0x08, 0x0a, 0x04, 0x42, 0x49, 0x41, 0x53, 0x10, 0x00, 0x12, 0x08,
+	0x0a, 0x04, 0x4c, 0x45, 0x46, 0x54, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x52, 0x49, 0x47, 0x48,
+	0x54, 0x10, 0x02, 0x42, 0x08, 0x5a, 0x06, 0x2e, 0x2f, 0x63, 0x6f, 0x6e, 0x66, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -400,22 +1312,34 @@ func file_conf_conf_proto_rawDescGZIP() []byte {
 }
 
 var file_conf_conf_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_conf_conf_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_conf_conf_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_conf_conf_proto_goTypes = []interface{}{
-	(VectorType)(0),       // 0: conf.VectorType
-	(*OptimConfig)(nil),   // 1: conf.OptimConfig
-	(*FeatureConfig)(nil), // 2: conf.FeatureConfig
-	(*AllConfig)(nil),     // 3: conf.AllConfig
+	(VectorType)(0),          // 0: conf.VectorType
+	(*OptimConfig)(nil),      // 1: conf.OptimConfig
+	(*LossConfig)(nil),       // 2: conf.LossConfig
+	(*MultiTaskConfig)(nil),  // 3: conf.MultiTaskConfig
+	(*FeatureConfig)(nil),    // 4: conf.FeatureConfig
+	(*TransformConfig)(nil),  // 5: conf.TransformConfig
+	(*ColumnConfig)(nil),     // 6: conf.ColumnConfig
+	(*InputConfig)(nil),      // 7: conf.InputConfig
+	(*ValidationConfig)(nil), // 8: conf.ValidationConfig
+	(*AllConfig)(nil),        // 9: conf.AllConfig
 }
 var file_conf_conf_proto_depIdxs = []int32{
 	0, // 0: conf.FeatureConfig.vec_type:type_name -> conf.VectorType
-	1, // 1: conf.AllConfig.optim_config:type_name -> conf.OptimConfig
-	2, // 2: conf.AllConfig.feature_list:type_name -> conf.FeatureConfig
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	5, // 1: conf.FeatureConfig.transform:type_name -> conf.TransformConfig
+	6, // 2: conf.InputConfig.columns:type_name -> conf.ColumnConfig
+	1, // 3: conf.AllConfig.optim_config:type_name -> conf.OptimConfig
+	4, // 4: conf.AllConfig.feature_list:type_name -> conf.FeatureConfig
+	2, // 5: conf.AllConfig.loss_config:type_name -> conf.LossConfig
+	3, // 6: conf.AllConfig.multi_task_config:type_name -> conf.MultiTaskConfig
+	7, // 7: conf.AllConfig.input_config:type_name -> conf.InputConfig
+	8, // 8: conf.AllConfig.validation_config:type_name -> conf.ValidationConfig
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_conf_conf_proto_init() }
@@ -437,7 +1361,7 @@ func file_conf_conf_proto_init() {
 			}
 		}
 		file_conf_conf_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*FeatureConfig); i {
+			switch v := v.(*LossConfig); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -449,6 +1373,78 @@ func file_conf_conf_proto_init() {
 			}
 		}
 		file_conf_conf_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MultiTaskConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_conf_conf_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FeatureConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_conf_conf_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TransformConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_conf_conf_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ColumnConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_conf_conf_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InputConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_conf_conf_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ValidationConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_conf_conf_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*AllConfig); i {
 			case 0:
 				return &v.state
@@ -461,13 +1457,14 @@ func file_conf_conf_proto_init() {
 			}
 		}
 	}
+	file_conf_conf_proto_msgTypes[3].OneofWrappers = []interface{}{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_conf_conf_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   3,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
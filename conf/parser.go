@@ -26,3 +26,11 @@ func ParseConf(p string) *AllConfig {
 	}
 	return config
 }
+
+// HashBuckets is the number of hashing trick buckets of a slot, 0 if its keys are not bounded
+func HashBuckets(config *AllConfig, x *FeatureConfig) uint64 {
+	if x.HashBuckets != nil {
+		return *x.HashBuckets
+	}
+	return config.HashBuckets
+}
@@ -31,3 +31,11 @@ func TestConfigParser(t *testing.T) {
 		t.Error("train list parse error")
 	}
 }
+
+func TestConfigParser_SlotOptim(t *testing.T) {
+	config := ParseConf("testdata/slot_optim.conf")
+	userFea, itemFea := config.FeatureList[0], config.FeatureList[1]
+	if userFea.L1 != nil || itemFea.L1 == nil || *itemFea.L1 != 0.0 || itemFea.GetEmbSize() != 4 {
+		t.Error("parse per slot optim config error")
+	}
+}
@@ -0,0 +1,244 @@
+package dataloader
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/dgryski/go-farm"
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// A cache file holds parsed instances: the magic, the fingerprint of the config that parsed them,
+// then one record per instance, little endian:
+//
+//	uint32 size of the rest of the record
+//	uint8 label count, float32 labels
+//	float32 weight, 1 as the text formats carry none
+//	uint64 user id, uint64 item id
+//	uint32 feature count, (uint16 slot, uint64 key, float32 value) per feature
+//
+// Keys and values are final, with hash buckets, transforms, crosses and pooling applied, and
+// feature texts are not kept. The last byte of the magic is the version of the format.
+const cacheMagic = "LMCACHE2"
+
+// cacheChunk starts a batch of cache records sent through the line channel as one string
+const cacheChunk = "\x00cache"
+
+const (
+	cacheFeatureSize = 2 + 8 + 4
+	cacheFixedSize   = 1 + 4 + 8 + 8 + 4 // a record without labels and features
+)
+
+// cacheFingerprint covers the parts of config that change the instances parsed from text, and
+// the quantile boundaries of transforms
+func cacheFingerprint(config *conf.AllConfig, transforms map[uint16]*slotTransform) uint64 {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "signed:%v uid_slot:%d fid_slot:%d input:{%s}", config.IsFeatureSigned, *uidSlot, *fidSlot,
+		config.GetInputConfig().String())
+	if config.GetValidationConfig().GetStrict() {
+		// strict parsing drops more lines
+		sb.WriteString(" strict")
+	}
+	for _, x := range config.FeatureList {
+		fmt.Fprintf(&sb, " %d/%d", x.SlotId, conf.HashBuckets(config, x))
+		for _, t := range x.Transform {
+			fmt.Fprintf(&sb, "/{%s}", t.String())
+		}
+		if x.Numeric {
+			sb.WriteString("/numeric")
+		}
+		if len(x.CrossOf) > 0 {
+			fmt.Fprintf(&sb, "/cross:%v", x.CrossOf)
+		}
+		if x.Pooling != "" || x.MaxBag > 0 {
+			fmt.Fprintf(&sb, "/pool:%s:%d", x.Pooling, x.MaxBag)
+		}
+		if t := transforms[uint16(x.SlotId)]; t != nil && t.quantile > 0 {
+			fmt.Fprintf(&sb, "/%v", t.bucket)
+		}
+	}
+	return farm.Hash64([]byte(sb.String()))
+}
+
+// CacheWriter writes instances to a cache file
+type CacheWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewCacheWriter starts a cache of instances parsed by loader
+func NewCacheWriter(w io.Writer, loader *DataLoader) (*CacheWriter, error) {
+	c := &CacheWriter{w: bufio.NewWriterSize(w, 1<<20)}
+	c.buf = append(c.buf, cacheMagic...)
+	c.buf = binary.LittleEndian.AppendUint64(c.buf, loader.fingerprint)
+	_, err := c.w.Write(c.buf)
+	return c, err
+}
+
+func (c *CacheWriter) Write(inslist []*base.Instance) error {
+	for _, ins := range inslist {
+		labels := ins.Labels
+		if labels == nil {
+			labels = []float32{ins.Label}
+		}
+		if len(labels) > math.MaxUint8 {
+			return fmt.Errorf("%d labels, a cache record holds at most %d", len(labels), math.MaxUint8)
+		}
+		le := binary.LittleEndian
+		b := c.buf[:0]
+		b = le.AppendUint32(b, uint32(cacheFixedSize+4*len(labels)+cacheFeatureSize*len(ins.Feas)))
+		b = append(b, uint8(len(labels)))
+		for _, x := range labels {
+			b = le.AppendUint32(b, math.Float32bits(x))
+		}
+		b = le.AppendUint32(b, math.Float32bits(1))
+		b = le.AppendUint64(b, ins.UserId)
+		b = le.AppendUint64(b, ins.ItemId)
+		b = le.AppendUint32(b, uint32(len(ins.Feas)))
+		for _, x := range ins.Feas {
+			b = le.AppendUint16(b, x.Slot)
+			b = le.AppendUint64(b, x.Fea)
+			b = le.AppendUint32(b, math.Float32bits(x.Value))
+		}
+		c.buf = b
+		if _, err := c.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CacheWriter) Flush() error {
+	return c.w.Flush()
+}
+
+// readCacheHeader tells whether r is a cache, and checks that it was made with the same config
+func readCacheHeader(r *bufio.Reader, fingerprint uint64) (bool, error) {
+	head, _ := r.Peek(len(cacheMagic) + 8)
+	if len(head) < len(cacheMagic)+8 || string(head[:len(cacheMagic)-1]) != cacheMagic[:len(cacheMagic)-1] {
+		return false, nil
+	}
+	if magic := string(head[:len(cacheMagic)]); magic != cacheMagic {
+		return true, fmt.Errorf("cache of format %s, want %s, rerun preprocess", magic, cacheMagic)
+	}
+	if fp := binary.LittleEndian.Uint64(head[len(cacheMagic):]); fp != fingerprint {
+		return true, fmt.Errorf("cache made with another feature config (fingerprint %x, want %x), rerun preprocess",
+			fp, fingerprint)
+	}
+	r.Discard(len(head))
+	return true, nil
+}
+
+// readCache sends batches of LoaderBuffer records, each batch is a single string
+func (b *DataLoader) readCache(r *bufio.Reader) int {
+	total := 0
+	chunk := make([]byte, 0, 1<<16)
+	chunk = append(chunk, cacheChunk...)
+	count := 0
+	send := func() {
+		if count > 0 {
+			b.dataChan <- []string{string(chunk)}
+		}
+		chunk = append(chunk[:0], cacheChunk...)
+		count = 0
+	}
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			if err != io.EOF {
+				glog.Errorf("read cache error after %d records: %v", total, err)
+				b.readError(fmt.Errorf("read cache error after %d records: %v", total, err))
+			}
+			break
+		}
+		n := int(binary.LittleEndian.Uint32(size[:]))
+		chunk = append(chunk, size[:]...)
+		start := len(chunk)
+		chunk = append(chunk, make([]byte, n)...)
+		if _, err := io.ReadFull(r, chunk[start:]); err != nil {
+			glog.Errorf("read cache error after %d records: %v", total, err)
+			b.readError(fmt.Errorf("read cache error after %d records: %v", total, err))
+			chunk = chunk[:start-4]
+			break
+		}
+		count++
+		total++
+		if count == LoaderBuffer {
+			if b.check.stopped() {
+				break
+			}
+			send()
+		}
+	}
+	send()
+	return total
+}
+
+// parseCache decodes a batch of cache records, features of one batch share an array
+func (b *DataLoader) parseCache(chunk string) []*base.Instance {
+	data := chunk[len(cacheChunk):]
+	var inslist []*base.Instance
+	var feas []base.Feature
+	for len(data) >= 4 {
+		n := int(cacheUint32(data, 0))
+		rec := data[4 : 4+n]
+		data = data[4+n:]
+		if n < cacheFixedSize || n < cacheFixedSize+4*int(rec[0]) {
+			b.check.line("", inputErrorf(ErrFormat, "cache record of %d bytes is too short", n))
+			continue
+		}
+		z := new(base.Instance)
+		labels := make([]float32, rec[0])
+		off := 1
+		for i := range labels {
+			labels[i] = math.Float32frombits(cacheUint32(rec, off))
+			off += 4
+		}
+		setLabels(z, labels)
+		off += 4 // weight
+		z.UserId = cacheUint64(rec, off)
+		z.ItemId = cacheUint64(rec, off+8)
+		nfea := int(cacheUint32(rec, off+16))
+		off += 20
+		if off+nfea*cacheFeatureSize != n {
+			b.check.line("", inputErrorf(ErrFormat, "cache record of %d bytes does not hold %d features", n, nfea))
+			continue
+		}
+		if cap(feas)-len(feas) < nfea {
+			feas = make([]base.Feature, 0, maxInt(nfea, 16*LoaderBuffer))
+		}
+		z.Feas = make([]*base.Feature, nfea)
+		for i := 0; i < nfea; i++ {
+			feas = append(feas, base.Feature{Slot: uint16(rec[off]) | uint16(rec[off+1])<<8,
+				Fea: cacheUint64(rec, off+2), Value: math.Float32frombits(cacheUint32(rec, off+10))})
+			z.Feas[i] = &feas[len(feas)-1]
+			off += cacheFeatureSize
+		}
+		b.check.line("", nil)
+		inslist = append(inslist, z)
+	}
+	return inslist
+}
+
+// cacheUint32 and cacheUint64 read little endian numbers from a string without copying it
+func cacheUint32(s string, off int) uint32 {
+	return uint32(s[off]) | uint32(s[off+1])<<8 | uint32(s[off+2])<<16 | uint32(s[off+3])<<24
+}
+
+func cacheUint64(s string, off int) uint64 {
+	return uint64(cacheUint32(s, off)) | uint64(cacheUint32(s, off+4))<<32
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,138 @@
+package dataloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// _gen_slot_lines makes n lines of the slot format with several tasks, features per slot and a value
+func _gen_slot_lines(r *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		line := fmt.Sprintf("%d,%d\t", r.Intn(2), r.Intn(2))
+		for j := 0; j < 20; j++ {
+			line += fmt.Sprintf("%d:f%d ", 101+j%5, r.Intn(1000))
+		}
+		// a numeric feature
+		line += fmt.Sprintf("102:price:%.2f ", r.Float64())
+		lines[i] = line[:len(line)-1] + "\n"
+	}
+	return lines
+}
+
+func _cache_config() *conf.AllConfig {
+	config := &conf.AllConfig{HashBuckets: 100}
+	for _, slot := range []uint64{101, 102, 103, 104} {
+		config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: slot, Numeric: slot == 102})
+	}
+	return config
+}
+
+func _write_cache(t testing.TB, path string, dataloader *DataLoader, inslist []*base.Instance, gz bool) {
+	var buf bytes.Buffer
+	w, err := NewCacheWriter(&buf, dataloader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(inslist); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	data := buf.Bytes()
+	if gz {
+		var z bytes.Buffer
+		zw := gzip.NewWriter(&z)
+		zw.Write(data)
+		zw.Close()
+		data = z.Bytes()
+	}
+	os.WriteFile(path, data, 0644)
+}
+
+func _read_instances(t testing.TB, dataloader *DataLoader, path string) []*base.Instance {
+	pipe, err := dataloader.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inslist []*base.Instance
+	for data := range pipe {
+		inslist = append(inslist, dataloader.ParseIns(data)...)
+	}
+	return inslist
+}
+
+func TestCache_SameAsText(t *testing.T) {
+	dir := t.TempDir()
+	config := _cache_config()
+	dataloader := &DataLoader{}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	lines := _gen_slot_lines(rand.New(rand.NewSource(0)), 1000)
+	text := dataloader.ParseIns(lines)
+	for _, gz := range []bool{false, true} {
+		path := filepath.Join(dir, fmt.Sprintf("cache_%v", gz))
+		_write_cache(t, path, dataloader, text, gz)
+		cache := _read_instances(t, dataloader, path)
+		if len(cache) != len(text) {
+			t.Fatalf("read %d instances from cache, want %d", len(cache), len(text))
+		}
+		for i, x := range cache {
+			y := text[i]
+			if x.Label != y.Label || len(x.Labels) != 2 || x.Labels[1] != y.Labels[1] || x.UserId != y.UserId ||
+				x.ItemId != y.ItemId || len(x.Feas) != len(y.Feas) {
+				t.Fatalf("instance %d: %+v, want %+v", i, x, y)
+			}
+			for j := range x.Feas {
+				if x.Feas[j].Slot != y.Feas[j].Slot || x.Feas[j].Fea != y.Feas[j].Fea ||
+					x.Feas[j].Value != y.Feas[j].Value || x.Feas[j].Text != "" {
+					t.Fatalf("instance %d feature %d: %+v, want %+v", i, j, x.Feas[j], y.Feas[j])
+				}
+			}
+		}
+	}
+
+	// a loader with other hash buckets refuses the cache
+	other := _cache_config()
+	other.HashBuckets = 1000
+	dataloader = &DataLoader{}
+	dataloader.InitConfig(other)
+	if _, err := dataloader.ReadFile(filepath.Join(dir, "cache_false")); err == nil {
+		t.Error("cache of another config should be refused")
+	}
+}
+
+func BenchmarkParse_Text(b *testing.B) {
+	dataloader := &DataLoader{}
+	dataloader.InitConfig(_cache_config())
+	path := filepath.Join(b.TempDir(), "text")
+	f, _ := os.Create(path)
+	for _, l := range _gen_slot_lines(rand.New(rand.NewSource(0)), 10000) {
+		f.WriteString(l)
+	}
+	f.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_read_instances(b, dataloader, path)
+	}
+}
+
+func BenchmarkParse_Cache(b *testing.B) {
+	dataloader := &DataLoader{}
+	dataloader.InitConfig(_cache_config())
+	path := filepath.Join(b.TempDir(), "cache")
+	_write_cache(b, path, dataloader,
+		dataloader.ParseIns(_gen_slot_lines(rand.New(rand.NewSource(0)), 10000)), false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_read_instances(b, dataloader, path)
+	}
+}
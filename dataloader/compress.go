@@ -0,0 +1,312 @@
+package dataloader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var decompressWorkers = flag.Int("decompress_workers", 4, "workers decompressing multi member gzip/zstd files")
+
+type codec int
+
+const (
+	codecNone codec = iota
+	codecGzip
+	codecZstd
+	codecSnappy
+)
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b, 0x08}
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	snappyMagic = []byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}
+)
+
+const (
+	// members are grouped into segments of at least minSegment compressed bytes
+	minSegment = 1 << 20
+	// past maxSegment without a member start the rest of the file is decompressed by one worker
+	maxSegment = 16 << 20
+)
+
+// detectCodec looks at the magic bytes first and at the extension of an empty or short file
+func detectCodec(path string, head []byte) codec {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return codecGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return codecZstd
+	case bytes.HasPrefix(head, snappyMagic):
+		return codecSnappy
+	}
+	if len(head) >= len(snappyMagic) {
+		return codecNone
+	}
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return codecGzip
+	case strings.HasSuffix(path, ".zst"):
+		return codecZstd
+	case strings.HasSuffix(path, ".sz"), strings.HasSuffix(path, ".snappy"):
+		return codecSnappy
+	}
+	return codecNone
+}
+
+// Stdin is the path of standard input
+const Stdin = "-"
+
+// IsStream tells whether path is stdin or a named pipe, which can be read only once
+func IsStream(path string) bool {
+	if path == Stdin {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// openInput opens a data file, gzip, zstd and snappy framed files are decompressed transparently.
+// Stdin and named pipes are read as streams, their codec is told by the magic bytes only.
+func openInput(path string) (io.ReadCloser, error) {
+	var f io.ReadCloser
+	if path == Stdin {
+		// stdin stays open, it is read once anyway
+		f = io.NopCloser(os.Stdin)
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		f = file
+	}
+	r := bufio.NewReaderSize(f, 1<<20)
+	head, _ := r.Peek(len(snappyMagic))
+	c := detectCodec(path, head)
+	if len(head) == 0 && c != codecNone {
+		// an empty compressed file has no line
+		return f, nil
+	}
+	switch c {
+	case codecGzip, codecZstd:
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(decompressParallel(c, r, pw, *decompressWorkers))
+		}()
+		return &inputFile{Reader: pr, closers: []io.Closer{pr, f}}, nil
+	case codecSnappy:
+		return &inputFile{Reader: snappy.NewReader(r), closers: []io.Closer{f}}, nil
+	}
+	return &inputFile{Reader: r, closers: []io.Closer{f}}, nil
+}
+
+type inputFile struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (f *inputFile) Close() error {
+	var err error
+	for _, c := range f.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// segment is a part of a compressed file cut at a member start, or the rest of the file
+type segment struct {
+	data []byte
+	rest io.Reader // set on the last segment when the file is not cut any further
+	out  chan decoded
+}
+
+type decoded struct {
+	data []byte
+	err  error
+}
+
+// decompressParallel decompresses the members of a gzip or zstd file on workers and writes them to
+// w in order. A file is cut wherever the magic bytes of a member appear, a cut that turns out to
+// be inside a member fails to decompress and the segments around it are decompressed together.
+func decompressParallel(c codec, r io.Reader, w io.Writer, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan *segment, workers)
+	order := make(chan *segment, workers)
+	go splitMembers(c, r, jobs, order)
+	for i := 0; i < workers; i++ {
+		go func() {
+			d := newDecoder(c)
+			for s := range jobs {
+				data, err := d.decode(s.data)
+				s.out <- decoded{data: data, err: err}
+			}
+			d.close()
+		}()
+	}
+	var carry []byte
+	var err error
+	for s := range order {
+		if err != nil {
+			continue // drain the splitter
+		}
+		if s.rest != nil {
+			err = decodeStream(c, io.MultiReader(bytes.NewReader(carry), s.rest), w)
+			carry = nil
+			continue
+		}
+		res := <-s.out
+		if carry != nil {
+			carry = append(carry, s.data...)
+			res.data, res.err = decodeAll(c, carry)
+		} else if res.err != nil {
+			carry = s.data
+		}
+		if res.err == nil {
+			carry = nil
+			_, err = w.Write(res.data)
+		}
+	}
+	if err == nil && carry != nil {
+		_, err = decodeAll(c, carry)
+	}
+	return err
+}
+
+// splitMembers sends segments to the workers and, in file order, to the writer
+func splitMembers(c codec, r io.Reader, jobs, order chan<- *segment) {
+	defer close(order)
+	defer close(jobs)
+	magic := gzipMagic
+	if c == codecZstd {
+		magic = zstdMagic
+	}
+	buf := make([]byte, 0, 2*minSegment)
+	chunk := make([]byte, minSegment)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		buf = append(buf, chunk[:n]...)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			order <- &segment{rest: &errReader{err}}
+			return
+		}
+		for len(buf) >= minSegment {
+			cut := bytes.Index(buf[minSegment:], magic)
+			if cut < 0 {
+				break
+			}
+			cut += minSegment
+			s := &segment{data: buf[:cut:cut], out: make(chan decoded, 1)}
+			jobs <- s
+			order <- s
+			buf = append(make([]byte, 0, 2*minSegment), buf[cut:]...)
+		}
+		if eof {
+			if len(buf) > 0 {
+				s := &segment{data: buf, out: make(chan decoded, 1)}
+				jobs <- s
+				order <- s
+			}
+			return
+		}
+		if len(buf) > maxSegment {
+			glog.V(3).Infof("no member start in %d bytes, decompress the rest sequentially", len(buf))
+			order <- &segment{rest: io.MultiReader(bytes.NewReader(buf), r)}
+			return
+		}
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// decoder is a reusable decompressor of one worker
+type decoder struct {
+	c    codec
+	gz   *gzip.Reader
+	zstd *zstd.Decoder
+}
+
+func newDecoder(c codec) *decoder {
+	return &decoder{c: c}
+}
+
+func (d *decoder) decode(data []byte) ([]byte, error) {
+	var r io.Reader
+	switch d.c {
+	case codecGzip:
+		if d.gz == nil {
+			gz, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			d.gz = gz
+		} else if err := d.gz.Reset(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		r = d.gz
+	case codecZstd:
+		if d.zstd == nil {
+			z, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			d.zstd = z
+		}
+		return d.zstd.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("codec %d can not be decoded in parallel", d.c)
+	}
+	return io.ReadAll(r)
+}
+
+func (d *decoder) close() {
+	if d.zstd != nil {
+		d.zstd.Close()
+	}
+}
+
+func decodeAll(c codec, data []byte) ([]byte, error) {
+	d := newDecoder(c)
+	defer d.close()
+	return d.decode(data)
+}
+
+func decodeStream(c codec, r io.Reader, w io.Writer) error {
+	switch c {
+	case codecGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, gz)
+		return err
+	case codecZstd:
+		z, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		_, err = io.Copy(w, z)
+		return err
+	}
+	return fmt.Errorf("codec %d can not be streamed", c)
+}
@@ -0,0 +1,156 @@
+package dataloader
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// _gen_lines makes n lines of random text, so that they hardly compress
+func _gen_lines(r *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("%d\t101:%x 102:%x\n", i%2, r.Uint64(), r.Uint64())
+	}
+	return lines
+}
+
+// _compress writes every group of lines as a member of its own
+func _compress(t *testing.T, c codec, level int, lines []string, group int) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(lines); i += group {
+		var member bytes.Buffer
+		for _, l := range lines[i:minInt(i+group, len(lines))] {
+			member.WriteString(l)
+		}
+		switch c {
+		case codecGzip:
+			w, _ := gzip.NewWriterLevel(&out, level)
+			w.Write(member.Bytes())
+			w.Close()
+		case codecZstd:
+			w, _ := zstd.NewWriter(&out)
+			w.Write(member.Bytes())
+			w.Close()
+		case codecSnappy:
+			w := snappy.NewBufferedWriter(&out)
+			w.Write(member.Bytes())
+			w.Close()
+		}
+	}
+	return out.Bytes()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func _read_lines(t *testing.T, path string) []string {
+	dataloader := DataLoader{}
+	pipe, err := dataloader.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for data := range pipe {
+		lines = append(lines, data...)
+	}
+	return lines
+}
+
+func _eq_lines(t *testing.T, name string, got, want []string) {
+	if len(got) != len(want) {
+		t.Errorf("%s: read %d lines, want %d", name, len(got), len(want))
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: line %d is %q, want %q", name, i, got[i], want[i])
+			return
+		}
+	}
+}
+
+func TestReadCompressed(t *testing.T) {
+	dir := t.TempDir()
+	lines := _gen_lines(rand.New(rand.NewSource(0)), 200000)
+	cases := []struct {
+		name  string
+		c     codec
+		group int
+	}{
+		{"single.gz", codecGzip, len(lines)},
+		{"members.gz", codecGzip, 1000},
+		{"single.zst", codecZstd, len(lines)},
+		{"frames.zst", codecZstd, 1000},
+		{"data.sz", codecSnappy, len(lines)},
+		// magic bytes, not the extension, tell the codec
+		{"members.txt", codecGzip, 1000},
+	}
+	for _, x := range cases {
+		path := filepath.Join(dir, x.name)
+		os.WriteFile(path, _compress(t, x.c, gzip.DefaultCompression, lines, x.group), 0644)
+		_eq_lines(t, x.name, _read_lines(t, path), lines)
+	}
+	// an empty compressed file has no line
+	path := filepath.Join(dir, "empty.gz")
+	os.WriteFile(path, nil, 0644)
+	_eq_lines(t, "empty.gz", _read_lines(t, path), nil)
+}
+
+func TestDecompressParallel_FalseCut(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := _gen_lines(r, 100000)
+	// stored blocks keep the text, so the gzip magic shows up inside members
+	for i := 0; i < len(lines); i += 500 {
+		lines[i] = "1\t101:\x1f\x8b\x08\x00\n"
+	}
+	for _, workers := range []int{1, 4} {
+		for _, group := range []int{50000, 7000} {
+			data := _compress(t, codecGzip, gzip.NoCompression, lines, group)
+			var out bytes.Buffer
+			if err := decompressParallel(codecGzip, bytes.NewReader(data), &out, workers); err != nil {
+				t.Fatal(err)
+			}
+			_eq_lines(t, fmt.Sprintf("workers %d, group %d", workers, group), splitLines(out.String()), lines)
+		}
+	}
+}
+
+func TestDecompressParallel_Stream(t *testing.T) {
+	// no member start within maxSegment, the rest goes to one worker
+	lines := _gen_lines(rand.New(rand.NewSource(2)), 2*maxSegment/40)
+	data := _compress(t, codecGzip, gzip.NoCompression, lines, len(lines))
+	var out bytes.Buffer
+	if err := decompressParallel(codecGzip, bytes.NewReader(data), &out, 4); err != nil {
+		t.Fatal(err)
+	}
+	_eq_lines(t, "stream", splitLines(out.String()), lines)
+}
+
+func TestDecompressParallel_Corrupt(t *testing.T) {
+	lines := _gen_lines(rand.New(rand.NewSource(3)), 100000)
+	for _, c := range []codec{codecGzip, codecZstd} {
+		data := _compress(t, c, gzip.DefaultCompression, lines, 1000)
+		var out bytes.Buffer
+		if err := decompressParallel(c, bytes.NewReader(data[:len(data)-100]), &out, 4); err == nil {
+			t.Errorf("codec %d: truncated file should fail", c)
+		}
+	}
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	return lines[:len(lines)-1]
+}
@@ -0,0 +1,147 @@
+package dataloader
+
+import (
+	"fmt"
+	"strings"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// defaultMaxCross bounds the crosses of a line in a slot without max_bag
+const defaultMaxCross = 1000
+
+// featureCross makes the features of slot from every combination of one feature of each source
+// slot, so that crosses need not be generated upstream
+type featureCross struct {
+	slot     uint16
+	sources  []uint16
+	maxCross int // combinations made per line, the max_bag of the slot
+}
+
+// initCrosses checks the crossed slots of config. Source slots out of the feature list are parsed
+// for the crosses only, and dropped once they are made.
+func (b *DataLoader) initCrosses(config *conf.AllConfig) error {
+	b.crosses = nil
+	b.crossOnly = make(map[uint16]bool)
+	crossed := make(map[uint64]bool)
+	for _, x := range config.FeatureList {
+		if len(x.CrossOf) > 0 {
+			crossed[x.SlotId] = true
+		}
+	}
+	for _, x := range config.FeatureList {
+		if len(x.CrossOf) == 0 {
+			continue
+		}
+		if len(x.CrossOf) < 2 {
+			return fmt.Errorf("slot %d: a cross needs at least 2 slots", x.SlotId)
+		}
+		if len(x.Transform) > 0 {
+			return fmt.Errorf("slot %d: a cross can not be transformed", x.SlotId)
+		}
+		c := featureCross{slot: uint16(x.SlotId), maxCross: int(x.MaxBag)}
+		if c.maxCross == 0 {
+			c.maxCross = defaultMaxCross
+		}
+		for _, slot := range x.CrossOf {
+			if crossed[slot] {
+				return fmt.Errorf("slot %d: crosses of crossed slot %d are not supported", x.SlotId, slot)
+			}
+			if !b.featureMap[uint16(slot)] {
+				b.featureMap[uint16(slot)] = true
+				b.crossOnly[uint16(slot)] = true
+			}
+			c.sources = append(c.sources, uint16(slot))
+		}
+		b.crosses = append(b.crosses, c)
+	}
+	return nil
+}
+
+// addCrosses appends the crossed features of z and drops the features parsed for crosses only. A
+// cross has the product of the values of its features, and none when a source slot is missing.
+// Source bags are cut to their max_bag first, and a cross stops after maxCross combinations.
+func (b *DataLoader) addCrosses(z *base.Instance) {
+	if len(b.crosses) == 0 {
+		return
+	}
+	b.truncateBags(z)
+	n := len(z.Feas)
+	for _, c := range b.crosses {
+		bags := make([][]*base.Feature, len(c.sources))
+		for i, slot := range c.sources {
+			for _, x := range z.Feas[:n] {
+				if x.Slot == slot {
+					bags[i] = append(bags[i], x)
+				}
+			}
+			if len(bags[i]) == 0 {
+				bags = nil
+				break
+			}
+		}
+		if bags == nil {
+			continue
+		}
+		// every combination, the index of the last source moves fastest
+		index := make([]int, len(bags))
+		combo := make([]*base.Feature, len(bags))
+		for made := 0; made < c.maxCross; made++ {
+			for i, j := range index {
+				combo[i] = bags[i][j]
+			}
+			feature := base.Feature{Slot: c.slot}
+			feature.Cross(combo)
+			if m, ok := b.buckets[c.slot]; ok {
+				feature.Bucket(m)
+			}
+			z.Feas = append(z.Feas, &feature)
+			i := len(index) - 1
+			for ; i >= 0; i-- {
+				index[i]++
+				if index[i] < len(bags[i]) {
+					break
+				}
+				index[i] = 0
+			}
+			if i < 0 {
+				break
+			}
+		}
+	}
+	if len(b.crossOnly) > 0 {
+		feas := z.Feas[:0]
+		for _, x := range z.Feas {
+			if !b.crossOnly[x.Slot] {
+				feas = append(feas, x)
+			}
+		}
+		z.Feas = feas
+	}
+}
+
+// crossKey keys the cross of c from the texts of its sources joined by '|'
+func (b *DataLoader) crossKey(c featureCross, text string) (uint64, error) {
+	texts := strings.Split(text, "|")
+	if len(texts) != len(c.sources) {
+		return 0, fmt.Errorf("cross %s of slot %d needs %d texts", text, c.slot, len(c.sources))
+	}
+	combo := make([]*base.Feature, len(texts))
+	for i, slot := range c.sources {
+		z := new(base.Instance)
+		if err := b.addFeature(z, slot, texts[i]); err != nil {
+			return 0, err
+		}
+		if len(z.Feas) == 0 {
+			return 0, fmt.Errorf("feature %d:%s is dropped", slot, texts[i])
+		}
+		combo[i] = z.Feas[0]
+	}
+	feature := base.Feature{Slot: c.slot}
+	feature.Cross(combo)
+	if m, ok := b.buckets[c.slot]; ok {
+		feature.Bucket(m)
+	}
+	return feature.Fea, nil
+}
@@ -2,10 +2,11 @@ package dataloader
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"os"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
@@ -26,110 +27,261 @@ type IDataLoader interface {
 	ReadFile(string) (<-chan []string, error)
 	ParseIns([]string) []*base.Instance
 	ParallelIterator(path string, worker int) <-chan []*base.Instance
+	CountError(kind ErrorKind, n int, err error)
+	Err() error
 }
 
 type DataLoader struct {
 	featureMap map[uint16]bool
+	numeric    map[uint16]bool   // slots whose features carry a value
+	buckets    map[uint16]uint64 // hashing trick buckets of bounded slots
+	transforms map[uint16]*slotTransform
+	pooling    map[uint16]*bagPooling // slots whose bags are not plain sums
+	crosses    []featureCross
+	crossOnly  map[uint16]bool // source slots of crosses out of the feature list
+	check      *inputCheck     // error counts and budget
+	allSlots   bool            // keep slots out of the feature list too
 	count      int
 	dataChan   chan []string
 	config     *conf.AllConfig
 	readMu     sync.Mutex
 	readStatus bool
 	isSigned   bool
+	parse      lineParser // parser of the input format
+	skipHeader bool       // drop the first line of every file
+	// fingerprint of the parsing config, cache files made with another are refused
+	fingerprint uint64
 }
 
 func (b *DataLoader) Init(path string) error {
+	return b.InitConfig(conf.ParseConf(path))
+}
+
+// InitConfig sets up the loader from a parsed config
+func (b *DataLoader) InitConfig(config *conf.AllConfig) error {
 	b.featureMap = make(map[uint16]bool)
-	conf := conf.ParseConf(path)
-	b.config = conf
-	b.isSigned = conf.IsFeatureSigned
-	for _, x := range conf.FeatureList {
+	b.numeric = make(map[uint16]bool)
+	b.buckets = make(map[uint16]uint64)
+	b.transforms = make(map[uint16]*slotTransform)
+	b.pooling = make(map[uint16]*bagPooling)
+	b.config = config
+	b.isSigned = config.IsFeatureSigned
+	b.check = newInputCheck(config.ValidationConfig)
+	for _, x := range config.FeatureList {
 		b.featureMap[uint16(x.SlotId)] = true
+		if x.Numeric || len(x.Transform) > 0 {
+			b.numeric[uint16(x.SlotId)] = true
+		}
+		if n := conf.HashBuckets(config, x); n > 0 {
+			b.buckets[uint16(x.SlotId)] = n
+		}
+		if len(x.Transform) > 0 {
+			t, err := newSlotTransform(x)
+			if err != nil {
+				return err
+			}
+			b.transforms[uint16(x.SlotId)] = t
+		}
+		p, err := newBagPooling(x)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			b.pooling[uint16(x.SlotId)] = p
+		}
 	}
-	return nil
+	if err := b.initCrosses(config); err != nil {
+		return err
+	}
+	b.fingerprint = cacheFingerprint(config, b.transforms)
+	return b.initFormat(config.GetInputConfig())
+}
+
+// KeepAllSlots makes the loader keep the features of slots out of the feature list, which are
+// dropped otherwise, e.g. to profile the input
+func (b *DataLoader) KeepAllSlots() {
+	b.allSlots = true
 }
 
-func (b *DataLoader) readline(l string) *base.Instance {
+func (b *DataLoader) readline(l string) (*base.Instance, error) {
 	z := new(base.Instance)
 	row := strings.SplitN(strings.TrimSuffix(l, "\n"), "\t", 2)
 	if len(row) < 2 {
-		glog.Errorf("line %s, format error: label not found", l)
-		return nil
+		return nil, inputErrorf(ErrFormat, "label not found")
 	}
 	labelStr, feaListStr := row[0], row[1]
-	label, err := strconv.Atoi(labelStr)
-	if err != nil {
-		glog.Errorf("parse label error: line=%s, label=%s, error=%v", l, labelStr, err)
-		return nil
+	// multi-task lines carry one label per task: 1,0\tslot:fea ...
+	labelRow := strings.Split(labelStr, ",")
+	labels := make([]float32, len(labelRow))
+	for i, s := range labelRow {
+		label, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, inputErrorf(ErrLabel, "parse label %s error: %v", labelStr, err)
+		}
+		labels[i] = float32(label)
 	}
-	z.Label = label
+	setLabels(z, labels)
+	var errs []error
 	feaRow := strings.Split(feaListStr, " ")
 	for _, str := range feaRow {
-		//slotStr, feaStr, found := strings.Cut(str, ":")
-		//if !found {
-		//	glog.Errorf("feature field %s, format error, splitter not found", str)
-		//	continue
-		//}
 		row := strings.SplitN(str, ":", 2)
 		if len(row) < 2 {
-			glog.Errorf("feature field %s, format error, splitter not found", str)
+			errs = append(errs, inputErrorf(ErrFeature, "feature field %s, splitter not found", str))
 			continue
 		}
 		slotStr, feaStr := row[0], row[1]
-		slot, err := strconv.ParseUint(slotStr, 10, 64)
+		slot, err := strconv.ParseUint(slotStr, 10, 16)
 		if err != nil {
-			glog.Errorf("parse feature slot=%s error: %v", slotStr, err)
+			errs = append(errs, inputErrorf(ErrFeature, "parse feature slot=%s error: %v", slotStr, err))
 			continue
 		}
-		if ok := b.featureMap[uint16(slot)]; !ok {
-			continue
+		if err := b.addFeature(z, uint16(slot), feaStr); err != nil {
+			errs = append(errs, err)
 		}
-		fea := uint64(0)
-		text := ""
-		if b.isSigned {
-			fea, err = strconv.ParseUint(feaStr, 10, 64)
-			if err != nil {
-				glog.Errorf("parse feature sign=%s error: %v", feaStr, err)
-				continue
-			}
-		} else {
-			text = base.DeepCopyString(feaStr)
+	}
+	return z, errors.Join(errs...)
+}
+
+func setLabels(z *base.Instance, labels []float32) {
+	z.Label = labels[0]
+	if len(labels) > 1 {
+		z.Labels = labels
+	}
+}
+
+// addFeature appends feature feaStr of slot to z, slots out of the feature list are dropped.
+// Features of numeric slots may carry a value, fea:value, and those of slots with transform are the value
+// itself. A ':' in a feature of another slot is part of its text.
+// A feature that can not be parsed is dropped, or missing in a bucketed slot, and returned as an error.
+func (b *DataLoader) addFeature(z *base.Instance, slot uint16, feaStr string) (bad error) {
+	if ok := b.featureMap[slot]; !ok && !b.allSlots {
+		return nil
+	}
+	value, valued := 0.0, false
+	if i := strings.LastIndexByte(feaStr, ':'); i >= 0 && b.numeric[slot] {
+		if v, err := parseValue(feaStr[i+1:]); err == nil {
+			feaStr, value, valued = feaStr[:i], v, true
 		}
-		feature := base.Feature{Slot: uint16(slot), Fea: fea, Text: text}
-		if !b.isSigned {
-			feature.Encode()
+	}
+	encode := !b.isSigned
+	if t, ok := b.transforms[slot]; ok {
+		// transformed features are keyed by their text, signed or not
+		encode = true
+		if valued {
+			feaStr, value = t.apply(feaStr, value)
+		} else if v, err := parseValue(feaStr); err == nil {
+			feaStr, value = t.apply("", v)
+			valued = true
+		} else {
+			if feaStr != "" {
+				bad = inputErrorf(ErrValue, "parse value of numeric slot %d=%s error: %v", slot, feaStr, err)
+			}
+			if feaStr, ok = t.missing(""); !ok {
+				return bad
+			}
 		}
-		if int(slot) == *uidSlot {
-			z.UserId = feature.Fea
-			z.UserIdStr = feature.Text
+	}
+	if valued && value == 0 {
+		return nil
+	}
+	fea := uint64(0)
+	text := ""
+	if !encode {
+		var err error
+		fea, err = strconv.ParseUint(feaStr, 10, 64)
+		if err != nil {
+			return inputErrorf(ErrSign, "parse feature sign=%s error: %v", feaStr, err)
 		}
-		if int(slot) == *fidSlot {
-			z.ItemId = feature.Fea
-			z.ItemIdStr = feature.Text
+	} else {
+		text = base.DeepCopyString(feaStr)
+	}
+	feature := base.Feature{Slot: slot, Fea: fea, Text: text}
+	if valued {
+		feature.Value = float32(value)
+	}
+	if encode {
+		feature.Encode()
+	}
+	if int(slot) == *uidSlot {
+		z.UserId = feature.Fea
+		z.UserIdStr = feature.Text
+	}
+	if int(slot) == *fidSlot {
+		z.ItemId = feature.Fea
+		z.ItemIdStr = feature.Text
+	}
+	// user and item ids keep the unbounded key
+	if n, ok := b.buckets[slot]; ok {
+		feature.Bucket(n)
+	}
+	z.Feas = append(z.Feas, &feature)
+	return bad
+}
+
+// FeatureKey is the key of the feature text of slot in an instance: signed, transformed, bucketed or
+// crossed as when a line is read. The text of a crossed slot is the texts of its sources joined by '|'.
+func (b *DataLoader) FeatureKey(slot uint16, text string) (uint64, error) {
+	for _, c := range b.crosses {
+		if c.slot == slot {
+			return b.crossKey(c, text)
 		}
-		z.Feas = append(z.Feas, &feature)
 	}
-	//if !b.isSigned {
-	//	for i := range z.Feas {
-	//		z.Feas[i].Encode()
-	//	}
-	//}
-	return z
+	if !b.featureMap[slot] || b.crossOnly[slot] {
+		return 0, fmt.Errorf("slot %d is not in the feature list", slot)
+	}
+	z := new(base.Instance)
+	if err := b.addFeature(z, slot, text); err != nil {
+		return 0, err
+	}
+	if len(z.Feas) == 0 {
+		return 0, fmt.Errorf("feature %d:%s is dropped", slot, text)
+	}
+	return z.Feas[0].Fea, nil
+}
+
+// parseValue parses the value of a numeric feature, infinities and nan are refused
+func parseValue(s string) (float64, error) {
+	v, err := strconv.ParseFloat(s, 32)
+	if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+		err = fmt.Errorf("value %s is not finite", s)
+	}
+	return v, err
 }
 
 func (b *DataLoader) ReadFile(path string) (<-chan []string, error) {
-	f, err := os.Open(path)
+	if b.NeedQuantiles() && !b.fittingQuantiles() {
+		return nil, fmt.Errorf("quantile boundaries are neither fitted nor loaded")
+	}
+	if b.check == nil {
+		b.check = newInputCheck(nil)
+	}
+	if err := b.check.failed.Load(); err != nil {
+		return nil, err.(error)
+	}
+	f, err := openInput(path)
 	if err != nil {
 		return nil, err
 	}
 	if b.readStatus {
+		f.Close()
 		return nil, fmt.Errorf("some other place is reading files %s", "")
 	}
+	r := bufio.NewReader(f)
+	cache, err := readCacheHeader(r, b.fingerprint)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
 	b.readMu.Lock()
 	b.readStatus = true
 	b.dataChan = make(chan []string, 50)
 	go func() {
-		count := b.readFile(f)
+		var count int
+		if cache {
+			count = b.readCache(r)
+		} else {
+			count = b.readFile(r)
+		}
 		close(b.dataChan)
 		f.Close()
 		b.readStatus = false
@@ -139,14 +291,25 @@ func (b *DataLoader) ReadFile(path string) (<-chan []string, error) {
 	return b.dataChan, nil
 }
 
-func (b *DataLoader) readFile(f *os.File) int {
-	r := bufio.NewReader(f)
+func (b *DataLoader) readFile(r *bufio.Reader) int {
 	data := make([]string, 0, LoaderBuffer)
 	count := 0
 	i := 0
+	header := b.skipHeader
 	for {
 		l, e := r.ReadString('\n')
+		if header {
+			header = false
+			if e == nil {
+				continue
+			}
+			l = ""
+		}
 		if e != nil {
+			if e != io.EOF {
+				glog.Errorf("read file error after %d lines: %v", count, e)
+				b.readError(fmt.Errorf("read file error after %d lines: %v", count, e))
+			}
 			if e == io.EOF && len(l) > 2 {
 				data = append(data, l)
 			}
@@ -154,6 +317,9 @@ func (b *DataLoader) readFile(f *os.File) int {
 			break
 		}
 		if count == LoaderBuffer {
+			if b.check.stopped() {
+				break
+			}
 			i++
 			b.dataChan <- data
 			count = 0
@@ -166,11 +332,27 @@ func (b *DataLoader) readFile(f *os.File) int {
 }
 
 func (b *DataLoader) ParseIns(data []string) []*base.Instance {
+	if b.check.stopped() {
+		return nil
+	}
 	n := len(data)
+	if n == 1 && strings.HasPrefix(data[0], cacheChunk) {
+		return b.parseCache(data[0])
+	}
+	// the lines of the pass fitting quantiles are counted when they are read again
+	count := !b.fittingQuantiles()
 	inslist := make([]*base.Instance, 0, n)
 	for i := 0; i < n; i++ {
-		ins := b.readline(data[i])
+		ins, err := b.parse(data[i])
+		if count {
+			b.check.line(data[i], err)
+		}
+		if err != nil && b.check.config.Strict {
+			ins = nil
+		}
 		if ins != nil {
+			b.addCrosses(ins)
+			b.poolBags(ins)
 			inslist = append(inslist, ins)
 		}
 	}
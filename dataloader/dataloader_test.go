@@ -1,6 +1,11 @@
 package dataloader
 
 import (
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 
 	"linearmodel/base"
@@ -52,3 +57,373 @@ func TestDataLoaderRead(t *testing.T) {
 		t.Error("read string errror")
 	}
 }
+
+func TestDataLoaderHashBuckets(t *testing.T) {
+	dataloader := DataLoader{}
+	dataloader.Init("../test/test.conf")
+	dataloader.buckets[102] = 10
+	ins, _ := dataloader.readline("1\t101:118 102:31163499\n")
+	if ins == nil || len(ins.Feas) != 2 {
+		t.Fatal("parse instance error")
+	}
+	fea := base.Feature{Slot: 101, Text: "118"}
+	fea.Encode()
+	if ins.Feas[0].Fea != fea.Fea {
+		t.Error("slot without buckets should keep its key")
+	}
+	item := base.Feature{Slot: 102, Text: "31163499"}
+	item.Encode()
+	if ins.ItemId != item.Fea {
+		t.Error("item id should keep the unbounded key")
+	}
+	item.Bucket(10)
+	if ins.Feas[1].Fea != item.Fea || item.Fea < 102*base.KMAXSIGN || item.Fea >= 102*base.KMAXSIGN+10 {
+		t.Errorf("hashed key %d", ins.Feas[1].Fea)
+	}
+}
+
+func TestDataLoaderMultiLabel(t *testing.T) {
+	dataloader := DataLoader{}
+	dataloader.Init("../test/test.conf")
+	ins, _ := dataloader.readline("1,0\t101:118 102:31163499\n")
+	if ins == nil || ins.Label != 1 || len(ins.Labels) != 2 || ins.Labels[1] != 0 {
+		t.Error("parse multi task label error")
+	}
+	ins, _ = dataloader.readline("0.5\t101:118\n")
+	if ins == nil || ins.Label != 0.5 || ins.Labels != nil {
+		t.Error("parse float label error")
+	}
+	if ins, _ := dataloader.readline("1,x\t101:118\n"); ins != nil {
+		t.Error("bad label should be skipped")
+	}
+}
+
+func _format_loader(t *testing.T, input *conf.InputConfig, slots ...uint64) *DataLoader {
+	config := &conf.AllConfig{InputConfig: input}
+	for _, slot := range slots {
+		config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: slot})
+	}
+	dataloader := &DataLoader{}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	return dataloader
+}
+
+func _texts(ins *base.Instance) []string {
+	var texts []string
+	for _, x := range ins.Feas {
+		texts = append(texts, fmt.Sprintf("%d:%s", x.Slot, x.Text))
+	}
+	return texts
+}
+
+func TestDataLoaderCSV(t *testing.T) {
+	columns := []*conf.ColumnConfig{{Name: "click", Label: true}, {Name: "uid", SlotId: 101},
+		{Name: "tags", SlotId: 102, Split: "|"}, {Name: "comment"}}
+	dataloader := _format_loader(t, &conf.InputConfig{Format: "csv", Columns: columns}, 101, 102)
+	ins := dataloader.ParseIns([]string{"1,118,\"a|b\",\"x, y\"\r\n", "0,,c,\n", "x,1,2,3\n", "1,2\n"})
+	if len(ins) != 2 {
+		t.Fatalf("parse %d instances, want 2", len(ins))
+	}
+	if ins[0].Label != 1 || !reflect.DeepEqual(_texts(ins[0]), []string{"101:118", "102:a", "102:b"}) ||
+		ins[0].UserIdStr != "118" {
+		t.Errorf("first instance %v %v", ins[0].Label, _texts(ins[0]))
+	}
+	if ins[1].Label != 0 || !reflect.DeepEqual(_texts(ins[1]), []string{"102:c"}) {
+		t.Errorf("empty cell should be missing: %v", _texts(ins[1]))
+	}
+	ins = dataloader.ParseIns([]string{"1,a\"b,c,\n", "1,2,\"x\n", "y\",z,\n"})
+	if len(ins) != 1 || !reflect.DeepEqual(_texts(ins[0]), []string{"101:a\"b", "102:c"}) {
+		t.Error("bare quotes should be kept and a quoted newline rejected")
+	}
+
+	dataloader = _format_loader(t, &conf.InputConfig{Format: "tsv", Columns: columns[:3]}, 101)
+	ins = dataloader.ParseIns([]string{"0\t118\ta|b\n"})
+	if len(ins) != 1 || !reflect.DeepEqual(_texts(ins[0]), []string{"101:118"}) {
+		t.Error("tsv should keep the slots of the feature list only")
+	}
+}
+
+func TestDataLoaderJSON(t *testing.T) {
+	columns := []*conf.ColumnConfig{{Name: "click", Label: true}, {Name: "buy", Label: true},
+		{Name: "uid", SlotId: 101}, {Name: "tags", SlotId: 102}, {Name: "age", SlotId: 103}}
+	dataloader := _format_loader(t, &conf.InputConfig{Format: "json", Columns: columns}, 101, 102, 103)
+	ins := dataloader.ParseIns([]string{
+		`{"click": true, "buy": 0, "uid": 118, "tags": ["a", "b"], "age": null}` + "\n",
+		`{"click": "1", "buy": 1, "uid": "12345678901234567890"}`,
+		`{"buy": 1, "uid": 1}`,
+		`{"click": 1,`,
+	})
+	if len(ins) != 2 {
+		t.Fatalf("parse %d instances, want 2", len(ins))
+	}
+	if !reflect.DeepEqual(ins[0].Labels, []float32{1, 0}) ||
+		!reflect.DeepEqual(_texts(ins[0]), []string{"101:118", "102:a", "102:b"}) {
+		t.Errorf("first instance %v %v", ins[0].Labels, _texts(ins[0]))
+	}
+	if !reflect.DeepEqual(ins[1].Labels, []float32{1, 1}) ||
+		!reflect.DeepEqual(_texts(ins[1]), []string{"101:12345678901234567890"}) {
+		t.Errorf("numbers should keep their text: %v", _texts(ins[1]))
+	}
+}
+
+func TestDataLoaderCriteo(t *testing.T) {
+	var slots []uint64
+	for i := uint64(0); i < criteoColumns; i++ {
+		slots = append(slots, criteoFirstSlot+i)
+	}
+	criteo := _format_loader(t, &conf.InputConfig{Format: "criteo"}, slots...)
+	old := _format_loader(t, nil, slots...)
+	raw := "1\t5\t\t3" + strings.Repeat("\t", 10) + "\t68fd1e64" + strings.Repeat("\t80e26c9b", 25) + "\n"
+	// the line benchmark/process_data.py made of it
+	row := strings.Split(strings.TrimSuffix(raw, "\n"), "\t")
+	line := row[0] + "\t"
+	for i, x := range row[1:] {
+		if i > 0 {
+			line += " "
+		}
+		line += fmt.Sprintf("%d:%s", 101+i, x)
+	}
+	ins := criteo.ParseIns([]string{raw, "1\t2\n"})
+	want := old.ParseIns([]string{line + "\n"})
+	if len(ins) != 1 || len(ins[0].Feas) != criteoColumns {
+		t.Fatal("parse criteo line error")
+	}
+	if !reflect.DeepEqual(ins[0], want[0]) {
+		t.Errorf("criteo line %v, converted line %v", _texts(ins[0]), _texts(want[0]))
+	}
+}
+
+func TestDataLoaderHeader(t *testing.T) {
+	f, err := os.CreateTemp("", "header*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("click,uid\n1,118\n0,119")
+	f.Close()
+	columns := []*conf.ColumnConfig{{Name: "click", Label: true}, {Name: "uid", SlotId: 101}}
+	dataloader := _format_loader(t, &conf.InputConfig{Format: "csv", Columns: columns, Header: true}, 101)
+	var ins []*base.Instance
+	for ins = range dataloader.ParallelIterator(f.Name(), 1) {
+	}
+	if len(ins) != 2 || ins[0].UserIdStr != "118" || ins[1].UserIdStr != "119" {
+		t.Errorf("header should be skipped, got %d instances", len(ins))
+	}
+}
+
+func TestDataLoaderFormatError(t *testing.T) {
+	inputs := []*conf.InputConfig{
+		{Format: "xml"},
+		{Format: "csv", Columns: []*conf.ColumnConfig{{SlotId: 101}}},
+		{Format: "csv", Columns: []*conf.ColumnConfig{{Label: true, SlotId: 101}}},
+		{Format: "json", Columns: []*conf.ColumnConfig{{Label: true}}},
+		{Format: "json", Columns: []*conf.ColumnConfig{{Name: "click", Label: true}}, Header: true},
+		{Format: "criteo", Header: true},
+		{Header: true},
+	}
+	for _, input := range inputs {
+		dataloader := DataLoader{}
+		if err := dataloader.InitConfig(&conf.AllConfig{InputConfig: input}); err == nil {
+			t.Errorf("input %v should be rejected", input)
+		}
+	}
+}
+
+func TestDataLoaderNumeric(t *testing.T) {
+	config := &conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 101},
+		{SlotId: 102, Numeric: true},
+		{SlotId: 103, Transform: []*conf.TransformConfig{{Type: "log"},
+			{Type: "bucket", Boundaries: []float32{1, 2, 3}}}},
+		{SlotId: 104, Transform: []*conf.TransformConfig{{Type: "standardize", Mean: 1, Std: 2}}},
+		{SlotId: 105, Transform: []*conf.TransformConfig{{Type: "log"}}},
+	}}
+	dataloader := &DataLoader{}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	ins, _ := dataloader.readline("1\t101:a 102:age:35 102:b:0 103:9 103: 104:3 104:1 105:abc 105: 105:-1\n")
+	want := []struct {
+		slot  uint16
+		text  string
+		value float32
+	}{
+		{101, "a", 0},
+		{102, "age", 35},
+		{103, "#2", 1},
+		{103, "#missing", 0},
+		{104, "", 1},
+		{105, "", float32(-math.Log(2))},
+	}
+	if len(ins.Feas) != len(want) {
+		t.Fatalf("features %v, want %v", _texts(ins), want)
+	}
+	for i, x := range want {
+		fea := ins.Feas[i]
+		check := base.Feature{Slot: x.slot, Text: x.text}
+		check.Encode()
+		if fea.Slot != x.slot || fea.Text != x.text || base.NEQFloat32(fea.Value, x.value) || fea.Fea != check.Fea {
+			t.Errorf("feature %d: %+v, want %+v", i, *fea, x)
+		}
+	}
+
+	// a ':' in a feature of a slot that is not numeric is part of its text
+	ins, _ = dataloader.readline("1\t101:12:30 101:a:0 101:b:2.5\n")
+	if texts := _texts(ins); !reflect.DeepEqual(texts, []string{"101:12:30", "101:a:0", "101:b:2.5"}) {
+		t.Errorf("text features %v", texts)
+	}
+	for _, fea := range ins.Feas {
+		if fea.Val() != 1 {
+			t.Errorf("text feature %d:%s of value %v", fea.Slot, fea.Text, fea.Value)
+		}
+	}
+
+	bad := [][]*conf.TransformConfig{
+		{{Type: "sqrt"}},
+		{{Type: "standardize"}},
+		{{Type: "bucket"}},
+		{{Type: "bucket", Boundaries: []float32{2, 1}}},
+		{{Type: "bucket", Boundaries: []float32{1}}, {Type: "log"}},
+	}
+	for _, transform := range bad {
+		config := &conf.AllConfig{FeatureList: []*conf.FeatureConfig{{SlotId: 101, Transform: transform}}}
+		if err := dataloader.InitConfig(config); err == nil {
+			t.Errorf("transform %v should be rejected", transform)
+		}
+	}
+}
+
+func TestDataLoaderPooling(t *testing.T) {
+	config := &conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 101},
+		{SlotId: 102, Pooling: "mean", Numeric: true},
+		{SlotId: 103, Pooling: "sqrtn", MaxBag: 4},
+		{SlotId: 104, MaxBag: 2},
+	}}
+	dataloader := &DataLoader{}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	ins := dataloader.ParseIns([]string{
+		"1\t101:u 101:v 102:a 102:b:3 102:c:0 103:a 103:b 103:c 103:d 103:e 104:a 104:b 104:c 102:d\n",
+		"0\t102:a 103:a\n",
+	})
+	want := []struct {
+		text  string
+		value float32
+	}{
+		{"101:u", 0}, {"101:v", 0},
+		{"102:a", 1.0 / 3}, {"102:b", 1}, // c of value 0 is no item of the bag
+		{"103:a", 0.5}, {"103:b", 0.5}, {"103:c", 0.5}, {"103:d", 0.5},
+		{"104:a", 0}, {"104:b", 0},
+		{"102:d", 1.0 / 3},
+	}
+	if texts := _texts(ins[0]); len(texts) != len(want) {
+		t.Fatalf("features %v", texts)
+	}
+	for i, x := range want {
+		fea := ins[0].Feas[i]
+		if text := fmt.Sprintf("%d:%s", fea.Slot, fea.Text); text != x.text || base.NEQFloat32(fea.Value, x.value) {
+			t.Errorf("feature %d: %s of value %v, want %s of %v", i, text, fea.Value, x.text, x.value)
+		}
+	}
+	// a bag of one is unchanged
+	for _, fea := range ins[1].Feas {
+		if fea.Val() != 1 {
+			t.Errorf("feature %d:%s of value %v", fea.Slot, fea.Text, fea.Value)
+		}
+	}
+
+	config.FeatureList[1].Pooling = "max"
+	if err := dataloader.InitConfig(config); err == nil {
+		t.Error("unknown pooling should be rejected")
+	}
+}
+
+func TestDataLoaderCross(t *testing.T) {
+	buckets := uint64(100)
+	config := &conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 101},
+		{SlotId: 102, Numeric: true},
+		{SlotId: 201, CrossOf: []uint64{101, 102}},
+		{SlotId: 202, CrossOf: []uint64{101, 103}, HashBuckets: &buckets},
+		{SlotId: 203, CrossOf: []uint64{102, 104}},
+	}}
+	dataloader := &DataLoader{}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	ins := dataloader.ParseIns([]string{"1\t101:u 102:a 102:b:2 103:x 105:z\n"})[0]
+	want := []string{"101:u", "102:a", "102:b", "201:u|a", "201:u|b", "202:u|x"}
+	if texts := _texts(ins); !reflect.DeepEqual(texts, want) {
+		t.Fatalf("features %v, want %v", texts, want)
+	}
+	// the key hashes the keys of the crossed features, in the slot of the cross
+	u, a := base.Feature{Slot: 101, Text: "u"}, base.Feature{Slot: 102, Text: "a"}
+	u.Encode()
+	a.Encode()
+	check := base.Feature{Slot: 201}
+	check.Cross([]*base.Feature{&u, &a})
+	if ins.Feas[3].Fea != check.Fea || ins.Feas[3].ExtractSlot() != 201 || ins.Feas[3].Val() != 1 {
+		t.Errorf("cross %+v, want %+v", *ins.Feas[3], check)
+	}
+	if x := ins.Feas[4]; x.Value != 2 {
+		t.Errorf("cross of value 2: %+v", *x)
+	}
+	if x := ins.Feas[5]; x.Fea%base.KMAXSIGN >= 100 || x.ExtractSlot() != 202 {
+		t.Errorf("bucketed cross: %+v", *x)
+	}
+
+	// source bags are cut to max_bag before crossing, and a cross stops at its own max_bag
+	config = &conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 101, MaxBag: 2},
+		{SlotId: 102},
+		{SlotId: 201, CrossOf: []uint64{101, 102}, MaxBag: 3},
+		{SlotId: 202, CrossOf: []uint64{101, 102}},
+	}}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	ins = dataloader.ParseIns([]string{"1\t101:u 101:v 101:w 102:a 102:b\n"})[0]
+	want = []string{"101:u", "101:v", "102:a", "102:b", "201:u|a", "201:u|b", "201:v|a",
+		"202:u|a", "202:u|b", "202:v|a", "202:v|b"}
+	if texts := _texts(ins); !reflect.DeepEqual(texts, want) {
+		t.Errorf("features %v, want %v", texts, want)
+	}
+	// a slot without max_bag makes defaultMaxCross crosses at most
+	config = &conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 101},
+		{SlotId: 102},
+		{SlotId: 201, CrossOf: []uint64{101, 102}},
+	}}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	line := "1\t"
+	for i := 0; i < 40; i++ {
+		line += fmt.Sprintf("101:u%d 102:a%d ", i, i)
+	}
+	ins = dataloader.ParseIns([]string{line[:len(line)-1] + "\n"})[0]
+	if n := len(ins.Feas) - 80; n != defaultMaxCross {
+		t.Errorf("%d crosses of 40x40 features, want %d", n, defaultMaxCross)
+	}
+
+	bad := []*conf.FeatureConfig{
+		{SlotId: 201, CrossOf: []uint64{101}},
+		{SlotId: 201, CrossOf: []uint64{101, 102}, Transform: []*conf.TransformConfig{{Type: "log"}}},
+	}
+	for _, x := range bad {
+		if err := dataloader.InitConfig(&conf.AllConfig{FeatureList: []*conf.FeatureConfig{x}}); err == nil {
+			t.Errorf("cross %v should be rejected", x)
+		}
+	}
+	nested := &conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 201, CrossOf: []uint64{101, 102}},
+		{SlotId: 202, CrossOf: []uint64{201, 103}},
+	}}
+	if err := dataloader.InitConfig(nested); err == nil {
+		t.Error("crosses of crosses should be rejected")
+	}
+}
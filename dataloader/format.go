@@ -0,0 +1,224 @@
+package dataloader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// lineParser turns one input line into an instance. A nil instance drops the line, an error with
+// an instance tells the features that were dropped.
+type lineParser func(l string) (*base.Instance, error)
+
+const (
+	criteoColumns   = 39 // 13 integer and 26 categorical columns after the label
+	criteoFirstSlot = 101
+)
+
+func (b *DataLoader) initFormat(input *conf.InputConfig) error {
+	format := input.GetFormat()
+	columns := input.GetColumns()
+	b.skipHeader = input.GetHeader()
+	if b.skipHeader && format != "csv" && format != "tsv" {
+		return fmt.Errorf("header is for csv and tsv input, not %q", format)
+	}
+	switch format {
+	case "", "slot":
+		b.parse = b.readline
+		return nil
+	case "criteo":
+		b.parse = b.readCriteo
+		return nil
+	case "csv":
+		b.parse = b.readCSV
+	case "tsv":
+		b.parse = b.readTSV
+	case "json":
+		b.parse = b.readJSON
+	default:
+		return fmt.Errorf("unknown input format: %s", format)
+	}
+	labels := 0
+	for i, c := range columns {
+		if c.Label && c.SlotId != 0 {
+			return fmt.Errorf("column %d (%s) is both a label and slot %d", i, c.Name, c.SlotId)
+		}
+		if c.Label {
+			labels++
+		}
+		if format == "json" && c.Name == "" {
+			return fmt.Errorf("column %d of json input has no name", i)
+		}
+	}
+	if labels == 0 {
+		return fmt.Errorf("%s input needs a label column", format)
+	}
+	return nil
+}
+
+func trimLine(l string) string {
+	return strings.TrimRight(l, "\r\n")
+}
+
+// readCSV parses one line as a csv record. Bare quotes in unquoted cells are kept, but a quoted cell must end on
+// its line: records are split on newlines before parsing, so a quoted newline is a format error, not a join.
+func (b *DataLoader) readCSV(l string) (*base.Instance, error) {
+	row, err := parseCSV(trimLine(l), false)
+	var perr *csv.ParseError
+	if errors.As(err, &perr) && perr.Err == csv.ErrBareQuote {
+		row, err = parseCSV(trimLine(l), true)
+	}
+	if err != nil {
+		return nil, inputErrorf(ErrFormat, "csv format error: %v", err)
+	}
+	return b.readColumns(row)
+}
+
+func parseCSV(l string, lazy bool) ([]string, error) {
+	r := csv.NewReader(strings.NewReader(l))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = lazy
+	return r.Read()
+}
+
+func (b *DataLoader) readTSV(l string) (*base.Instance, error) {
+	return b.readColumns(strings.Split(trimLine(l), "\t"))
+}
+
+// readColumns builds an instance from the cells of a csv or tsv line, by column position
+func (b *DataLoader) readColumns(row []string) (*base.Instance, error) {
+	columns := b.config.GetInputConfig().GetColumns()
+	if len(row) < len(columns) {
+		return nil, inputErrorf(ErrFormat, "%d columns, want %d", len(row), len(columns))
+	}
+	z := new(base.Instance)
+	var labels []float32
+	var errs []error
+	for i, c := range columns {
+		cell := row[i]
+		if c.Label {
+			label, err := strconv.ParseFloat(strings.TrimSpace(cell), 32)
+			if err != nil {
+				return nil, inputErrorf(ErrLabel, "parse label %s error: %v", cell, err)
+			}
+			labels = append(labels, float32(label))
+			continue
+		}
+		if c.SlotId != 0 {
+			errs = append(errs, b.addCell(z, c, cell))
+		}
+	}
+	setLabels(z, labels)
+	return z, errors.Join(errs...)
+}
+
+// addCell adds the features of a cell, empty cells and values are missing features
+func (b *DataLoader) addCell(z *base.Instance, c *conf.ColumnConfig, cell string) error {
+	values := []string{cell}
+	if c.Split != "" {
+		values = strings.Split(cell, c.Split)
+	}
+	var errs []error
+	for _, v := range values {
+		if v != "" {
+			errs = append(errs, b.addFeature(z, uint16(c.SlotId), v))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *DataLoader) readJSON(l string) (*base.Instance, error) {
+	d := json.NewDecoder(strings.NewReader(l))
+	d.UseNumber()
+	var fields map[string]interface{}
+	if err := d.Decode(&fields); err != nil {
+		return nil, inputErrorf(ErrFormat, "json format error: %v", err)
+	}
+	z := new(base.Instance)
+	var labels []float32
+	var errs []error
+	for _, c := range b.config.GetInputConfig().GetColumns() {
+		v, ok := fields[c.Name]
+		if c.Label {
+			label, err := jsonLabel(v)
+			if !ok {
+				return nil, inputErrorf(ErrLabel, "label field %s not found", c.Name)
+			}
+			if err != nil {
+				return nil, inputErrorf(ErrLabel, "parse label field %s error: %v", c.Name, err)
+			}
+			labels = append(labels, label)
+			continue
+		}
+		if !ok || c.SlotId == 0 {
+			continue
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			values = []interface{}{v}
+		}
+		for _, x := range values {
+			if s, ok := jsonString(x); ok {
+				errs = append(errs, b.addCell(z, c, s))
+			}
+		}
+	}
+	setLabels(z, labels)
+	return z, errors.Join(errs...)
+}
+
+func jsonLabel(v interface{}) (float32, error) {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	case json.Number:
+		f, err := x.Float64()
+		return float32(f), err
+	case string:
+		f, err := strconv.ParseFloat(x, 32)
+		return float32(f), err
+	}
+	return 0, fmt.Errorf("label of type %T", v)
+}
+
+// jsonString is the feature text of a scalar json value, null and objects have none
+func jsonString(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case json.Number:
+		return x.String(), true
+	case bool:
+		return strconv.FormatBool(x), true
+	}
+	return "", false
+}
+
+// readCriteo parses the raw criteo tsv: label, 13 integer and 26 categorical columns, mapped to
+// slots 101 to 139. Empty cells are kept as a feature of their own, like the slot format converted
+// by the old benchmark script, so that models trained on either input match.
+func (b *DataLoader) readCriteo(l string) (*base.Instance, error) {
+	row := strings.Split(trimLine(l), "\t")
+	if len(row) != criteoColumns+1 {
+		return nil, inputErrorf(ErrFormat, "criteo format error: %d columns, want %d", len(row), criteoColumns+1)
+	}
+	label, err := strconv.ParseFloat(row[0], 32)
+	if err != nil {
+		return nil, inputErrorf(ErrLabel, "parse label %s error: %v", row[0], err)
+	}
+	z := &base.Instance{Label: float32(label)}
+	var errs []error
+	for i, v := range row[1:] {
+		errs = append(errs, b.addFeature(z, uint16(criteoFirstSlot+i), v))
+	}
+	return z, errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+package dataloader
+
+import (
+	"fmt"
+	"math"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// bagPooling scales the features of a slot that a line holds several of, e.g. tags, so that a long
+// bag does not outweigh a slot of a single feature. The scaled values multiply both the weights and
+// the embeddings, mean pooling makes the bag the average of its features.
+type bagPooling struct {
+	mode   string
+	maxBag int
+}
+
+// newBagPooling returns nil for a slot summing bags of any length, the default
+func newBagPooling(x *conf.FeatureConfig) (*bagPooling, error) {
+	switch x.Pooling {
+	case "", "sum", "mean", "sqrtn":
+	default:
+		return nil, fmt.Errorf("slot %d: unknown pooling %s", x.SlotId, x.Pooling)
+	}
+	if (x.Pooling == "" || x.Pooling == "sum") && x.MaxBag == 0 {
+		return nil, nil
+	}
+	return &bagPooling{mode: x.Pooling, maxBag: int(x.MaxBag)}, nil
+}
+
+// truncateBags drops the features of a bag past its max length, it returns the length of the bags
+// of pooled slots
+func (b *DataLoader) truncateBags(z *base.Instance) map[uint16]int {
+	counts := make(map[uint16]int, len(b.pooling))
+	feas := z.Feas[:0]
+	for _, x := range z.Feas {
+		if p := b.pooling[x.Slot]; p != nil {
+			if p.maxBag > 0 && counts[x.Slot] >= p.maxBag {
+				continue
+			}
+			counts[x.Slot]++
+		}
+		feas = append(feas, x)
+	}
+	z.Feas = feas
+	return counts
+}
+
+// poolBags drops the features of a bag past its max length and scales the rest by 1/n for mean and
+// 1/sqrt(n) for sqrtn pooling, n the features left in the bag
+func (b *DataLoader) poolBags(z *base.Instance) {
+	if len(b.pooling) == 0 {
+		return
+	}
+	counts := b.truncateBags(z)
+	for _, x := range z.Feas {
+		p := b.pooling[x.Slot]
+		if p == nil || counts[x.Slot] == 1 {
+			continue
+		}
+		switch p.mode {
+		case "mean":
+			x.Value = x.Val() / float32(counts[x.Slot])
+		case "sqrtn":
+			x.Value = x.Val() / float32(math.Sqrt(float64(counts[x.Slot])))
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package dataloader
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// kllK sets the accuracy of the sketch, the rank error is about 1.7/kllK
+const kllK = 400
+
+// kllSketch is a KLL quantile sketch: level h keeps values of weight 2^h, and a full level is
+// sorted and every other value moves up. Which half moves alternates per level, so that the
+// sketch of the same values in the same order is the same.
+type kllSketch struct {
+	k      int
+	levels [][]float64
+	odd    []bool
+	n      int64
+}
+
+func newKLLSketch(k int) *kllSketch {
+	return &kllSketch{k: k}
+}
+
+// capacity of level h, the top level holds k values and lower levels shrink by 2/3
+func (s *kllSketch) capacity(h int) int {
+	c := int(math.Ceil(float64(s.k) * math.Pow(2.0/3.0, float64(len(s.levels)-1-h))))
+	if c < 2 {
+		return 2
+	}
+	return c
+}
+
+func (s *kllSketch) add(x float64) {
+	if len(s.levels) == 0 {
+		s.levels = append(s.levels, nil)
+		s.odd = append(s.odd, false)
+	}
+	s.levels[0] = append(s.levels[0], x)
+	s.n++
+	for h := 0; h < len(s.levels); h++ {
+		if len(s.levels[h]) < s.capacity(h) {
+			continue
+		}
+		if h == len(s.levels)-1 {
+			s.levels = append(s.levels, nil)
+			s.odd = append(s.odd, false)
+		}
+		level := s.levels[h]
+		sort.Float64s(level)
+		// an odd value out stays
+		keep := len(level) % 2
+		start := keep
+		if s.odd[h] {
+			start++
+		}
+		s.odd[h] = !s.odd[h]
+		for i := start; i < len(level); i += 2 {
+			s.levels[h+1] = append(s.levels[h+1], level[i])
+		}
+		s.levels[h] = level[:keep]
+	}
+}
+
+// quantiles returns the values at ranks qs, ascending in [0, 1]
+func (s *kllSketch) quantiles(qs []float64) []float64 {
+	type item struct {
+		x float64
+		w int64
+	}
+	var items []item
+	for h, level := range s.levels {
+		for _, x := range level {
+			items = append(items, item{x, 1 << uint(h)})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].x < items[j].x
+	})
+	total := int64(0)
+	for _, it := range items {
+		total += it.w
+	}
+	res := make([]float64, len(qs))
+	i, rank := 0, int64(0)
+	for j, q := range qs {
+		for i < len(items)-1 && float64(rank+items[i].w) <= q*float64(total) {
+			rank += items[i].w
+			i++
+		}
+		res[j] = items[i].x
+	}
+	return res
+}
+
+// boundaries cuts the values into buckets of about the same count, ties merge buckets
+func (s *kllSketch) boundaries(buckets int) []float64 {
+	qs := make([]float64, buckets-1)
+	for i := range qs {
+		qs[i] = float64(i+1) / float64(buckets)
+	}
+	var res []float64
+	for _, x := range s.quantiles(qs) {
+		if len(res) == 0 || x > res[len(res)-1] {
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+// NeedQuantiles tells whether some slots have quantile transforms whose boundaries are not set
+func (b *DataLoader) NeedQuantiles() bool {
+	for _, t := range b.transforms {
+		if t.quantile > 0 && t.bucket == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HasQuantiles tells whether some slots have quantile transforms
+func (b *DataLoader) HasQuantiles() bool {
+	for _, t := range b.transforms {
+		if t.quantile > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *DataLoader) fittingQuantiles() bool {
+	for _, t := range b.transforms {
+		if t.sketch != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// FitQuantiles sets the boundaries of quantile transforms from the values in paths
+func (b *DataLoader) FitQuantiles(paths []string, parallel int) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+	for _, path := range paths {
+		if IsStream(path) {
+			return fmt.Errorf("%s is a stream read once, quantiles can not be fitted on it", path)
+		}
+	}
+	for _, t := range b.transforms {
+		if t.quantile > 0 {
+			t.bucket = nil
+			t.sketch = newKLLSketch(kllK)
+		}
+	}
+	defer func() {
+		for _, t := range b.transforms {
+			t.sketch = nil
+		}
+	}()
+	for _, path := range paths {
+		dataChan, err := b.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		done := make(chan bool)
+		for i := 0; i < parallel; i++ {
+			go func() {
+				for data := range dataChan {
+					b.ParseIns(data)
+				}
+				done <- true
+			}()
+		}
+		for i := 0; i < parallel; i++ {
+			<-done
+		}
+	}
+	for slot, t := range b.transforms {
+		if t.sketch == nil {
+			continue
+		}
+		if t.sketch.n == 0 {
+			return fmt.Errorf("slot %d has no value to fit quantiles on, caches keep none", slot)
+		}
+		t.bucket = t.sketch.boundaries(t.quantile)
+		glog.Infof("slot %d: %d values, %d quantile boundaries %v", slot, t.sketch.n, len(t.bucket), t.bucket)
+	}
+	b.fingerprint = cacheFingerprint(b.config, b.transforms)
+	return nil
+}
+
+// SaveQuantiles writes the boundaries of quantile transforms, a line of slot\tb1,b2,... per slot
+func (b *DataLoader) SaveQuantiles(path string) error {
+	var slots []int
+	for slot, t := range b.transforms {
+		if t.quantile > 0 {
+			slots = append(slots, int(slot))
+		}
+	}
+	sort.Ints(slots)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	wr := bufio.NewWriter(f)
+	for _, slot := range slots {
+		bounds := make([]string, 0)
+		for _, x := range b.transforms[uint16(slot)].bucket {
+			bounds = append(bounds, strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		fmt.Fprintf(wr, "%d\t%s\n", slot, strings.Join(bounds, ","))
+	}
+	return wr.Flush()
+}
+
+// LoadQuantiles reads boundaries written by SaveQuantiles, every quantile slot must have a line
+func (b *DataLoader) LoadQuantiles(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	bounds := make(map[uint16][]float64)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		row := strings.Split(scanner.Text(), "\t")
+		if len(row) != 2 {
+			return fmt.Errorf("wrong quantile line in %s: %s", path, scanner.Text())
+		}
+		slot, err := strconv.ParseUint(row[0], 10, 16)
+		if err != nil {
+			return fmt.Errorf("wrong quantile slot in %s: %v", path, err)
+		}
+		var xs []float64
+		for _, s := range strings.Split(row[1], ",") {
+			if s == "" {
+				continue
+			}
+			x, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("wrong quantile of slot %d in %s: %v", slot, path, err)
+			}
+			xs = append(xs, x)
+		}
+		bounds[uint16(slot)] = xs
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for slot, t := range b.transforms {
+		if t.quantile == 0 {
+			continue
+		}
+		xs, ok := bounds[slot]
+		if !ok {
+			return fmt.Errorf("%s has no quantiles of slot %d", path, slot)
+		}
+		t.bucket = append(make([]float64, 0, len(xs)), xs...)
+	}
+	b.fingerprint = cacheFingerprint(b.config, b.transforms)
+	return nil
+}
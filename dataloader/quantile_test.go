@@ -0,0 +1,107 @@
+package dataloader
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"linearmodel/conf"
+)
+
+func TestKLLSketch_Quantiles(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	n := 200000
+	xs := make([]float64, n)
+	s := newKLLSketch(kllK)
+	for i := range xs {
+		xs[i] = r.ExpFloat64()
+		s.add(xs[i])
+	}
+	sort.Float64s(xs)
+	qs := []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99}
+	for i, x := range s.quantiles(qs) {
+		rank := float64(sort.SearchFloat64s(xs, x)) / float64(n)
+		if math.Abs(rank-qs[i]) > 0.01 {
+			t.Errorf("quantile %.2f is %.4f of rank %.4f", qs[i], x, rank)
+		}
+	}
+	if len(s.levels[0]) > kllK || s.n != int64(n) {
+		t.Errorf("sketch keeps %d values at level 0 of %d", len(s.levels[0]), s.n)
+	}
+	// ties merge buckets
+	s = newKLLSketch(kllK)
+	for i := 0; i < 1000; i++ {
+		s.add(float64(i % 2))
+	}
+	if b := s.boundaries(4); !reflect.DeepEqual(b, []float64{0, 1}) {
+		t.Errorf("boundaries of 0/1 values %v", b)
+	}
+}
+
+func TestDataLoader_FitQuantiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "train")
+	f, _ := os.Create(path)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(f, "%d\t101:u%d 103:%d\n", i%2, i%7, r.Intn(1000))
+	}
+	f.Close()
+	config := &conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 101},
+		{SlotId: 103, Transform: []*conf.TransformConfig{{Type: "quantile", Buckets: 4}}},
+	}}
+	dataloader := &DataLoader{}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dataloader.ReadFile(path); err == nil {
+		t.Fatal("reading before quantiles are fitted should fail")
+	}
+	before := dataloader.fingerprint
+	if err := dataloader.FitQuantiles([]string{path}, 2); err != nil {
+		t.Fatal(err)
+	}
+	bounds := dataloader.transforms[103].bucket
+	if len(bounds) != 3 {
+		t.Fatalf("boundaries %v, want 3", bounds)
+	}
+	for i, want := range []float64{250, 500, 750} {
+		if math.Abs(bounds[i]-want) > 20 {
+			t.Errorf("boundary %d is %f, want about %f", i, bounds[i], want)
+		}
+	}
+	if dataloader.fingerprint == before {
+		t.Error("fitted boundaries should change the cache fingerprint")
+	}
+	ins, _ := dataloader.readline("1\t101:u1 103:999 103:x\n")
+	if texts := _texts(ins); !reflect.DeepEqual(texts, []string{"101:u1", "103:#3", "103:#missing"}) {
+		t.Errorf("features %v", texts)
+	}
+
+	// saved boundaries give the same features
+	qpath := filepath.Join(dir, "model.quantiles")
+	if err := dataloader.SaveQuantiles(qpath); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &DataLoader{}
+	loaded.InitConfig(config)
+	if err := loaded.LoadQuantiles(qpath); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.transforms[103].bucket, bounds) || loaded.fingerprint != dataloader.fingerprint {
+		t.Errorf("loaded boundaries %v, want %v", loaded.transforms[103].bucket, bounds)
+	}
+	other := &DataLoader{}
+	other.InitConfig(&conf.AllConfig{FeatureList: []*conf.FeatureConfig{
+		{SlotId: 104, Transform: []*conf.TransformConfig{{Type: "quantile", Buckets: 4}}},
+	}})
+	if err := other.LoadQuantiles(qpath); err == nil {
+		t.Error("quantiles without slot 104 should be refused")
+	}
+}
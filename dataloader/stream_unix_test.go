@@ -0,0 +1,53 @@
+//go:build darwin || dragonfly || freebsd || linux || openbsd
+
+package dataloader
+
+import (
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestReadStream(t *testing.T) {
+	lines := _gen_lines(rand.New(rand.NewSource(4)), 10000)
+	data := _compress(t, codecGzip, gzip.DefaultCompression, lines, 1000)
+
+	// a named pipe is read as its writer goes, its codec told by the magic bytes
+	fifo := filepath.Join(t.TempDir(), "pipe")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		t.Skip(err)
+	}
+	if !IsStream(fifo) || IsStream(filepath.Dir(fifo)) {
+		t.Error("a named pipe should be a stream, a directory not")
+	}
+	go func() {
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		for i := 0; i < len(data); i += 4096 {
+			f.Write(data[i:minInt(i+4096, len(data))])
+		}
+		f.Close()
+	}()
+	_eq_lines(t, "fifo", _read_lines(t, fifo), lines)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() {
+		os.Stdin = stdin
+		r.Close()
+	}()
+	go func() {
+		w.Write(data)
+		w.Close()
+	}()
+	_eq_lines(t, "stdin", _read_lines(t, Stdin), lines)
+}
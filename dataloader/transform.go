@@ -0,0 +1,104 @@
+package dataloader
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"linearmodel/conf"
+)
+
+// slotTransform maps the values of a numeric slot, a bucket step makes them categorical again
+type slotTransform struct {
+	steps    []*conf.TransformConfig
+	bucket   []float64 // boundaries of the final bucket or quantile step, nil without one
+	quantile int       // buckets of a final quantile step, whose boundaries are fitted or loaded
+
+	mu     sync.Mutex
+	sketch *kllSketch // values seen while fitting quantiles
+}
+
+func newSlotTransform(x *conf.FeatureConfig) (*slotTransform, error) {
+	t := &slotTransform{}
+	for i, step := range x.Transform {
+		switch step.Type {
+		case "log":
+		case "standardize":
+			if step.Std <= 0 {
+				return nil, fmt.Errorf("slot %d: standardize needs a positive std", x.SlotId)
+			}
+		case "quantile":
+			if i != len(x.Transform)-1 {
+				return nil, fmt.Errorf("slot %d: quantile must be the last transform", x.SlotId)
+			}
+			if step.Buckets < 2 {
+				return nil, fmt.Errorf("slot %d: quantile needs at least 2 buckets", x.SlotId)
+			}
+			t.quantile = int(step.Buckets)
+			continue
+		case "bucket":
+			if i != len(x.Transform)-1 {
+				return nil, fmt.Errorf("slot %d: bucket must be the last transform", x.SlotId)
+			}
+			if len(step.Boundaries) == 0 {
+				return nil, fmt.Errorf("slot %d: bucket needs boundaries", x.SlotId)
+			}
+			for j, b := range step.Boundaries {
+				if j > 0 && b <= step.Boundaries[j-1] {
+					return nil, fmt.Errorf("slot %d: bucket boundaries must ascend", x.SlotId)
+				}
+				t.bucket = append(t.bucket, float64(b))
+			}
+			continue
+		default:
+			return nil, fmt.Errorf("slot %d: unknown transform %s", x.SlotId, step.Type)
+		}
+		t.steps = append(t.steps, step)
+	}
+	return t, nil
+}
+
+// apply maps value x of feature name. A bucketed value becomes the categorical feature name#i of
+// value 1, otherwise the feature keeps its name and takes the mapped value. While quantiles are
+// fitted the value goes to the sketch and the feature is dropped, with value 0.
+func (t *slotTransform) apply(name string, x float64) (string, float64) {
+	for _, step := range t.steps {
+		switch step.Type {
+		case "log":
+			if x < 0 {
+				x = -math.Log1p(-x)
+			} else {
+				x = math.Log1p(x)
+			}
+		case "standardize":
+			x = (x - float64(step.Mean)) / float64(step.Std)
+		}
+	}
+	if t.sketch != nil {
+		t.mu.Lock()
+		t.sketch.add(x)
+		t.mu.Unlock()
+		return name, 0
+	}
+	if t.bucket == nil {
+		if t.quantile > 0 {
+			return name, 0
+		}
+		return name, x
+	}
+	i := sort.Search(len(t.bucket), func(i int) bool {
+		return x < t.bucket[i]
+	})
+	return name + "#" + strconv.Itoa(i), 1
+}
+
+// missing is the feature of a numeric slot whose value is empty or not a number: a categorical
+// feature of its own when the slot is bucketed, none otherwise
+func (t *slotTransform) missing(name string) (string, bool) {
+	if t.bucket == nil && t.quantile == 0 {
+		return "", false
+	}
+	return name + "#missing", true
+}
@@ -0,0 +1,223 @@
+package dataloader
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"linearmodel/conf"
+)
+
+// ErrorKind is a category of input errors
+type ErrorKind int
+
+const (
+	ErrFormat  ErrorKind = iota // line structure: label tab, columns, csv or json syntax, cache records
+	ErrLabel                    // label that is not a number
+	ErrFeature                  // feature without slot:feature splitter or with a bad slot
+	ErrValue                    // value of a numeric slot that is not a finite number
+	ErrSign                     // feature of signed input that is not a number
+	ErrRead                     // file that can not be read to the end
+	ErrTrain                    // instances the model failed to train on
+	numErrorKinds
+)
+
+var errorKindNames = [numErrorKinds]string{"format", "label", "feature", "value", "sign", "read", "train"}
+
+func (k ErrorKind) String() string {
+	return errorKindNames[k]
+}
+
+const defaultMinLines = 1000
+
+// inputError is an error of one line, the line is dropped or loses a feature
+type inputError struct {
+	kind ErrorKind
+	msg  string
+}
+
+func (e *inputError) Error() string {
+	return e.msg
+}
+
+func inputErrorf(kind ErrorKind, format string, args ...interface{}) error {
+	return &inputError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// inputCheck counts the lines read and the errors of each kind, and fails the loader once the share
+// of bad lines exceeds the error budget
+type inputCheck struct {
+	config  *conf.ValidationConfig
+	lines   int64
+	bad     int64
+	counts  [numErrorKinds]int64
+	failed  atomic.Value // error
+	mu      sync.Mutex   // quarantine writes
+	qfile   *os.File
+	qfailed bool
+}
+
+func newInputCheck(config *conf.ValidationConfig) *inputCheck {
+	if config == nil {
+		config = &conf.ValidationConfig{}
+	}
+	return &inputCheck{config: config}
+}
+
+// line counts a parsed line and the errors of it, a bad line is logged and quarantined
+func (c *inputCheck) line(l string, err error) {
+	n := atomic.AddInt64(&c.lines, 1)
+	if err != nil {
+		c.report(l, err)
+	}
+	if c.config.MaxErrorRate > 0 && n >= c.minLines() && n%100 == 0 {
+		c.checkRate()
+	}
+}
+
+// report counts the errors of a bad line, or of bad records that have no text when l is empty
+func (c *inputCheck) report(l string, err error) {
+	atomic.AddInt64(&c.bad, 1)
+	var kinds []string
+	forEachInputError(err, func(e *inputError) {
+		atomic.AddInt64(&c.counts[e.kind], 1)
+		kinds = append(kinds, e.kind.String())
+	})
+	glog.Errorf("bad line %s: %v", l, err)
+	if c.config.Quarantine != "" && l != "" {
+		c.quarantine(strings.Join(kinds, ","), err, l)
+	}
+}
+
+// count counts n errors of kind that are not of a line, like instances of a failed batch
+func (c *inputCheck) count(kind ErrorKind, n int) {
+	atomic.AddInt64(&c.counts[kind], int64(n))
+	atomic.AddInt64(&c.bad, int64(n))
+	if c.config.MaxErrorRate > 0 && atomic.LoadInt64(&c.lines) >= c.minLines() {
+		c.checkRate()
+	}
+}
+
+func (c *inputCheck) minLines() int64 {
+	if c.config.MinLines > 0 {
+		return int64(c.config.MinLines)
+	}
+	return defaultMinLines
+}
+
+// checkRate fails the check when the share of bad lines is over the budget
+func (c *inputCheck) checkRate() {
+	lines, bad := atomic.LoadInt64(&c.lines), atomic.LoadInt64(&c.bad)
+	if lines > 0 && float64(bad) > float64(c.config.MaxErrorRate)*float64(lines) {
+		c.fail(fmt.Errorf("%d of %d lines are bad, over max_error_rate %g: %s", bad, lines,
+			c.config.MaxErrorRate, c.summary()))
+	}
+}
+
+// stopped tells whether the check failed, reading and parsing stop then
+func (c *inputCheck) stopped() bool {
+	return c.failed.Load() != nil
+}
+
+func (c *inputCheck) fail(err error) {
+	if c.failed.Load() == nil {
+		c.failed.CompareAndSwap(nil, err)
+	}
+}
+
+func (c *inputCheck) err() error {
+	if err, ok := c.failed.Load().(error); ok {
+		return err
+	}
+	if c.config.MaxErrorRate > 0 {
+		c.checkRate()
+		if err, ok := c.failed.Load().(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// summary is the error count of every kind that has some
+func (c *inputCheck) summary() string {
+	var parts []string
+	for k := ErrorKind(0); k < numErrorKinds; k++ {
+		if n := atomic.LoadInt64(&c.counts[k]); n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", k, n))
+		}
+	}
+	if len(parts) == 0 {
+		return "no error"
+	}
+	return strings.Join(parts, " ")
+}
+
+// quarantine writes kinds\treason\tline to the quarantine file, opened at the first bad line
+func (c *inputCheck) quarantine(kinds string, err error, l string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.qfailed {
+		return
+	}
+	if c.qfile == nil {
+		f, e := os.Create(c.config.Quarantine)
+		if e != nil {
+			glog.Errorf("open quarantine file error: %v", e)
+			c.qfailed = true
+			return
+		}
+		c.qfile = f
+	}
+	reason := strings.ReplaceAll(strings.ReplaceAll(err.Error(), "\n", "; "), "\t", " ")
+	if _, e := fmt.Fprintf(c.qfile, "%s\t%s\t%s\n", kinds, reason, trimLine(l)); e != nil {
+		glog.Errorf("write quarantine file error: %v", e)
+		c.qfailed = true
+	}
+}
+
+// forEachInputError calls f on every inputError joined in err
+func forEachInputError(err error, f func(*inputError)) {
+	switch e := err.(type) {
+	case *inputError:
+		f(e)
+	case interface{ Unwrap() []error }:
+		for _, x := range e.Unwrap() {
+			forEachInputError(x, f)
+		}
+	default:
+		f(&inputError{kind: ErrFormat, msg: err.Error()})
+	}
+}
+
+// CountError counts n instances the caller failed on, e.g. a batch the model did not train on
+func (b *DataLoader) CountError(kind ErrorKind, n int, err error) {
+	glog.Errorf("%s error of %d instances: %v", kind, n, err)
+	b.check.count(kind, n)
+}
+
+// Err is the error that stops the loader, once the share of bad lines is over max_error_rate of
+// the validation config or a file of a strict config can not be read to the end
+func (b *DataLoader) Err() error {
+	if b.check == nil {
+		return nil
+	}
+	return b.check.err()
+}
+
+// ErrorSummary tells the lines read and the errors of every kind
+func (b *DataLoader) ErrorSummary() string {
+	return fmt.Sprintf("%d lines, %d bad: %s", atomic.LoadInt64(&b.check.lines), atomic.LoadInt64(&b.check.bad),
+		b.check.summary())
+}
+
+// readError counts an error reading a file, which fails a strict loader
+func (b *DataLoader) readError(err error) {
+	atomic.AddInt64(&b.check.counts[ErrRead], 1)
+	if b.check.config.Strict {
+		b.check.fail(err)
+	}
+}
@@ -0,0 +1,108 @@
+package dataloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"linearmodel/conf"
+)
+
+func _check_loader(t *testing.T, validation *conf.ValidationConfig) *DataLoader {
+	config := &conf.AllConfig{
+		FeatureList: []*conf.FeatureConfig{
+			{SlotId: 101},
+			{SlotId: 103, Transform: []*conf.TransformConfig{{Type: "log"}}},
+		},
+		ValidationConfig: validation,
+	}
+	dataloader := &DataLoader{}
+	if err := dataloader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	return dataloader
+}
+
+func TestDataLoaderValidation(t *testing.T) {
+	lines := []string{
+		"1\t101:a 103:2\n",
+		"x\t101:a\n",
+		"1\t101:b 103:abc 104\n",
+		"no label\n",
+	}
+	quarantine := filepath.Join(t.TempDir(), "bad")
+	dataloader := _check_loader(t, &conf.ValidationConfig{Quarantine: quarantine})
+	ins := dataloader.ParseIns(lines)
+	// a line with bad features keeps the others
+	if len(ins) != 2 || !reflect.DeepEqual(_texts(ins[1]), []string{"101:b"}) {
+		t.Fatalf("instances %d", len(ins))
+	}
+	if s := dataloader.ErrorSummary(); s != "4 lines, 3 bad: format=1 label=1 feature=1 value=1" {
+		t.Errorf("summary %s", s)
+	}
+	if err := dataloader.Err(); err != nil {
+		t.Errorf("no error budget, but %v", err)
+	}
+	data, _ := os.ReadFile(quarantine)
+	bad := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(bad) != 3 || !strings.HasPrefix(bad[0], "label\t") || !strings.HasSuffix(bad[0], "\tx\t101:a") ||
+		!strings.HasPrefix(bad[1], "value,feature\t") || !strings.HasPrefix(bad[2], "format\t") {
+		t.Errorf("quarantine %q", bad)
+	}
+
+	dataloader = _check_loader(t, &conf.ValidationConfig{Strict: true})
+	if ins := dataloader.ParseIns(lines); len(ins) != 1 {
+		t.Errorf("strict loader keeps %d instances, want 1", len(ins))
+	}
+}
+
+func TestDataLoaderErrorRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "train")
+	f, _ := os.Create(path)
+	for i := 0; i < 5000; i++ {
+		if i%10 == 0 {
+			fmt.Fprintf(f, "x\t101:u%d\n", i)
+		} else {
+			fmt.Fprintf(f, "1\t101:u%d\n", i)
+		}
+	}
+	f.Close()
+	read := func(dataloader *DataLoader) int {
+		pipe, err := dataloader.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for data := range pipe {
+			n += len(dataloader.ParseIns(data))
+		}
+		return n
+	}
+
+	dataloader := _check_loader(t, &conf.ValidationConfig{MaxErrorRate: 0.2})
+	if n := read(dataloader); n != 4500 || dataloader.Err() != nil {
+		t.Errorf("%d instances, error %v", n, dataloader.Err())
+	}
+	dataloader.CountError(ErrTrain, 1000, fmt.Errorf("failed batch"))
+	if err := dataloader.Err(); err == nil || !strings.Contains(err.Error(), "train=1000") {
+		t.Errorf("failed batches should count, error %v", err)
+	}
+
+	dataloader = _check_loader(t, &conf.ValidationConfig{MaxErrorRate: 0.05})
+	if n := read(dataloader); n >= 4500 || dataloader.Err() == nil {
+		t.Errorf("read %d instances over the error budget", n)
+	}
+	if _, err := dataloader.ReadFile(path); err == nil {
+		t.Error("a failed loader should read no more files")
+	}
+
+	// small files are checked when they are done
+	dataloader = _check_loader(t, &conf.ValidationConfig{MaxErrorRate: 0.05, MinLines: 100000})
+	read(dataloader)
+	if dataloader.Err() == nil {
+		t.Error("error rate of a file under min_lines should be checked at its end")
+	}
+}
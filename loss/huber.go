@@ -0,0 +1,32 @@
+package loss
+
+import (
+	"linearmodel/conf"
+)
+
+type Huber struct {
+	delta float32
+}
+
+func (l *Huber) Init(config *conf.LossConfig) {
+	l.delta = config.GetHuberDelta()
+	if l.delta <= 0 {
+		l.delta = 1.0
+	}
+}
+
+func (l *Huber) Predict(z float32) float32 {
+	return z
+}
+
+func (l *Huber) Gradient(z float32, label float32) float32 {
+	// quadratic inside [-delta, delta], linear outside
+	r := z - label
+	if r > l.delta {
+		return l.delta
+	}
+	if r < -l.delta {
+		return -l.delta
+	}
+	return r
+}
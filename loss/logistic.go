@@ -0,0 +1,25 @@
+package loss
+
+import (
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+type Logistic struct {
+}
+
+func (l *Logistic) Init(config *conf.LossConfig) {
+}
+
+func (l *Logistic) Predict(z float32) float32 {
+	return base.Sigmoid32(z)
+}
+
+func (l *Logistic) Gradient(z float32, label float32) float32 {
+	// g = p - y
+	g := base.Sigmoid32(z)
+	if label > 0 {
+		g -= 1.0
+	}
+	return g
+}
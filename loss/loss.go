@@ -0,0 +1,62 @@
+package loss
+
+import (
+	"math"
+
+	"github.com/golang/glog"
+
+	"linearmodel/conf"
+)
+
+// Loss maps the raw model output z to a prediction and gives the gradient of
+// the objective with respect to z, so models only need to back-propagate dz.
+type Loss interface {
+	Init(config *conf.LossConfig)
+	Predict(z float32) float32
+	Gradient(z float32, label float32) float32
+}
+
+func NewLoss(config *conf.LossConfig) Loss {
+	var l Loss
+	switch name := config.GetName(); name {
+	case "", "logistic":
+		l = &Logistic{}
+	case "squared":
+		l = &Squared{}
+	case "huber":
+		l = &Huber{}
+	case "poisson":
+		l = &Poisson{}
+	case "tweedie":
+		l = &Tweedie{}
+	case "ranknet", "bpr":
+		l = &RankNet{}
+	case "lambdarank":
+		l = &LambdaRank{}
+	default:
+		glog.Fatalf("unknown loss: %s", name)
+	}
+	l.Init(config)
+	return l
+}
+
+// IsRegression reports whether the configured loss predicts real valued targets
+func IsRegression(config *conf.LossConfig) bool {
+	switch config.GetName() {
+	case "squared", "huber", "poisson", "tweedie":
+		return true
+	}
+	return false
+}
+
+// exp32 clips the exponent to keep log-link predictions finite
+func exp32(z float32) float32 {
+	if z > maxExp {
+		z = maxExp
+	} else if z < -maxExp {
+		z = -maxExp
+	}
+	return float32(math.Exp(float64(z)))
+}
+
+const maxExp = 40.0
@@ -0,0 +1,99 @@
+package loss
+
+import (
+	"math"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+func numericGrad(f func(z float64) float64, z float64) float64 {
+	eps := 1e-4
+	return (f(z+eps) - f(z-eps)) / (2 * eps)
+}
+
+func TestNewLoss(t *testing.T) {
+	if _, ok := NewLoss(nil).(*Logistic); !ok {
+		t.Error("default loss should be logistic")
+	}
+	if _, ok := NewLoss(&conf.LossConfig{Name: "poisson"}).(*Poisson); !ok {
+		t.Error("poisson loss not created")
+	}
+	if IsRegression(nil) || !IsRegression(&conf.LossConfig{Name: "squared"}) {
+		t.Error("regression check error")
+	}
+}
+
+func TestLogistic_Gradient(t *testing.T) {
+	l := NewLoss(nil)
+	if base.NEQFloat32(l.Predict(0.0), 0.5) {
+		t.Error("logistic predict error")
+	}
+	if base.NEQFloat32(l.Gradient(0.0, 1.0), -0.5) || base.NEQFloat32(l.Gradient(0.0, 0.0), 0.5) {
+		t.Error("logistic gradient error")
+	}
+}
+
+func TestHuber_Gradient(t *testing.T) {
+	l := NewLoss(&conf.LossConfig{Name: "huber", HuberDelta: 1.0})
+	if base.NEQFloat32(l.Gradient(0.5, 0.0), 0.5) || base.NEQFloat32(l.Gradient(3.0, 0.0), 1.0) ||
+		base.NEQFloat32(l.Gradient(-3.0, 0.0), -1.0) {
+		t.Error("huber gradient error")
+	}
+}
+
+func TestRegression_Gradient(t *testing.T) {
+	var y, z = 3.0, 0.7
+	power := 1.3
+	cases := map[string]func(z float64) float64{
+		"squared": func(z float64) float64 { return (z - y) * (z - y) / 2 },
+		"poisson": func(z float64) float64 { return math.Exp(z) - y*z },
+		"tweedie": func(z float64) float64 {
+			return -y*math.Exp((1-power)*z)/(1-power) + math.Exp((2-power)*z)/(2-power)
+		},
+	}
+	for name, f := range cases {
+		l := NewLoss(&conf.LossConfig{Name: name, TweediePower: float32(power)})
+		g := l.Gradient(float32(z), float32(y))
+		if math.Abs(float64(g)-numericGrad(f, z)) > 1e-3 {
+			t.Errorf("%s gradient = %.6f, numeric gradient = %.6f", name, g, numericGrad(f, z))
+		}
+	}
+}
+
+func TestRankNet_Gradients(t *testing.T) {
+	l := NewLoss(&conf.LossConfig{Name: "ranknet", RankSigma: 2.0}).(RankLoss)
+	z := []float32{0.3, -0.2, 0.1}
+	labels := []float32{0, 1, 0}
+	pairLoss := func(zs []float64) float64 {
+		s := 0.0
+		for _, j := range []int{0, 2} {
+			s += math.Log(1 + math.Exp(-2.0*(zs[1]-zs[j])))
+		}
+		return s
+	}
+	grads := l.Gradients(z, labels)
+	for i := range z {
+		zs := []float64{float64(z[0]), float64(z[1]), float64(z[2])}
+		f := func(x float64) float64 {
+			zs[i] = x
+			return pairLoss(zs)
+		}
+		if g := numericGrad(f, float64(z[i])); math.Abs(g-float64(grads[i])) > 1e-3 {
+			t.Errorf("ranknet gradient[%d] = %.6f, numeric gradient = %.6f", i, grads[i], g)
+		}
+	}
+}
+
+func TestLambdaRank_Gradients(t *testing.T) {
+	l := NewLoss(&conf.LossConfig{Name: "lambdarank", RankTopK: 2}).(RankLoss)
+	grads := l.Gradients([]float32{0.5, 0.1, 0.3}, []float32{0, 2, 1})
+	if grads[1] >= 0 || grads[0] <= 0 {
+		t.Error("lambdarank should push relevant item up and irrelevant item down: ", grads)
+	}
+	zero := l.Gradients([]float32{0.5, 0.1}, []float32{0, 0})
+	if zero[0] != 0 || zero[1] != 0 {
+		t.Error("group without relevant item should have no gradient")
+	}
+}
@@ -0,0 +1,20 @@
+package loss
+
+import (
+	"linearmodel/conf"
+)
+
+type Poisson struct {
+}
+
+func (l *Poisson) Init(config *conf.LossConfig) {
+}
+
+func (l *Poisson) Predict(z float32) float32 {
+	return exp32(z)
+}
+
+func (l *Poisson) Gradient(z float32, label float32) float32 {
+	// log link: loss = exp(z) - y*z
+	return exp32(z) - label
+}
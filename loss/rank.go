@@ -0,0 +1,129 @@
+package loss
+
+import (
+	"math"
+	"sort"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// RankLoss computes gradients jointly for all instances of one query/user group.
+// Its pointwise Gradient falls back to logistic loss for ungrouped instances.
+type RankLoss interface {
+	Loss
+	Gradients(z []float32, labels []float32) []float32
+}
+
+// IsRanking reports whether the configured loss is a pairwise or listwise ranking loss
+func IsRanking(config *conf.LossConfig) bool {
+	switch config.GetName() {
+	case "ranknet", "bpr", "lambdarank":
+		return true
+	}
+	return false
+}
+
+// RankNet optimizes log(1 + exp(-sigma*(s_i - s_j))) for every pair with y_i > y_j,
+// bpr is the same loss with sigma = 1.
+type RankNet struct {
+	Logistic
+	sigma float32
+}
+
+func (l *RankNet) Init(config *conf.LossConfig) {
+	l.sigma = config.GetRankSigma()
+	if l.sigma <= 0 || config.GetName() == "bpr" {
+		l.sigma = 1.0
+	}
+}
+
+func (l *RankNet) Gradients(z []float32, labels []float32) []float32 {
+	grads := make([]float32, len(z))
+	for i := range z {
+		for j := range z {
+			if labels[i] <= labels[j] {
+				continue
+			}
+			lambda := pairLambda(l.sigma, z[i], z[j])
+			grads[i] += lambda
+			grads[j] -= lambda
+		}
+	}
+	return grads
+}
+
+// LambdaRank weights every RankNet pair by the change of NDCG@k when the pair is swapped
+type LambdaRank struct {
+	Logistic
+	sigma float32
+	topK  int
+}
+
+func (l *LambdaRank) Init(config *conf.LossConfig) {
+	l.sigma = config.GetRankSigma()
+	if l.sigma <= 0 {
+		l.sigma = 1.0
+	}
+	l.topK = int(config.GetRankTopK())
+}
+
+func (l *LambdaRank) Gradients(z []float32, labels []float32) []float32 {
+	n := len(z)
+	grads := make([]float32, n)
+	k := l.topK
+	if k <= 0 || k > n {
+		k = n
+	}
+	ideal := idealDCG(labels, k)
+	if ideal == 0 {
+		return grads
+	}
+	// rank of every instance by current score
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return z[order[a]] > z[order[b]]
+	})
+	discount := make([]float64, n)
+	for r, i := range order {
+		if r < k {
+			discount[i] = 1.0 / math.Log2(float64(r)+2.0)
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if labels[i] <= labels[j] {
+				continue
+			}
+			delta := math.Abs((gain(labels[i]) - gain(labels[j])) * (discount[i] - discount[j]) / ideal)
+			lambda := pairLambda(l.sigma, z[i], z[j]) * float32(delta)
+			grads[i] += lambda
+			grads[j] -= lambda
+		}
+	}
+	return grads
+}
+
+// pairLambda is the gradient of log(1 + exp(-sigma*(zi - zj))) w.r.t. zi
+func pairLambda(sigma, zi, zj float32) float32 {
+	return -sigma * base.Sigmoid32(-sigma*(zi-zj))
+}
+
+func gain(label float32) float64 {
+	return math.Pow(2.0, float64(label)) - 1.0
+}
+
+func idealDCG(labels []float32, k int) float64 {
+	sorted := append([]float32{}, labels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] > sorted[j]
+	})
+	dcg := 0.0
+	for i := 0; i < k && i < len(sorted); i++ {
+		dcg += gain(sorted[i]) / math.Log2(float64(i)+2.0)
+	}
+	return dcg
+}
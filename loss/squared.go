@@ -0,0 +1,20 @@
+package loss
+
+import (
+	"linearmodel/conf"
+)
+
+type Squared struct {
+}
+
+func (l *Squared) Init(config *conf.LossConfig) {
+}
+
+func (l *Squared) Predict(z float32) float32 {
+	return z
+}
+
+func (l *Squared) Gradient(z float32, label float32) float32 {
+	// loss = (z - y)^2 / 2
+	return z - label
+}
@@ -0,0 +1,30 @@
+package loss
+
+import (
+	"github.com/golang/glog"
+
+	"linearmodel/conf"
+)
+
+type Tweedie struct {
+	power float32
+}
+
+func (l *Tweedie) Init(config *conf.LossConfig) {
+	l.power = config.GetTweediePower()
+	if l.power == 0 {
+		l.power = 1.5
+	}
+	if l.power <= 1.0 || l.power >= 2.0 {
+		glog.Fatalf("tweedie power should be in (1, 2), got %f", l.power)
+	}
+}
+
+func (l *Tweedie) Predict(z float32) float32 {
+	return exp32(z)
+}
+
+func (l *Tweedie) Gradient(z float32, label float32) float32 {
+	// log link: loss = -y*exp((1-p)z)/(1-p) + exp((2-p)z)/(2-p)
+	return -label*exp32((1.0-l.power)*z) + exp32((2.0-l.power)*z)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"linearmodel/modeltool"
+)
+
+const usage = `usage: modeltool <command> [flags] model...
+  merge  -out path [-mode avg|latest] [-weights w1,w2,...] model1 model2 ...
+  diff   before after
+  filter -out path -slots s1,s2,... [-drop] model
+  stats  model
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "merge":
+		err = merge(os.Args[2:])
+	case "diff":
+		err = diff(os.Args[2:])
+	case "filter":
+		err = filter(os.Args[2:])
+	case "stats":
+		err = stats(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "modeltool %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func readAll(paths []string) ([]*modeltool.ModelFile, error) {
+	models := make([]*modeltool.ModelFile, len(paths))
+	for i, path := range paths {
+		m, err := modeltool.Read(path)
+		if err != nil {
+			return nil, err
+		}
+		models[i] = m
+	}
+	return models, nil
+}
+
+func merge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("out", "", "merged model path")
+	mode := fs.String("mode", "avg", "avg: weighted average per key, latest: the last model with a key wins")
+	weightList := fs.String("weights", "", "comma separated weight of every model, equal if empty")
+	fs.Parse(args)
+	if *out == "" || fs.NArg() == 0 {
+		return fmt.Errorf("need -out and models")
+	}
+	var weights []float64
+	if *weightList != "" {
+		for _, s := range strings.Split(*weightList, ",") {
+			w, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("wrong weight %s: %v", s, err)
+			}
+			weights = append(weights, w)
+		}
+	}
+	models, err := readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	merged, err := modeltool.Merge(models, weights, *mode)
+	if err != nil {
+		return err
+	}
+	return merged.Write(*out)
+}
+
+func diff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("need two models")
+	}
+	models, err := readAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	modeltool.PrintDiff(os.Stdout, modeltool.Diff(models[0], models[1]))
+	return nil
+}
+
+func filter(args []string) error {
+	fs := flag.NewFlagSet("filter", flag.ExitOnError)
+	out := fs.String("out", "", "filtered model path")
+	slotList := fs.String("slots", "", "comma separated slots to keep")
+	drop := fs.Bool("drop", false, "remove the slots instead of keeping them")
+	fs.Parse(args)
+	if *out == "" || *slotList == "" || fs.NArg() != 1 {
+		return fmt.Errorf("need -out, -slots and one model")
+	}
+	slots := make(map[uint16]bool)
+	for _, s := range strings.Split(*slotList, ",") {
+		slot, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return fmt.Errorf("wrong slot %s: %v", s, err)
+		}
+		slots[uint16(slot)] = true
+	}
+	m, err := modeltool.Read(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return m.Filter(slots, *drop).Write(*out)
+}
+
+func stats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("need one model")
+	}
+	m, err := modeltool.Read(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	modeltool.PrintStats(os.Stdout, m, modeltool.Stats(m))
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+	"linearmodel/dataloader"
+	"linearmodel/train_utils"
+)
+
+var confPath = flag.String("conf", "", "config file path, its feature list and input config parse the input")
+var out = flag.String("out", "", "cache file path")
+var parallel = flag.Int("parallel", 1, "parallel number")
+var quantiles = flag.String("quantiles", "", "boundaries of quantile slots, read when the file exists, "+
+	"else fitted on the input and written to it, ${out}.quantiles by default")
+
+// preprocess parses text input once into a binary cache that train_list and predict_list can name
+// instead of the text files. The cache only fits configs with the same feature list, hash buckets
+// and input config.
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: preprocess -conf path -out cache [-parallel n] input...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *out == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	config := conf.ParseConf(*confPath)
+	loader := new(dataloader.DataLoader)
+	if err := loader.InitConfig(config); err != nil {
+		glog.Fatalf("init loader error: %v", err)
+	}
+	paths, err := train_utils.ParsePath(flag.Args())
+	if err != nil {
+		glog.Fatal(err)
+	}
+	if loader.HasQuantiles() {
+		initQuantiles(loader, paths)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	w, err := dataloader.NewCacheWriter(f, loader)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	total := 0
+	for _, path := range paths {
+		n, err := convert(loader, w, path)
+		if err != nil {
+			glog.Fatalf("preprocess %s error: %v", path, err)
+		}
+		glog.Infof("%s: %d instances", path, n)
+		total += n
+	}
+	if err := w.Flush(); err != nil {
+		glog.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		glog.Fatal(err)
+	}
+	glog.Infof("wrote %d instances to %s, input: %s", total, *out, loader.ErrorSummary())
+	glog.Flush()
+}
+
+// initQuantiles reads the boundaries of quantile slots, or fits them on the input and writes them
+// for the trainer, which needs the same to read the cache
+func initQuantiles(loader *dataloader.DataLoader, paths []string) {
+	if _, err := os.Stat(*quantiles); *quantiles != "" && err == nil {
+		if err := loader.LoadQuantiles(*quantiles); err != nil {
+			glog.Fatalf("load quantiles error: %v", err)
+		}
+		return
+	}
+	if err := loader.FitQuantiles(paths, *parallel); err != nil {
+		glog.Fatalf("fit quantiles error: %v", err)
+	}
+	path := *quantiles
+	if path == "" {
+		path = *out + ".quantiles"
+	}
+	if err := loader.SaveQuantiles(path); err != nil {
+		glog.Fatalf("save quantiles error: %v", err)
+	}
+	glog.Infof("quantiles written to %s, train with -quantiles %s", path, path)
+}
+
+// convert parses the batches of path on parallel workers and writes them in file order
+func convert(loader *dataloader.DataLoader, w *dataloader.CacheWriter, path string) (int, error) {
+	dataChan, err := loader.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	results := make(chan chan []*base.Instance, *parallel)
+	go func() {
+		for data := range dataChan {
+			res := make(chan []*base.Instance, 1)
+			results <- res
+			go func(data []string) {
+				res <- loader.ParseIns(data)
+			}(data)
+		}
+		close(results)
+	}()
+	n := 0
+	for res := range results {
+		inslist := <-res
+		n += len(inslist)
+		if err != nil {
+			continue
+		}
+		err = w.Write(inslist)
+	}
+	if err == nil {
+		err = loader.Err()
+	}
+	return n, err
+}
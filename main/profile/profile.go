@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+
+	"linearmodel/conf"
+	"linearmodel/dataloader"
+	"linearmodel/profile"
+	"linearmodel/train_utils"
+)
+
+var confPath = flag.String("conf", "", "config file path, its feature list and input config parse the input")
+var parallel = flag.Int("parallel", 1, "parallel number")
+var top = flag.Int("top", 10, "most frequent keys reported per slot")
+var quantiles = flag.String("quantiles", "", "boundaries of quantile slots, fitted on the input when empty")
+
+// profile scans the input, train_list of the conf unless files are given, with the loader of the
+// conf and reports every slot: coverage, cardinality, top keys with their label mean, and the slots
+// the feature list misses.
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: profile -conf path [-parallel n] [-top n] [input...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *confPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	config := conf.ParseConf(*confPath)
+	loader := new(dataloader.DataLoader)
+	if err := loader.InitConfig(config); err != nil {
+		glog.Fatalf("init loader error: %v", err)
+	}
+	inputs := flag.Args()
+	if len(inputs) == 0 {
+		inputs = config.TrainList
+	}
+	paths, err := train_utils.ParsePath(inputs)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	if loader.HasQuantiles() {
+		if *quantiles != "" {
+			err = loader.LoadQuantiles(*quantiles)
+		} else {
+			err = loader.FitQuantiles(paths, *parallel)
+		}
+		if err != nil {
+			glog.Fatalf("quantiles error: %v", err)
+		}
+	}
+	loader.KeepAllSlots()
+	p := profile.New(config, *top)
+	for _, path := range paths {
+		insChan := loader.ParallelIterator(path, *parallel)
+		if insChan == nil {
+			glog.Fatalf("read %s error: %v", path, loader.Err())
+		}
+		for inslist := range insChan {
+			for _, ins := range inslist {
+				p.Add(ins)
+			}
+		}
+		if err := loader.Err(); err != nil {
+			glog.Fatalf("read %s error: %v", path, err)
+		}
+	}
+	glog.Infof("input: %s", loader.ErrorSummary())
+	p.Print(os.Stdout)
+	glog.Flush()
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"flag"
+	"net"
+	"os"
 	"time"
 
 	"github.com/golang/glog"
@@ -23,6 +25,15 @@ var LoadDir = flag.String("load", NULL_STRING, "load directory")
 var conf_path = flag.String("conf", "", "config file path")
 var stat = flag.Bool("stat", false, "model statistics")
 var model_name = flag.String("model", "lr", "using model")
+var seed = flag.Uint64("seed", 0, "non zero seed makes training deterministic, overrides seed in conf")
+var psServer = flag.Int("ps_server", -1, "serve the keys of ps_servers[i] of the conf instead of training")
+var coordinator = flag.Bool("coordinator", false, "serve avg_coordinator of the conf instead of training")
+var psWorker = flag.Uint64("ps_worker", 0, "id of the worker on the parameter servers, overrides ps_worker in conf")
+var worker = flag.Int("worker", -1, "train the i-th of avg_workers shards of train_list with model averaging")
+var checkpointInterval = flag.Duration("checkpoint_interval", 0, "save the model to -save every interval "+
+	"while training, e.g. on a stream from stdin, 0 saves at the end only")
+var quantiles = flag.String("quantiles", "", "boundaries of quantile slots, read when the file exists, "+
+	"else fitted on train_list and written to it")
 
 func main() {
 	flag.Parse()
@@ -35,11 +46,37 @@ func main() {
 	// config
 	config := conf.ParseConf(*conf_path)
 	glog.Infof("conf path: %s", *conf_path)
+	if *seed != 0 {
+		config.Seed = *seed
+	}
+	if *psWorker != 0 {
+		config.PsWorker = *psWorker
+	}
+	if *psServer >= 0 {
+		servePS(config, *psServer)
+		return
+	}
+	if *coordinator {
+		serveCoordinator(config)
+		return
+	}
+	parallel := *Parallel
+	if config.Seed != 0 {
+		// one worker keeps the update order of the input files
+		glog.Infof("deterministic mode with seed %d, parallel %d -> 1", config.Seed, parallel)
+		parallel = 1
+	}
 
 	train_list, _ := train_utils.ParsePath(config.TrainList)
+	if *worker >= 0 {
+		train_list = shardFiles(train_list, *worker, int(config.AvgWorkers))
+		glog.Infof("worker %d of %d trains %v", *worker, config.AvgWorkers, train_list)
+	}
 
 	loader := new(dataloader.DataLoader)
-	loader.Init(*conf_path)
+	if err := loader.InitConfig(config); err != nil {
+		glog.Fatalf("init loader error: %v", err)
+	}
 
 	glog.Info(">>> initial loader sucess")
 
@@ -50,10 +87,14 @@ func main() {
 		lm = new(model.LRModel)
 	} else if *model_name == "fm" {
 		lm = new(model.FMModel)
+	} else if *model_name == "mtfm" {
+		lm = new(model.MTFMModel)
 	} else {
-		glog.Fatalf("error model name: ", *model_name)
+		glog.Fatalf("error model name: %s", *model_name)
+	}
+	if err := lm.Init(config); err != nil {
+		glog.Fatalf("init model error: %v", err)
 	}
-	lm.Init(config)
 	lm.Eval(false)
 	glog.Info(">>> initial model sucess")
 
@@ -63,25 +104,70 @@ func main() {
 	//glog.Infof("save inc model to %s\n", inc_save_path)
 	if load_path != NULL_STRING {
 		glog.Infof("=======load from model: %s=======", load_path)
-		lm.Load(load_path)
+		if err := lm.Load(load_path); err != nil {
+			glog.Fatalf("load model %s error: %v", load_path, err)
+		}
+	}
+	if loader.HasQuantiles() {
+		initQuantiles(loader, config, load_path, parallel)
+	}
+	var averager *model.Averager
+	if *worker >= 0 {
+		var err error
+		if averager, err = model.NewAverager(lm, config, *worker); err != nil {
+			glog.Fatalf("init model averaging error: %v", err)
+		}
+		lm = averager
+	}
+	if *checkpointInterval > 0 {
+		if save_path == NULL_STRING {
+			glog.Fatal("checkpoint_interval needs -save")
+		}
+		if loader.HasQuantiles() {
+			// checkpoints are loaded with the boundaries they were trained with
+			if err := loader.SaveQuantiles(save_path + ".quantiles"); err != nil {
+				glog.Fatalf("save quantiles error: %v", err)
+			}
+		}
+		lm = model.NewCheckpointer(lm, save_path, *checkpointInterval)
 	}
 
 	t := time.Now()
 	for _, path := range train_list {
 		t := time.Now()
-		train_utils.TrainParallel(lm, loader, *Parallel, path)
+		if err := train_utils.TrainParallel(lm, loader, parallel, path); err != nil {
+			glog.Fatalf("train %s error: %v", path, err)
+		}
 		glog.Infof("train %s time: [%s]\n", path, time.Now().Sub(t))
 	}
 	glog.Infof("train time: [%s]\n", time.Now().Sub(t))
+	glog.Infof("train input: %s", loader.ErrorSummary())
+	if averager != nil {
+		if err := averager.Finish(); err != nil {
+			glog.Fatalf("final model averaging error: %v", err)
+		}
+	}
 
 	// ===================save model=========================
 	if save_path != NULL_STRING {
 		glog.Infof("=======save to model: %s=======", save_path)
-		lm.Save(save_path)
+		if err := lm.Save(save_path); err != nil {
+			glog.Fatalf("save model %s error: %v", save_path, err)
+		}
+		if loader.HasQuantiles() {
+			if err := loader.SaveQuantiles(save_path + ".quantiles"); err != nil {
+				glog.Errorf("save quantiles error: %v", err)
+			}
+		}
 	}
 
 	// ====================eval list ========================
-	train_utils.EvalParallel(lm, loader, config.PredictList, *Parallel)
+	if err := train_utils.EvalParallel(lm, loader, config, parallel); err != nil {
+		glog.Fatalf("eval error: %v", err)
+	}
+	if err := lm.Close(); err != nil {
+		glog.Errorf("close model error: %v", err)
+	}
 	glog.Flush()
 
 	// ====================predict list======================
@@ -91,3 +177,83 @@ func main() {
 	//	predict_list = append(predict_list, l...)
 	//}
 }
+
+// servePS runs parameter server i of config until the process is killed
+func servePS(config *conf.AllConfig, i int) {
+	if i >= len(config.PsServers) {
+		glog.Fatalf("ps_server %d out of %d ps_servers", i, len(config.PsServers))
+	}
+	l, err := net.Listen("tcp", config.PsServers[i])
+	if err != nil {
+		glog.Fatalf("listen %s error: %v", config.PsServers[i], err)
+	}
+	model.NewPSServer(config, i, len(config.PsServers)).Serve(l)
+}
+
+// serveCoordinator merges the models of avg_workers workers until the process is killed
+func serveCoordinator(config *conf.AllConfig) {
+	if config.AvgWorkers == 0 {
+		glog.Fatal("coordinator needs avg_workers")
+	}
+	l, err := net.Listen("tcp", config.AvgCoordinator)
+	if err != nil {
+		glog.Fatalf("listen %s error: %v", config.AvgCoordinator, err)
+	}
+	timeout := 600 * time.Second
+	if config.AvgTimeout > 0 {
+		timeout = time.Duration(config.AvgTimeout) * time.Second
+	}
+	model.NewAvgCoordinator(int(config.AvgWorkers), timeout).Serve(l)
+}
+
+// shardFiles returns the files of worker i out of n, every file goes to exactly one worker
+func shardFiles(files []string, i, n int) []string {
+	if i >= n {
+		glog.Fatalf("worker %d out of %d avg_workers", i, n)
+	}
+	shard := []string{}
+	for j, f := range files {
+		if j%n == i {
+			shard = append(shard, f)
+		}
+	}
+	return shard
+}
+
+// initQuantiles reads the boundaries of quantile slots from -quantiles, or from those saved with the
+// loaded model, and fits them on train_list when there are none. A loaded model was trained with its
+// boundaries and workers of model averaging must share theirs, so both only read them.
+func initQuantiles(loader *dataloader.DataLoader, config *conf.AllConfig, loadPath string, parallel int) {
+	path := *quantiles
+	if path == "" && loadPath != NULL_STRING {
+		path = loadPath + ".quantiles"
+	}
+	if _, err := os.Stat(path); path != "" && err == nil {
+		if err := loader.LoadQuantiles(path); err != nil {
+			glog.Fatalf("load quantiles error: %v", err)
+		}
+		glog.Infof("quantiles loaded from %s", path)
+		return
+	}
+	if loadPath != NULL_STRING {
+		glog.Fatalf("quantile boundaries of model %s not found in %s, pass the file it was trained with by -quantiles",
+			loadPath, path)
+	}
+	if *worker >= 0 {
+		glog.Fatal("workers need the boundaries of quantile slots in an existing -quantiles file")
+	}
+	paths, err := train_utils.ParsePath(config.TrainList)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	t := time.Now()
+	if err := loader.FitQuantiles(paths, parallel); err != nil {
+		glog.Fatalf("fit quantiles error: %v", err)
+	}
+	glog.Infof("fit quantiles time: [%s]", time.Now().Sub(t))
+	if *quantiles != "" {
+		if err := loader.SaveQuantiles(*quantiles); err != nil {
+			glog.Fatalf("save quantiles error: %v", err)
+		}
+	}
+}
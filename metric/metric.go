@@ -16,16 +16,15 @@ func AUC(result []base.Result) float64 {
 }
 
 func GroupAUC(result []base.Result) float64 {
-	resMap := make(map[uint64][]base.Result)
-	for _, x := range result {
-		resMap[x.UserId] = append(resMap[x.UserId], x)
-	}
+	resMap := groupByUser(result)
 	count := 0.0
 	sum := 0.0
 	for _, v := range resMap {
 		s := 0
 		for _, x := range v {
-			s += x.Label
+			if x.Label > 0 {
+				s += 1
+			}
 		}
 		if s == 0 || s == len(v) {
 			continue
@@ -38,6 +37,89 @@ func GroupAUC(result []base.Result) float64 {
 	return sum / count
 }
 
+// NDCG averages NDCG@k over users, with gain 2^label - 1. Users without any positive label are skipped
+func NDCG(result []base.Result, k int) float64 {
+	sum, count := 0.0, 0.0
+	for _, v := range groupByUser(result) {
+		n := k
+		if n <= 0 || n > len(v) {
+			n = len(v)
+		}
+		labels := make([]float64, len(v))
+		for i, x := range v {
+			labels[i] = float64(x.Label)
+		}
+		sort.Sort(sort.Reverse(sort.Float64Slice(labels)))
+		ideal := dcg(labels[:n])
+		if ideal == 0 {
+			continue
+		}
+		sortByScore(v)
+		for i := 0; i < n; i++ {
+			labels[i] = float64(v[i].Label)
+		}
+		sum += dcg(labels[:n]) / ideal
+		count += 1
+	}
+	if count == 0 {
+		return 0.0
+	}
+	return sum / count
+}
+
+// MRR averages the reciprocal rank of the first positive item over users with at least one positive
+func MRR(result []base.Result) float64 {
+	sum, count := 0.0, 0.0
+	for _, v := range groupByUser(result) {
+		sortByScore(v)
+		for i, x := range v {
+			if x.Label > 0 {
+				sum += 1.0 / float64(i+1)
+				count += 1
+				break
+			}
+		}
+	}
+	if count == 0 {
+		return 0.0
+	}
+	return sum / count
+}
+
+// groupByUser groups results in user id order, so metrics sum up in the same order on every run
+func groupByUser(result []base.Result) [][]base.Result {
+	resMap := make(map[uint64][]base.Result)
+	for _, x := range result {
+		resMap[x.UserId] = append(resMap[x.UserId], x)
+	}
+	users := make([]uint64, 0, len(resMap))
+	for u := range resMap {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i] < users[j]
+	})
+	groups := make([][]base.Result, len(users))
+	for i, u := range users {
+		groups[i] = resMap[u]
+	}
+	return groups
+}
+
+func sortByScore(y []base.Result) {
+	sort.SliceStable(y, func(i, j int) bool {
+		return y[i].Score > y[j].Score
+	})
+}
+
+func dcg(labels []float64) float64 {
+	s := 0.0
+	for i, y := range labels {
+		s += (math.Pow(2.0, y) - 1.0) / math.Log2(float64(i)+2.0)
+	}
+	return s
+}
+
 func Losses(result []base.Result) float64 {
 	n := len(result)
 	l := 0.0
@@ -64,6 +146,42 @@ func Loss(result base.Result) float64 {
 	return -l
 }
 
+func RMSE(result []base.Result) float64 {
+	n := len(result)
+	s := 0.0
+	for i := range result {
+		d := float64(result[i].Score - result[i].Label)
+		s += d * d
+	}
+	return math.Sqrt(s / float64(n))
+}
+
+func MAE(result []base.Result) float64 {
+	n := len(result)
+	s := 0.0
+	for i := range result {
+		s += math.Abs(float64(result[i].Score - result[i].Label))
+	}
+	return s / float64(n)
+}
+
+// PoissonDeviance is the mean of 2*(y*log(y/mu) - (y-mu)), score is the predicted mean mu
+func PoissonDeviance(result []base.Result) float64 {
+	eps := 1e-9
+	n := len(result)
+	s := 0.0
+	for i := range result {
+		y := float64(result[i].Label)
+		mu := math.Max(float64(result[i].Score), eps)
+		d := mu - y
+		if y > 0 {
+			d += y * math.Log(y/mu)
+		}
+		s += 2.0 * d
+	}
+	return s / float64(n)
+}
+
 func Mean(res []float64, weight []float64) (float64, float64) {
 	mean := 0.0
 	count := 0.0
@@ -1,6 +1,7 @@
 package metric
 
 import (
+	"math"
 	"testing"
 
 	"linearmodel/base"
@@ -38,3 +39,33 @@ func TestLosses(t *testing.T) {
 		t.Errorf("calc loss = %.6f, true loss = %.6f", trueLoss, calcLoss)
 	}
 }
+
+func TestRegressionMetric(t *testing.T) {
+	resList := []base.Result{{Label: 1.0, Score: 2.0}, {Label: 0.0, Score: 0.5}, {Label: 3.0, Score: 1.0}}
+	if rmse := RMSE(resList); base.NEQFloat(rmse, 1.32287566) {
+		t.Errorf("rmse = %.6f, true rmse = %.6f", rmse, 1.32287566)
+	}
+	if mae := MAE(resList); base.NEQFloat(mae, 1.16666667) {
+		t.Errorf("mae = %.6f, true mae = %.6f", mae, 1.16666667)
+	}
+	if dev := PoissonDeviance(resList); base.NEQFloat(dev, 1.40179312) {
+		t.Errorf("poisson deviance = %.6f, true deviance = %.6f", dev, 1.40179312)
+	}
+}
+
+func TestRankMetric(t *testing.T) {
+	resList := []base.Result{{Label: 0, Score: 0.9, UserId: 10}, {Label: 1, Score: 0.5, UserId: 10},
+		{Label: 1, Score: 0.7, UserId: 20}, {Label: 0, Score: 0.2, UserId: 20},
+		{Label: 0, Score: 0.8, UserId: 30},
+	}
+	trueNdcg := (1.0/math.Log2(3.0) + 1.0) / 2.0
+	if ndcg := NDCG(resList, 2); base.NEQFloat(ndcg, trueNdcg) {
+		t.Errorf("ndcg = %.6f, true ndcg = %.6f", ndcg, trueNdcg)
+	}
+	if ndcg := NDCG(resList, 1); base.NEQFloat(ndcg, 0.5) {
+		t.Errorf("ndcg@1 = %.6f, true ndcg@1 = %.6f", ndcg, 0.5)
+	}
+	if mrr := MRR(resList); base.NEQFloat(mrr, 0.75) {
+		t.Errorf("mrr = %.6f, true mrr = %.6f", mrr, 0.75)
+	}
+}
@@ -0,0 +1,521 @@
+package model
+
+import (
+	"math"
+	"runtime"
+	"sort"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/optim"
+)
+
+const (
+	arenaShardBits = 6
+	arenaShards    = 1 << arenaShardBits
+	arenaMinChunk  = 1 << 12 // floats of the first chunk of a shard, chunks double up to arenaMaxChunk
+	arenaMaxChunk  = 1 << 20 // an entry never spans two chunks
+	arenaStripes   = 4096
+)
+
+// entry layout: header, State, VecW, VecZ, VecN, VecState. Integers of the header are float32 bits.
+const (
+	hSlot = iota
+	hShow
+	hClick
+	hText    // text offset in the shard texts
+	hTextLen // text length
+	hVec     // embedding size
+	hState   // State size
+	hVecState
+	hW
+	hZ
+	hN
+	headerSize
+)
+
+// arenaStore keeps parameters as float32 entries of an entryTable, without a pointer per key.
+// Lookups are lock free, inserts are serialized by the table and updates of a key take the
+// striped spin lock of its hash.
+type arenaStore struct {
+	slotTable
+	opt      optim.Optimizer // sizes the optimizer state of an entry
+	table    entryTable
+	stripes  [arenaStripes]paddedLock
+	biasLock spinLock
+	bias     []float32
+}
+
+// entryTable maps keys to entries of the layout above, the key hash h picks shard and bucket
+type entryTable interface {
+	// bias is the entry of the bias term, with n floats
+	bias(n int) []float32
+	lookup(key, h uint64) []float32
+	// insert returns the entry of key, a new entry has n floats and is filled by init before it is visible.
+	// A table that can not take the entry returns nil, and the error from err if it is a failingStore.
+	insert(key, h uint64, n int, text string, init func(e []float32)) []float32
+	text(key, h uint64, e []float32) string
+	// each calls f on every entry, in key order inside a shard when sorted is set
+	each(sorted bool, f func(key uint64, e []float32))
+}
+
+func newArenaStore(table entryTable, size uint32, norm float32, seed uint64, opt optim.Optimizer) *arenaStore {
+	s := &arenaStore{opt: opt, table: table}
+	s.size = size
+	s.norm = norm
+	s.seed = seed
+	state, _ := s.stateSize(0)
+	s.bias = table.bias(headerSize + state)
+	setInt(s.bias, hState, state)
+	return s
+}
+
+func (s *arenaStore) stateSize(size int) (int, int) {
+	if s.opt == nil {
+		return 0, 0
+	}
+	return s.opt.StateSize(size)
+}
+
+func arenaHash(key uint64) uint64 {
+	key ^= key >> 33
+	key *= 0xff51afd7ed558ccd
+	key ^= key >> 33
+	key *= 0xc4ceb9fe1a85ec53
+	key ^= key >> 33
+	return key
+}
+
+func (s *arenaStore) stripe(h uint64) *spinLock {
+	return &s.stripes[(h>>32)%arenaStripes].spinLock
+}
+
+// entrySize is the number of floats of an entry
+func entrySize(e []float32) int {
+	return headerSize + getInt(e, hState) + 3*getInt(e, hVec) + getInt(e, hVecState)
+}
+
+func (s *arenaStore) insert(key, h uint64, slot uint16, text string, init bool) []float32 {
+	size, _ := s.sizeOf(slot)
+	state, vecState := s.stateSize(int(size))
+	n := headerSize + state + 3*int(size) + vecState
+	return s.table.insert(key, h, n, text, func(e []float32) {
+		setInt(e, hSlot, int(slot))
+		setInt(e, hVec, int(size))
+		setInt(e, hState, state)
+		setInt(e, hVecState, vecState)
+		if init {
+			copy(e[headerSize+state:], s.newVec(key, slot))
+		}
+	})
+}
+
+// param is a base.Parameter over entry e, its State and vectors alias the arena
+func (s *arenaStore) param(key uint64, e []float32) *base.Parameter {
+	state, size, vecState := getInt(e, hState), getInt(e, hVec), getInt(e, hVecState)
+	p := &base.Parameter{Slot: uint16(getInt(e, hSlot)), Fea: key, Show: getInt(e, hShow), Click: getInt(e, hClick),
+		W: e[hW], Z: e[hZ], N: e[hN]}
+	a := headerSize
+	p.State, a = e[a:a+state:a+state], a+state
+	p.VecW, a = e[a:a+size:a+size], a+size
+	p.VecZ, a = e[a:a+size:a+size], a+size
+	p.VecN, a = e[a:a+size:a+size], a+size
+	p.VecState = e[a : a+vecState : a+vecState]
+	return p
+}
+
+// store writes back the scalars of p, the optimizer must keep the state layout of StateSize
+func (s *arenaStore) store(e []float32, p *base.Parameter) {
+	if len(p.State) != getInt(e, hState) || len(p.VecState) != getInt(e, hVecState) {
+		glog.Fatalf("optimizer state size %d, %d differs from StateSize %d, %d", len(p.State), len(p.VecState),
+			getInt(e, hState), getInt(e, hVecState))
+	}
+	setInt(e, hShow, p.Show)
+	setInt(e, hClick, p.Click)
+	e[hW], e[hZ], e[hN] = p.W, p.Z, p.N
+}
+
+// locked finds the entry of key and its lock, the bias is key 0
+func (s *arenaStore) locked(key uint64, h uint64) ([]float32, *spinLock) {
+	if key == 0 {
+		return s.bias, &s.biasLock
+	}
+	return s.table.lookup(key, h), s.stripe(h)
+}
+
+// modify runs f on the parameter of key under its lock
+func (s *arenaStore) modify(key uint64, slot uint16, f func(p *base.Parameter)) {
+	h := arenaHash(key)
+	e, l := s.locked(key, h)
+	if e == nil {
+		glog.Errorf(">>>> update parameter before exist: key=%d, slot=%d", key, slot)
+		return
+	}
+	l.lock()
+	p := s.param(key, e)
+	f(p)
+	s.store(e, p)
+	l.unlock()
+}
+
+func (s *arenaStore) update(key uint64, slot uint16, label float32, grad float32, opt optim.Optimizer) {
+	s.modify(key, slot, func(p *base.Parameter) {
+		if key != 0 {
+			p.Show += 1
+			if label > 0 {
+				p.Click += 1
+			}
+		}
+		opt.Update(grad, p)
+	})
+}
+
+func (s *arenaStore) updateEmb(key uint64, slot uint16, label float32, grad []float32, opt optim.Optimizer) {
+	s.modify(key, slot, func(p *base.Parameter) {
+		opt.UpdateEmb(grad, p)
+	})
+}
+
+func (s *arenaStore) updateWeightAndEmb(key uint64, slot uint16, label float32, grad float32, gradVec []float32,
+	opt optim.Optimizer) {
+	if key == 0 {
+		s.update(key, slot, label, grad, opt)
+		return
+	}
+	s.modify(key, slot, func(p *base.Parameter) {
+		p.Show += 1
+		if label > 0 {
+			p.Click += 1
+		}
+		opt.Update(grad, p)
+		opt.UpdateEmb(gradVec, p)
+	})
+}
+
+func (s *arenaStore) applyGrad(key uint64, slot uint16, show, click int, grad float32, gradVec []float32,
+	opt optim.Optimizer) {
+	s.modify(key, slot, func(p *base.Parameter) {
+		if key != 0 {
+			p.Show += show
+			p.Click += click
+		}
+		opt.Update(grad, p)
+		if key != 0 && gradVec != nil {
+			opt.UpdateEmb(gradVec, p)
+		}
+	})
+}
+
+func (s *arenaStore) getWeight(key uint64, slot uint16, text string, needInit bool) *base.Weight {
+	w := base.Weight{W: 0.0}
+	if key != 0 {
+		size, _ := s.sizeOf(slot)
+		w.VecW = make([]float32, size)
+	}
+	h := arenaHash(key)
+	e, l := s.locked(key, h)
+	if e == nil && needInit {
+		e = s.insert(key, h, slot, text, true)
+	}
+	if e != nil {
+		l.lock()
+		w.W = e[hW]
+		copy(w.VecW, e[headerSize+getInt(e, hState):])
+		l.unlock()
+	}
+	return &w
+}
+
+// get returns a copy of the parameter, changing it does not change the store
+func (s *arenaStore) get(key uint64, slot uint16, needInit bool) *base.Parameter {
+	h := arenaHash(key)
+	e, _ := s.locked(key, h)
+	if e == nil && needInit {
+		e = s.insert(key, h, slot, "", true)
+	}
+	if e == nil {
+		return nil
+	}
+	return s.copyOf(key, h, e)
+}
+
+func (s *arenaStore) copyOf(key, h uint64, e []float32) *base.Parameter {
+	_, l := s.locked(key, h)
+	l.lock()
+	p := *s.param(key, e)
+	p.State = append([]float32(nil), p.State...)
+	p.VecW = append([]float32(nil), p.VecW...)
+	p.VecZ = append([]float32(nil), p.VecZ...)
+	p.VecN = append([]float32(nil), p.VecN...)
+	p.VecState = append([]float32(nil), p.VecState...)
+	l.unlock()
+	if key != 0 {
+		p.Text = s.table.text(key, h, e)
+	}
+	return &p
+}
+
+// set copies parameter into the entry of key
+func (s *arenaStore) set(key uint64, parameter *base.Parameter) {
+	h := arenaHash(key)
+	e, l := s.locked(key, h)
+	if e == nil {
+		e = s.insert(key, h, parameter.Slot, parameter.Text, false)
+	}
+	if e == nil {
+		return
+	}
+	l.lock()
+	p := s.param(key, e)
+	p.Show, p.Click = parameter.Show, parameter.Click
+	p.W, p.Z, p.N = parameter.W, parameter.Z, parameter.N
+	copy(p.State, parameter.State)
+	copy(p.VecW, parameter.VecW)
+	copy(p.VecZ, parameter.VecZ)
+	copy(p.VecN, parameter.VecN)
+	copy(p.VecState, parameter.VecState)
+	s.store(e, p)
+	l.unlock()
+}
+
+// err returns the insert failure of a table that may fail
+func (s *arenaStore) err() error {
+	if f, ok := s.table.(failingStore); ok {
+		return f.err()
+	}
+	return nil
+}
+
+// flush writes a table backed by files to disk
+func (s *arenaStore) flush() error {
+	if fl, ok := s.table.(flusher); ok {
+		return fl.flush()
+	}
+	return nil
+}
+
+// close releases a table backed by files
+func (s *arenaStore) close() error {
+	if c, ok := s.table.(closer); ok {
+		return c.close()
+	}
+	return nil
+}
+
+func (s *arenaStore) each(f func(key uint64, p *base.Parameter)) {
+	s.table.each(s.seed != 0, func(key uint64, e []float32) {
+		f(key, s.copyOf(key, arenaHash(key), e))
+	})
+}
+
+// memTable is the in memory entryTable: every shard is an open addressing table from key to
+// an entry in float32 chunks, inserts take the spin lock of the shard.
+type memTable struct {
+	shards   [arenaShards]arenaShard
+	biasData []float32
+}
+
+type arenaShard struct {
+	lock  spinLock
+	view  atomic.Value // *arenaView, replaced when the table grows or a chunk is added
+	count int          // entries, guarded by lock
+	used  int          // floats used in the last chunk, guarded by lock
+	texts []byte       // guarded by lock
+}
+
+type arenaView struct {
+	keys   []uint64 // 0 is an empty bucket, a key is published after its ref
+	refs   []uint64 // chunk << 32 | offset of the entry
+	chunks [][]float32
+}
+
+func newMemTable(cap uint64) *memTable {
+	t := &memTable{}
+	buckets := 16
+	for uint64(buckets) < 2*cap/arenaShards {
+		buckets *= 2
+	}
+	for i := range t.shards {
+		t.shards[i].view.Store(&arenaView{keys: make([]uint64, buckets), refs: make([]uint64, buckets)})
+	}
+	return t
+}
+
+func (t *memTable) shard(h uint64) *arenaShard {
+	return &t.shards[h>>(64-arenaShardBits)]
+}
+
+func (t *memTable) bias(n int) []float32 {
+	t.biasData = make([]float32, n)
+	return t.biasData
+}
+
+func (t *memTable) lookup(key, h uint64) []float32 {
+	sh := t.shard(h)
+	v := sh.load()
+	ref, ok := v.find(key, h)
+	if !ok {
+		return nil
+	}
+	return sh.entry(v, ref)
+}
+
+func (t *memTable) insert(key, h uint64, n int, text string, init func(e []float32)) []float32 {
+	sh := t.shard(h)
+	sh.lock.lock()
+	defer sh.lock.unlock()
+	v := sh.load()
+	if ref, ok := v.find(key, h); ok {
+		return sh.entry(v, ref)
+	}
+	if 2*(sh.count+1) > len(v.keys) {
+		v = sh.grow(v)
+	}
+	c := len(v.chunks) - 1
+	if c < 0 || sh.used+n > len(v.chunks[c]) {
+		chunkSize := arenaMinChunk
+		if c >= 0 {
+			chunkSize = 2 * len(v.chunks[c])
+		}
+		if chunkSize > arenaMaxChunk {
+			chunkSize = arenaMaxChunk
+		}
+		if n > chunkSize {
+			chunkSize = n
+		}
+		chunks := make([][]float32, len(v.chunks)+1)
+		copy(chunks, v.chunks)
+		chunks[len(v.chunks)] = make([]float32, chunkSize)
+		v = &arenaView{keys: v.keys, refs: v.refs, chunks: chunks}
+		sh.view.Store(v)
+		c = len(chunks) - 1
+		sh.used = 0
+	}
+	off := sh.used
+	sh.used += n
+	e := v.chunks[c][off : off+n : off+n]
+	init(e)
+	setInt(e, hText, len(sh.texts))
+	setInt(e, hTextLen, len(text))
+	sh.texts = append(sh.texts, text...)
+
+	mask := uint64(len(v.keys) - 1)
+	i := h & mask
+	for v.keys[i] != 0 {
+		i = (i + 1) & mask
+	}
+	atomic.StoreUint64(&v.refs[i], uint64(c)<<32|uint64(off))
+	atomic.StoreUint64(&v.keys[i], key)
+	sh.count++
+	return e
+}
+
+func (t *memTable) text(key, h uint64, e []float32) string {
+	sh := t.shard(h)
+	sh.lock.lock()
+	defer sh.lock.unlock()
+	off := getInt(e, hText)
+	return string(sh.texts[off : off+getInt(e, hTextLen)])
+}
+
+func (t *memTable) each(sorted bool, f func(key uint64, e []float32)) {
+	type keyRef struct {
+		key uint64
+		ref uint64
+	}
+	for i := range t.shards {
+		sh := &t.shards[i]
+		v := sh.load()
+		items := make([]keyRef, 0, len(v.keys)/2)
+		for j := range v.keys {
+			if k := atomic.LoadUint64(&v.keys[j]); k != 0 {
+				items = append(items, keyRef{key: k, ref: atomic.LoadUint64(&v.refs[j])})
+			}
+		}
+		if sorted {
+			sort.Slice(items, func(i, j int) bool {
+				return items[i].key < items[j].key
+			})
+		}
+		for _, x := range items {
+			f(x.key, sh.entry(v, x.ref))
+		}
+	}
+}
+
+func (sh *arenaShard) load() *arenaView {
+	return sh.view.Load().(*arenaView)
+}
+
+func (v *arenaView) find(key, h uint64) (uint64, bool) {
+	mask := uint64(len(v.keys) - 1)
+	for i := h & mask; ; i = (i + 1) & mask {
+		k := atomic.LoadUint64(&v.keys[i])
+		if k == key {
+			return atomic.LoadUint64(&v.refs[i]), true
+		}
+		if k == 0 {
+			return 0, false
+		}
+	}
+}
+
+// entry resolves ref, a ref found in an old view may point to a chunk added after it
+func (sh *arenaShard) entry(v *arenaView, ref uint64) []float32 {
+	c, off := int(ref>>32), int(uint32(ref))
+	if c >= len(v.chunks) {
+		v = sh.load()
+	}
+	e := v.chunks[c][off:]
+	n := entrySize(e)
+	return e[:n:n]
+}
+
+// grow doubles the table, entries stay where they are in the chunks
+func (sh *arenaShard) grow(v *arenaView) *arenaView {
+	n := 2 * len(v.keys)
+	g := &arenaView{keys: make([]uint64, n), refs: make([]uint64, n), chunks: v.chunks}
+	mask := uint64(n - 1)
+	for j, k := range v.keys {
+		if k == 0 {
+			continue
+		}
+		i := arenaHash(k) & mask
+		for g.keys[i] != 0 {
+			i = (i + 1) & mask
+		}
+		g.keys[i] = k
+		g.refs[i] = v.refs[j]
+	}
+	sh.view.Store(g)
+	return g
+}
+
+func getInt(e []float32, i int) int {
+	return int(math.Float32bits(e[i]))
+}
+
+func setInt(e []float32, i int, x int) {
+	e[i] = math.Float32frombits(uint32(x))
+}
+
+// spinLock is a test and set lock for short critical sections
+type spinLock uint32
+
+func (l *spinLock) lock() {
+	for !atomic.CompareAndSwapUint32((*uint32)(l), 0, 1) {
+		runtime.Gosched()
+	}
+}
+
+func (l *spinLock) unlock() {
+	atomic.StoreUint32((*uint32)(l), 0)
+}
+
+// paddedLock keeps every stripe on its own cache line
+type paddedLock struct {
+	spinLock
+	_ [60]byte
+}
@@ -0,0 +1,292 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/rpc"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// storeModel is a model whose parameter stores can be read and replaced, by store name
+type storeModel interface {
+	paramStores() map[string]paramStore
+}
+
+// AvgArgs carries every parameter of a worker, the bias is key 0 of every store
+type AvgArgs struct {
+	Worker int
+	Final  bool // the worker is done, it waits for the model of all workers
+	Stores map[string][]PSEntry
+}
+
+type AvgReply struct {
+	Stores map[string][]PSEntry
+}
+
+// Averager trains one worker of a data parallel job: every interval instances it sends its
+// parameters to the coordinator and goes on from the merge of all workers.
+type Averager struct {
+	IModel
+	stores   map[string]paramStore
+	client   *rpc.Client
+	worker   int
+	interval int64
+
+	mu    sync.RWMutex // Train holds it shared and a sync exclusively
+	count int64        // instances since the last sync, atomic
+}
+
+// NewAverager connects worker to avg_coordinator of config, m must be initialized
+func NewAverager(m IModel, config *conf.AllConfig, worker int) (*Averager, error) {
+	sm, ok := m.(storeModel)
+	if !ok {
+		return nil, fmt.Errorf("model %T does not support averaging", m)
+	}
+	client, err := rpc.Dial("tcp", config.AvgCoordinator)
+	if err != nil {
+		return nil, fmt.Errorf("connect coordinator %s error: %v", config.AvgCoordinator, err)
+	}
+	return &Averager{IModel: m, stores: sm.paramStores(), client: client, worker: worker,
+		interval: int64(config.AvgInterval)}, nil
+}
+
+func (a *Averager) Train(inslist []*base.Instance) error {
+	a.mu.RLock()
+	err := a.IModel.Train(inslist)
+	a.mu.RUnlock()
+	if a.interval == 0 || atomic.AddInt64(&a.count, int64(len(inslist))) < a.interval {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// another thread of the worker may have synced meanwhile, and threads past the lock go on counting
+	if n := atomic.LoadInt64(&a.count); n >= a.interval {
+		atomic.AddInt64(&a.count, -n)
+		if err := a.sync(false); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Finish makes the last sync, after it every worker has the same model
+func (a *Averager) Finish() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sync(true)
+}
+
+func (a *Averager) sync(final bool) error {
+	args := &AvgArgs{Worker: a.worker, Final: final, Stores: make(map[string][]PSEntry)}
+	for name, s := range a.stores {
+		entries := []PSEntry{{Key: 0, P: *s.get(0, 0, false)}}
+		s.each(func(k uint64, v *base.Parameter) {
+			entries = append(entries, PSEntry{Key: k, P: *v})
+		})
+		args.Stores[name] = entries
+	}
+	reply := new(AvgReply)
+	if err := a.client.Call("Avg.Sync", args, reply); err != nil {
+		return fmt.Errorf("sync with coordinator error: %v", err)
+	}
+	for name, entries := range reply.Stores {
+		s := a.stores[name]
+		for i := range entries {
+			s.set(entries[i].Key, &entries[i].P)
+		}
+	}
+	glog.Infof("worker %d synced, final=%v", a.worker, final)
+	return nil
+}
+
+// AvgCoordinator merges the models of the workers of a data parallel job. A round ends when
+// every worker not yet finished has sent its model, and answers all of them with the merge. A
+// round that waits longer than timeout merges the models it has, and the workers missing in it
+// are no longer waited for.
+type AvgCoordinator struct {
+	workers int
+	timeout time.Duration
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	merged   map[string]map[uint64]*base.Parameter
+	round    int
+	pending  []*AvgArgs
+	finished int // workers done or dropped before the current round
+	reply    *AvgReply
+}
+
+func NewAvgCoordinator(workers int, timeout time.Duration) *AvgCoordinator {
+	c := &AvgCoordinator{workers: workers, timeout: timeout, merged: make(map[string]map[uint64]*base.Parameter)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// avgRPC holds the methods workers call, apart from those of AvgCoordinator
+type avgRPC AvgCoordinator
+
+// Serve answers workers on l until it is closed
+func (c *AvgCoordinator) Serve(l net.Listener) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Avg", (*avgRPC)(c)); err != nil {
+		glog.Fatalf("register coordinator error: %v", err)
+	}
+	glog.Infof("coordinator of %d workers listens on %s", c.workers, l.Addr())
+	server.Accept(l)
+}
+
+func (r *avgRPC) Sync(args *AvgArgs, reply *AvgReply) error {
+	c := (*AvgCoordinator)(r)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	round := c.round
+	c.pending = append(c.pending, args)
+	if len(c.pending) >= c.workers-c.finished {
+		c.merge()
+	} else if len(c.pending) == 1 && c.timeout > 0 {
+		time.AfterFunc(c.timeout, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.round == round {
+				missing := c.workers - c.finished - len(c.pending)
+				glog.Errorf("coordinator round %d timed out after %s, %d workers dropped", round, c.timeout, missing)
+				c.finished += missing
+				c.merge()
+			}
+		})
+	}
+	for c.round == round {
+		c.cond.Wait()
+	}
+	for args.Final && c.finished < c.workers {
+		c.cond.Wait()
+	}
+	*reply = *c.reply
+	return nil
+}
+
+// merge ends a round, it runs with mu held
+func (c *AvgCoordinator) merge() {
+	for name := range c.pending[0].Stores {
+		keys := make(map[uint64][]*base.Parameter)
+		for _, args := range c.pending {
+			for i := range args.Stores[name] {
+				e := &args.Stores[name][i]
+				keys[e.Key] = append(keys[e.Key], &e.P)
+			}
+		}
+		merged := c.merged[name]
+		if merged == nil {
+			merged = make(map[uint64]*base.Parameter)
+			c.merged[name] = merged
+		}
+		for key, ps := range keys {
+			merged[key] = mergeParams(merged[key], ps)
+		}
+	}
+	c.reply = &AvgReply{Stores: make(map[string][]PSEntry)}
+	for name, merged := range c.merged {
+		entries := make([]PSEntry, 0, len(merged))
+		for key, p := range merged {
+			entries = append(entries, PSEntry{Key: key, P: *p})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Key < entries[j].Key
+		})
+		c.reply.Stores[name] = entries
+	}
+	for _, args := range c.pending {
+		if args.Final {
+			c.finished++
+		}
+	}
+	glog.Infof("coordinator merged round %d of %d workers", c.round, len(c.pending))
+	c.pending = nil
+	c.round++
+	c.cond.Broadcast()
+}
+
+// mergeParams merges the parameters of one key from the workers, prev is the merge of the last
+// round or nil. Weights and optimizer state are averaged. FTRL n, show and click are sums over all
+// instances, so every worker adds what it gained since prev as if one process had seen all of
+// them, and FTRL z is scaled to the summed n so that z / sqrt(n), which sets the weight, is the
+// average of the workers.
+func mergeParams(prev *base.Parameter, ps []*base.Parameter) *base.Parameter {
+	if prev == nil {
+		prev = &base.Parameter{}
+	}
+	// state never touched by a worker is nil, the same as zero
+	var size, state, vecState int
+	for _, p := range ps {
+		size = maxInt(size, len(p.VecW))
+		state = maxInt(state, len(p.State))
+		vecState = maxInt(vecState, len(p.VecState))
+	}
+	p0 := ps[0]
+	out := &base.Parameter{Slot: p0.Slot, Fea: p0.Fea, Text: p0.Text, Show: prev.Show, Click: prev.Click,
+		N:        prev.N,
+		VecW:     make([]float32, size),
+		VecZ:     make([]float32, size),
+		VecN:     make([]float32, size),
+		State:    make([]float32, state),
+		VecState: make([]float32, vecState),
+	}
+	copy(out.VecN, prev.VecN)
+	scale := 1.0 / float32(len(ps))
+	for _, p := range ps {
+		out.Show += p.Show - prev.Show
+		out.Click += p.Click - prev.Click
+		out.N += p.N - prev.N
+		out.W += p.W * scale
+		for i := range out.VecN {
+			out.VecN[i] += at(p.VecN, i) - at(prev.VecN, i)
+		}
+		base.InPlaceVecTimeAdd(out.VecW, p.VecW, 1.0, scale)
+		base.InPlaceVecTimeAdd(out.State, p.State, 1.0, scale)
+		base.InPlaceVecTimeAdd(out.VecState, p.VecState, 1.0, scale)
+	}
+	out.Z = mergeZ(ps, out.N, func(p *base.Parameter) (float32, float32) {
+		return p.Z, p.N
+	})
+	for i := range out.VecZ {
+		out.VecZ[i] = mergeZ(ps, out.VecN[i], func(p *base.Parameter) (float32, float32) {
+			return at(p.VecZ, i), at(p.VecN, i)
+		})
+	}
+	return out
+}
+
+// mergeZ averages z / sqrt(n) of the workers and scales it back by the merged n
+func mergeZ(ps []*base.Parameter, n float32, zn func(p *base.Parameter) (float32, float32)) float32 {
+	sum := 0.0
+	for _, p := range ps {
+		if z, pn := zn(p); pn > 0 {
+			sum += float64(z) / math.Sqrt(float64(pn))
+		}
+	}
+	return float32(sum / float64(len(ps)) * math.Sqrt(float64(n)))
+}
+
+// at is x[i], or zero past the end of x
+func at(x []float32, i int) float32 {
+	if i < len(x) {
+		return x[i]
+	}
+	return 0
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
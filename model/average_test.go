@@ -0,0 +1,174 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"linearmodel/base"
+)
+
+func TestMergeParams(t *testing.T) {
+	prev := &base.Parameter{Show: 10, Click: 2, W: 1, Z: -1, N: 4, VecW: []float32{1, 1}, VecZ: []float32{0, 0},
+		VecN: []float32{1, 1}}
+	w1 := &base.Parameter{Show: 13, Click: 3, W: 2, Z: -2, N: 6, VecW: []float32{2, 0}, VecZ: []float32{1, 0},
+		VecN: []float32{2, 1}, State: []float32{1}}
+	w2 := &base.Parameter{Show: 11, Click: 2, W: 0, Z: -1.5, N: 5, VecW: []float32{0, 4}, VecZ: []float32{0, 2},
+		VecN: []float32{1, 3}}
+	p := mergeParams(prev, []*base.Parameter{w1, w2})
+	// counts and n add up, w and state are averaged, z / sqrt(n) is averaged
+	z := float32((-2/math.Sqrt(6) - 1.5/math.Sqrt(5)) / 2 * math.Sqrt(7))
+	want := &base.Parameter{Show: 14, Click: 3, W: 1, Z: z, N: 7, VecW: []float32{1, 2}, VecZ: []float32{0.5, 1},
+		VecN: []float32{2, 3}, State: []float32{0.5}}
+	if !base.EQParameter(p, want, true) || !eqState(p, want) {
+		t.Errorf("merge %v, want %v", p, want)
+	}
+	// a new key starts from zero
+	p = mergeParams(nil, []*base.Parameter{w2})
+	if !base.EQParameter(p, w2, true) || !eqState(p, w2) {
+		t.Errorf("merge of one worker %v, want %v", p, w2)
+	}
+}
+
+// _gen_signal_instance draws labels from a logistic model of random feature weights
+func _gen_signal_instance(r *rand.Rand, n int) []*base.Instance {
+	inslist := make([]*base.Instance, n)
+	for i := range inslist {
+		ins := &base.Instance{}
+		z := 0.0
+		for j := 0; j < 8; j++ {
+			slot := uint16(101 + j%4)
+			id := uint64(r.Intn(200))
+			ins.Feas = append(ins.Feas, &base.Feature{Slot: slot, Fea: uint64(slot)*1e6 + id + 1})
+			// the weight of a key is fixed by the key
+			z += math.Sin(float64(uint64(slot)*7919 + id*104729))
+		}
+		if r.Float64() < 1/(1+math.Exp(-z)) {
+			ins.Label = 1
+		}
+		inslist[i] = ins
+	}
+	return inslist
+}
+
+func logLoss(m IModel, inslist []*base.Instance) float64 {
+	res, _ := m.Predict(inslist)
+	sum := 0.0
+	for _, x := range res {
+		p := math.Min(math.Max(float64(x.Score), 1e-7), 1-1e-7)
+		if x.Label > 0 {
+			sum -= math.Log(p)
+		} else {
+			sum -= math.Log(1 - p)
+		}
+	}
+	return sum / float64(len(res))
+}
+
+func TestAverager_Convergence(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	train := _gen_signal_instance(r, 20000)
+	test := _gen_signal_instance(r, 5000)
+	batches := func(inslist []*base.Instance) [][]*base.Instance {
+		var b [][]*base.Instance
+		for i := 0; i < len(inslist); i += 100 {
+			b = append(b, inslist[i:i+100])
+		}
+		return b
+	}
+
+	single := &LRModel{}
+	single.Init(_gen_lr_config())
+	for _, b := range batches(train) {
+		single.Train(b)
+	}
+	singleLoss := logLoss(single, test)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	workers := 4
+	go NewAvgCoordinator(workers, time.Minute).Serve(l)
+	config := _gen_lr_config()
+	config.AvgCoordinator = l.Addr().String()
+	config.AvgInterval = 1000
+	models := make([]*Averager, workers)
+	alone := make([]*LRModel, workers)
+	group := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		lr := &LRModel{}
+		lr.Init(config)
+		if models[i], err = NewAverager(lr, config, i); err != nil {
+			t.Fatal(err)
+		}
+		alone[i] = &LRModel{}
+		alone[i].Init(_gen_lr_config())
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			// disjoint shards of the same data
+			for j, b := range batches(train) {
+				if j%workers == i {
+					models[i].Train(b)
+					alone[i].Train(b)
+				}
+			}
+			if err := models[i].Finish(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	group.Wait()
+	avgLoss := logLoss(models[0], test)
+	aloneLoss := logLoss(alone[0], test)
+	t.Logf("logloss: single process %.4f, averaged %d workers %.4f, one worker alone %.4f", singleLoss, workers,
+		avgLoss, aloneLoss)
+	if avgLoss > singleLoss+0.01 || avgLoss >= aloneLoss {
+		t.Errorf("averaged logloss %.4f, single process %.4f, one worker alone %.4f", avgLoss, singleLoss, aloneLoss)
+	}
+	for i := 1; i < workers; i++ {
+		if logLoss(models[i], test) != avgLoss {
+			t.Errorf("worker %d ends with another model", i)
+		}
+	}
+}
+
+func TestAvgCoordinator_Timeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go NewAvgCoordinator(2, 100*time.Millisecond).Serve(l)
+	config := _gen_lr_config()
+	config.AvgCoordinator = l.Addr().String()
+	config.AvgInterval = 2
+	lr := &LRModel{}
+	lr.Init(config)
+	a, err := NewAverager(lr, config, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// worker 1 never shows up: the first round merges worker 0 alone and later ones do not wait
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := a.Train(_gen_lr_instance()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("rounds without worker 1 took %s", d)
+	}
+	res, _ := lr.Predict(_gen_lr_instance())
+	if res[0].Score == 0.5 && res[1].Score == 0.5 {
+		t.Error("worker 0 lost its model in the merge")
+	}
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"sort"
+
+	"linearmodel/base"
+	"linearmodel/optim"
+)
+
+// gradBatch sums the gradients of a mini batch per key, so every key takes the shard lock
+// and updates once per batch. Keys are applied in ascending order.
+type gradBatch struct {
+	index map[uint64]int
+	grads []keyGrad
+}
+
+type keyGrad struct {
+	key     uint64
+	slot    uint16
+	show    int
+	click   int
+	grad    float32
+	gradVec []float32
+}
+
+func newGradBatch(capacity int) *gradBatch {
+	return &gradBatch{index: make(map[uint64]int, capacity), grads: make([]keyGrad, 0, capacity)}
+}
+
+func (g *gradBatch) add(key uint64, slot uint16, label float32, grad float32, gradVec []float32) {
+	i, ok := g.index[key]
+	if !ok {
+		i = len(g.grads)
+		g.index[key] = i
+		g.grads = append(g.grads, keyGrad{key: key, slot: slot})
+	}
+	kg := &g.grads[i]
+	kg.show += 1
+	if label > 0 {
+		kg.click += 1
+	}
+	kg.grad += grad
+	if gradVec != nil {
+		kg.gradVec = base.InPlaceVecTimeAdd(kg.gradVec, gradVec, 1.0, 1.0)
+	}
+}
+
+// batchStore is a store that takes the gradients of a batch at once
+type batchStore interface {
+	applyBatch(grads []keyGrad)
+}
+
+func (g *gradBatch) apply(model paramStore, opt optim.Optimizer) {
+	sort.Slice(g.grads, func(i, j int) bool {
+		return g.grads[i].key < g.grads[j].key
+	})
+	if b, ok := model.(batchStore); ok {
+		b.applyBatch(g.grads)
+		return
+	}
+	for i := range g.grads {
+		kg := &g.grads[i]
+		model.applyGrad(kg.key, kg.slot, kg.show, kg.click, kg.grad, kg.gradVec, opt)
+	}
+}
@@ -0,0 +1,168 @@
+package model
+
+import (
+	"math/rand"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+func _gen_bench_instance(n, feaNum, vocab int) []*base.Instance {
+	r := rand.New(rand.NewSource(0))
+	// feature frequency follows a power law like ids in click logs
+	zipf := rand.NewZipf(r, 1.1, 1.0, uint64(vocab))
+	inslist := make([]*base.Instance, n)
+	for i := range inslist {
+		ins := &base.Instance{Label: float32(r.Intn(2))}
+		for j := 0; j < feaNum; j++ {
+			slot := uint16(101 + j%4)
+			ins.Feas = append(ins.Feas, &base.Feature{Slot: slot, Fea: uint64(slot)*1e6 + zipf.Uint64() + 1})
+		}
+		inslist[i] = ins
+	}
+	return inslist
+}
+
+func TestLRModel_MiniBatch(t *testing.T) {
+	insList := _gen_lr_instance()
+	config := _gen_lr_config()
+	lr := &LRModel{}
+	lr.Init(config)
+	batchConfig := _gen_lr_config()
+	batchConfig.MiniBatch = true
+	batchLr := &LRModel{}
+	batchLr.Init(batchConfig)
+	// a batch of one instance is the same as per instance update
+	for _, ins := range insList {
+		lr.Train([]*base.Instance{ins})
+		batchLr.Train([]*base.Instance{ins})
+	}
+	lr.model.each(func(k uint64, v *base.Parameter) {
+		if !base.EQParameter(v, batchLr.model.get(k, v.Slot, false), false) {
+			t.Error("mini batch of one instance error: ", k)
+		}
+	})
+	// the batch is reduced by key: key 1 gets the sum of both instances' gradients in one update
+	batchLr = &LRModel{}
+	batchLr.Init(batchConfig)
+	batchLr.Train(insList)
+	pm := batchLr.model.get(1, 101, false)
+	if pm.Show != 2 || pm.Click != 1 || base.NEQFloat32(pm.N, 0.0) || base.NEQFloat32(pm.Z, 0.0) {
+		t.Error("mini batch reduce error: ", pm)
+	}
+}
+
+func TestFMModel_MiniBatch(t *testing.T) {
+	// a key repeated in an instance is one summed update in a batch, so every instance keeps its keys once
+	insList := _gen_bench_instance(200, 8, 20)
+	for _, ins := range insList {
+		seen := make(map[uint64]bool)
+		feas := ins.Feas[:0]
+		for _, fea := range ins.Feas {
+			if !seen[fea.Fea] {
+				seen[fea.Fea] = true
+				feas = append(feas, fea)
+			}
+		}
+		ins.Feas = feas
+	}
+	newFm := func(name string, miniBatch bool) *FMModel {
+		config := _gen_fm_config()
+		config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: 102}, &conf.FeatureConfig{SlotId: 104})
+		config.OptimConfig.Optimizer = name
+		config.Seed = 7
+		config.MiniBatch = miniBatch
+		fm := &FMModel{}
+		fm.Init(config)
+		return fm
+	}
+	for _, name := range []string{"ftrl", "adam"} {
+		fm, batchFm := newFm(name, false), newFm(name, true)
+		// batches of one instance take the same updates in both paths
+		for _, ins := range insList {
+			fm.Train([]*base.Instance{ins})
+			batchFm.Train([]*base.Instance{ins})
+		}
+		count := 0
+		fm.model.each(func(k uint64, v *base.Parameter) {
+			count++
+			p := batchFm.model.get(k, v.Slot, false)
+			if !base.EQParameter(v, p, false) || !eqState(v, p) {
+				t.Errorf("%s: mini batch of one instance differs at key %d: %v %v", name, k, v, p)
+			}
+		})
+		batchFm.model.each(func(k uint64, v *base.Parameter) {
+			count--
+		})
+		if count != 0 {
+			t.Errorf("%s: key count differs by %d", name, count)
+		}
+	}
+}
+
+func TestFMModel_MiniBatch_Deterministic(t *testing.T) {
+	insList := _gen_bench_instance(200, 8, 20)
+	config := _gen_fm_config()
+	config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: 102}, &conf.FeatureConfig{SlotId: 104})
+	config.MiniBatch = true
+	var models []*FMModel
+	for i := 0; i < 2; i++ {
+		rand.Seed(0)
+		fm := &FMModel{}
+		fm.Init(config)
+		fm.Train(insList)
+		fm.Train(insList)
+		models = append(models, fm)
+	}
+	models[0].model.each(func(k uint64, v *base.Parameter) {
+		if !base.EQParameter(v, models[1].model.get(k, v.Slot, false), false) {
+			t.Error("mini batch training is not deterministic: ", k)
+		}
+	})
+}
+
+func benchmarkTrain(b *testing.B, m IModel, insList []*base.Instance) {
+	batchSize := 200
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			start := (i * batchSize) % len(insList)
+			m.Train(insList[start : start+batchSize])
+			i++
+		}
+	})
+}
+
+func BenchmarkLRModel_Train(b *testing.B) {
+	config := _gen_lr_config()
+	lr := &LRModel{}
+	lr.Init(config)
+	benchmarkTrain(b, lr, _gen_bench_instance(10000, 40, 1000))
+}
+
+func BenchmarkLRModel_TrainMiniBatch(b *testing.B) {
+	config := _gen_lr_config()
+	config.MiniBatch = true
+	lr := &LRModel{}
+	lr.Init(config)
+	benchmarkTrain(b, lr, _gen_bench_instance(10000, 40, 1000))
+}
+
+func BenchmarkFMModel_Train(b *testing.B) {
+	config := _gen_fm_config()
+	config.OptimConfig.EmbSize = 8
+	fm := &FMModel{}
+	fm.Init(config)
+	benchmarkTrain(b, fm, _gen_bench_instance(10000, 40, 1000))
+}
+
+func BenchmarkFMModel_TrainMiniBatch(b *testing.B) {
+	config := _gen_fm_config()
+	config.OptimConfig.EmbSize = 8
+	config.MiniBatch = true
+	fm := &FMModel{}
+	fm.Init(config)
+	benchmarkTrain(b, fm, _gen_bench_instance(10000, 40, 1000))
+}
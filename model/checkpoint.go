@@ -0,0 +1,85 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+)
+
+// Checkpointer saves the model it wraps every interval while training, so that training on an
+// unbounded stream, e.g. from stdin, leaves a recent model behind. Saves pause training and
+// replace every file of the model at once, a reader never sees a half written file.
+type Checkpointer struct {
+	IModel
+	path     string
+	interval time.Duration
+
+	mu     sync.RWMutex // Train holds it shared and a save exclusively
+	last   int64        // unix nano of the last save
+	saving int32
+	count  int64 // instances trained
+}
+
+// NewCheckpointer saves m to path every interval of training
+func NewCheckpointer(m IModel, path string, interval time.Duration) *Checkpointer {
+	return &Checkpointer{IModel: m, path: path, interval: interval, last: time.Now().UnixNano()}
+}
+
+func (c *Checkpointer) Train(inslist []*base.Instance) error {
+	c.mu.RLock()
+	err := c.IModel.Train(inslist)
+	c.mu.RUnlock()
+	atomic.AddInt64(&c.count, int64(len(inslist)))
+	if time.Duration(time.Now().UnixNano()-atomic.LoadInt64(&c.last)) < c.interval {
+		return err
+	}
+	// one of the training threads saves, the others go on until it locks
+	if !atomic.CompareAndSwapInt32(&c.saving, 0, 1) {
+		return err
+	}
+	defer atomic.StoreInt32(&c.saving, 0)
+	t := time.Now()
+	if e := c.Save(c.path); e != nil {
+		glog.Errorf("checkpoint %s error: %v", c.path, e)
+	} else {
+		glog.Infof("checkpoint %s after %d instances, time: [%s]", c.path, atomic.LoadInt64(&c.count),
+			time.Now().Sub(t))
+	}
+	atomic.StoreInt64(&c.last, time.Now().UnixNano())
+	return err
+}
+
+// Save writes the model into a temporary directory next to path, with training paused, and then
+// renames every file written there, e.g. the task files of mtfm, over the files of path. The
+// file of path itself is renamed last.
+func (c *Checkpointer) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dir, name := filepath.Split(path)
+	tmp, err := os.MkdirTemp(dir, "."+name+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := c.IModel.Save(filepath.Join(tmp, name)); err != nil {
+		return err
+	}
+	files, err := os.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.Name() != name {
+			if err := os.Rename(filepath.Join(tmp, f.Name()), filepath.Join(dir, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(filepath.Join(tmp, name), path)
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"linearmodel/base"
+)
+
+func TestCheckpointer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model")
+	lr := &LRModel{}
+	lr.Init(_gen_lr_config())
+	c := NewCheckpointer(lr, path, time.Hour)
+	c.Train(_gen_lr_instance())
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("saved before the interval")
+	}
+
+	c = NewCheckpointer(lr, path, time.Nanosecond)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				c.Train(_gen_lr_instance())
+			}
+		}()
+	}
+	wg.Wait()
+	if files, _ := os.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Errorf("temporary files left behind: %v", files)
+	}
+	// the checkpoint is a model of the trained keys
+	loaded := &LRModel{}
+	loaded.Init(_gen_lr_config())
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []uint64{1, 2, 3, 21, 22} {
+		if loaded.model.get(k, 0, false) == nil {
+			t.Errorf("key %d missing in the checkpoint", k)
+		}
+	}
+}
+
+func TestCheckpointer_FFM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model")
+	ffm := &FFMModel{}
+	ffm.Init(_gen_ffm_config())
+	c := NewCheckpointer(ffm, path, time.Nanosecond)
+	c.Train(_gen_ffm_instance())
+	if files, _ := os.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Errorf("want the model file only, got %v", files)
+	}
+	loaded := &FFMModel{}
+	loaded.Init(_gen_ffm_config())
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	ffm.model.each(func(k uint64, v *base.Parameter) {
+		if p := loaded.model.get(k, v.Slot, false); p == nil || !base.EQParameter(v, p, false) {
+			t.Errorf("checkpoint differs at key %d: %v %v", k, v, p)
+		}
+	})
+}
+
+func TestCheckpointer_MTFM(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model")
+	mt := &MTFMModel{}
+	mt.Init(_gen_mtfm_config(false))
+	c := NewCheckpointer(mt, path, time.Nanosecond)
+	c.Train(_gen_mtfm_instance())
+	c.Train(_gen_mtfm_instance())
+	files, _ := os.ReadDir(filepath.Dir(path))
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	if want := []string{"model", "model.ctr", "model.cvr"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("checkpoint files %v, want %v", names, want)
+	}
+	loaded := &MTFMModel{}
+	loaded.Init(_gen_mtfm_config(false))
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	for i, task := range mt.tasks {
+		count := 0
+		task.each(func(k uint64, v *base.Parameter) {
+			count++
+			if p := loaded.tasks[i].get(k, v.Slot, false); p == nil || !base.EQParameter(v, p, false) {
+				t.Errorf("task %d of the checkpoint differs at key %d: %v %v", i, k, v, p)
+			}
+		})
+		if count == 0 {
+			t.Errorf("task %d has no key", i)
+		}
+	}
+}
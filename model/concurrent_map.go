@@ -1,11 +1,7 @@
 package model
 
 import (
-	"bufio"
-	"fmt"
-	"os"
-	"strconv"
-	"strings"
+	"sort"
 	"sync"
 
 	"github.com/golang/glog"
@@ -23,9 +19,8 @@ type concurrentMap struct {
 	modelData [concurrentCount]*submap
 	bias_lock sync.Mutex
 	bias      *base.Parameter
-	size      uint32
-	norm      float32
 	eval      bool
+	slotTable
 }
 
 func NewConcurrentMap(cap uint64, size uint32) *concurrentMap {
@@ -45,6 +40,10 @@ func (b *concurrentMap) init(cap uint64, size uint32) error {
 	return nil
 }
 
+func (b *concurrentMap) newParameter(key uint64, slot uint16) *base.Parameter {
+	return base.NewParameterWithVec(b.newVec(key, slot))
+}
+
 func (b *concurrentMap) lock(key uint64) {
 	b.modelData[key%concurrentCount].mutex.Lock()
 }
@@ -53,7 +52,7 @@ func (b *concurrentMap) unlock(key uint64) {
 	b.modelData[key%concurrentCount].mutex.Unlock()
 }
 
-func (b *concurrentMap) update(key uint64, slot uint16, label int, grad float32, opt optim.Optimizer) {
+func (b *concurrentMap) update(key uint64, slot uint16, label float32, grad float32, opt optim.Optimizer) {
 	//key uint64, slot uint16
 	if key == 0 {
 		opt.Update(grad, b.bias)
@@ -67,16 +66,19 @@ func (b *concurrentMap) update(key uint64, slot uint16, label int, grad float32,
 		return
 	}
 	p.Show += 1
-	p.Click += label
+	if label > 0 {
+		p.Click += 1
+	}
 	opt.Update(grad, p)
 	return
 }
 
-func (b *concurrentMap) updateEmb(key uint64, slot uint16, label int, grad []float32, opt optim.Optimizer) {
+func (b *concurrentMap) updateEmb(key uint64, slot uint16, label float32, grad []float32, opt optim.Optimizer) {
 	b.lock(key)
 	p, ok := b.modelData[key%concurrentCount].data[key]
 	b.unlock(key)
-	if !ok || len(p.VecW) != int(b.size) || len(p.VecN) != int(b.size) || len(p.VecZ) != int(b.size) {
+	size, _ := b.sizeOf(slot)
+	if !ok || len(p.VecW) != int(size) || len(p.VecN) != int(size) || len(p.VecZ) != int(size) {
 		glog.Errorf(">>>> update parameter before exist: key=%d, slot=%d, w=%d, n=%d, z=%d", key, slot,
 			len(p.VecW), len(p.VecN), len(p.VecZ))
 		return
@@ -86,7 +88,7 @@ func (b *concurrentMap) updateEmb(key uint64, slot uint16, label int, grad []flo
 	opt.UpdateEmb(grad, p)
 }
 
-func (b *concurrentMap) updateWeightAndEmb(key uint64, slot uint16, label int, grad float32, gradVec []float32, opt optim.Optimizer) {
+func (b *concurrentMap) updateWeightAndEmb(key uint64, slot uint16, label float32, grad float32, gradVec []float32, opt optim.Optimizer) {
 	if key == 0 {
 		opt.Update(grad, b.bias)
 		return
@@ -94,27 +96,53 @@ func (b *concurrentMap) updateWeightAndEmb(key uint64, slot uint16, label int, g
 	b.lock(key)
 	p, ok := b.modelData[key%concurrentCount].data[key]
 	b.unlock(key)
-	if !ok || len(p.VecW) != int(b.size) || len(p.VecN) != int(b.size) || len(p.VecZ) != int(b.size) {
+	size, _ := b.sizeOf(slot)
+	if !ok || len(p.VecW) != int(size) || len(p.VecN) != int(size) || len(p.VecZ) != int(size) {
 		glog.Errorf(">>>> update parameter before exist: key=%d, slot=%d, w=%d, n=%d, z=%d", key, slot,
 			len(p.VecW), len(p.VecN), len(p.VecZ))
 		return
 	}
 	p.Show += 1
-	p.Click += label
+	if label > 0 {
+		p.Click += 1
+	}
 	opt.Update(grad, p)
 	opt.UpdateEmb(gradVec, p)
 }
 
+// applyGrad updates a key with the summed gradient of show instances, gradVec may be nil
+func (b *concurrentMap) applyGrad(key uint64, slot uint16, show, click int, grad float32, gradVec []float32,
+	opt optim.Optimizer) {
+	if key == 0 {
+		opt.Update(grad, b.bias)
+		return
+	}
+	b.lock(key)
+	p, ok := b.modelData[key%concurrentCount].data[key]
+	b.unlock(key)
+	if !ok {
+		glog.Errorf(">>>> update parameter before exist: key=%d, slot=%d", key, slot)
+		return
+	}
+	p.Show += show
+	p.Click += click
+	opt.Update(grad, p)
+	if gradVec != nil {
+		opt.UpdateEmb(gradVec, p)
+	}
+}
+
 func (b *concurrentMap) getWeight(key uint64, slot uint16, text string, needInit bool) *base.Weight {
 	if key == 0 {
 		p := b.bias
 		return &base.Weight{W: p.W}
 	}
-	w := base.Weight{W: 0.0, VecW: make([]float32, b.size)}
+	size, _ := b.sizeOf(slot)
+	w := base.Weight{W: 0.0, VecW: make([]float32, size)}
 	b.lock(key)
 	p := b.modelData[key%concurrentCount].data[key]
 	if p == nil && needInit {
-		p = base.NewParameter(b.size, b.norm)
+		p = b.newParameter(key, slot)
 		p.Slot = slot
 		p.Fea = key
 		p.Text = base.DeepCopyString(text)
@@ -138,7 +166,7 @@ func (b *concurrentMap) get(key uint64, slot uint16, needInit bool) *base.Parame
 	b.lock(key)
 	p := b.modelData[key%concurrentCount].data[key]
 	if p == nil && needInit {
-		p = base.NewParameter(b.size, b.norm)
+		p = b.newParameter(key, slot)
 		p.Slot = slot
 		p.Fea = key
 		b.modelData[key%concurrentCount].data[key] = p
@@ -159,103 +187,39 @@ func (b *concurrentMap) set(key uint64, parameter *base.Parameter) {
 	b.unlock(key)
 }
 
-func (b *concurrentMap) save(p string, info string) error {
-	f, err := os.Create(p)
-	defer f.Close()
-	wr := bufio.NewWriter(f)
-	if err != nil {
-		glog.Errorf("creat path: %s fail", p)
-		return err
-	}
-	wr.WriteString(info + "\n")
-	wr.WriteString(fmt.Sprintf("0\t%.8f\n", b.bias.W))
-	wr.Flush()
+// each calls f on every parameter other than the bias, in key order inside a shard when seeded
+// each copies the keys and parameters of a shard under its lock before calling f, so keys may be
+// inserted while it runs
+func (b *concurrentMap) each(f func(key uint64, p *base.Parameter)) {
 	for _, x := range b.modelData {
+		x.mutex.Lock()
+		params := make([]*base.Parameter, 0, len(x.data))
+		keys := make([]uint64, 0, len(x.data))
 		for k, v := range x.data {
-			wr.WriteString(fmt.Sprintf("%s\t%d\t%d\t%.7f\t%s\n", v.Text, v.Slot, k, v.W, base.VecToString(v.VecW)))
+			keys = append(keys, k)
+			params = append(params, v)
+		}
+		x.mutex.Unlock()
+		if b.seed != 0 {
+			sort.Sort(keyParams{keys, params})
+		}
+		for i, k := range keys {
+			f(k, params[i])
 		}
 	}
-	wr.Flush()
-	return nil
 }
 
-//
-func (b *concurrentMap) load(p string, size int) error {
-	f, err := os.Open(p)
-	defer f.Close()
-	if err != nil {
-		glog.Errorf("load path error: %s", err)
-		return err
-	}
-	r := bufio.NewReader(f)
-	// skip first line
-	_, err = r.ReadString('\n')
-	if err != nil {
-		glog.Error("read meta info error")
-	}
-	biasLine, err := r.ReadString('\n')
-	if err != nil {
-		glog.Error("read bias info error")
-	}
-	line := strings.TrimSuffix(biasLine, "\n")
-	row := strings.Split(line, "\t")
-	if len(row) != 2 {
-		return fmt.Errorf("bias term parse error")
-	}
-	k, err := strconv.ParseUint(row[0], 10, 64)
-	if err != nil {
-		glog.Errorf("parse k error")
-		return err
-	}
-	biasW, err := strconv.ParseFloat(row[1], 64)
-	if err != nil {
-		return err
-	}
-	pm := new(base.Parameter)
-	pm.W = float32(biasW)
-	b.set(k, pm)
+// keyParams sorts parameters by key
+type keyParams struct {
+	keys   []uint64
+	params []*base.Parameter
+}
 
-	count := 0
-	for {
-		bt, err := r.ReadString('\n')
-		// fmt.Println(string(bt), err)
-		count++
-		if err != nil {
-			break
-		}
-		line := strings.TrimSuffix(bt, "\n")
-		row := strings.Split(line, "\t")
-		if len(row) != 5 {
-			glog.Errorf("wrong line[%d]: %s in file %s", count, line, p)
-		}
-		text := base.DeepCopyString(row[0])
-		slot, err := strconv.ParseUint(row[1], 10, 64)
-		if err != nil {
-			glog.Errorf("wrong key[%d]: %s in file %s, err=%s", count, row[1], p, err)
-			continue
-		}
-		key, err := strconv.ParseUint(row[2], 10, 64)
-		if err != nil {
-			glog.Errorf("wrong key[%d]: %s in file %s, err=%s", count, row[2], p, err)
-			continue
-		}
-		val, err := strconv.ParseFloat(row[3], 10)
-		if err != nil {
-			glog.Errorf("wrong key[%d]: %s in file %s, err=%s", count, row[3], p, err)
-			continue
-		}
-		vec, err := base.StringToVec(row[4], size)
-		if err != nil {
-			glog.Errorf("parse vec error %v", err)
-		}
-		pm := new(base.Parameter)
-		pm.Slot = uint16(slot)
-		pm.Text = text
-		pm.W = float32(val)
-		pm.VecW = vec
-		b.set(key, pm)
-	}
-	return nil
+func (x keyParams) Len() int           { return len(x.keys) }
+func (x keyParams) Less(i, j int) bool { return x.keys[i] < x.keys[j] }
+func (x keyParams) Swap(i, j int) {
+	x.keys[i], x.keys[j] = x.keys[j], x.keys[i]
+	x.params[i], x.params[j] = x.params[j], x.params[i]
 }
 
 //
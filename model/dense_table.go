@@ -0,0 +1,148 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// denseTable is the entryTable of hashed slots: every bucket of every slot has its entry at a
+// fixed offset of one preallocated array, so there is no key lookup and the memory is known at
+// start. Keys are slot * KMAXSIGN + bucket, texts are not kept since a bucket mixes many features.
+// An insert of a key outside the buckets fails and err returns the failure.
+type denseTable struct {
+	slots    map[uint16]denseSlot // read only after newDenseTable
+	order    []uint16             // slots in id order
+	data     []float32
+	used     []uint32 // 1 once the entry of a bucket is inserted
+	locks    [arenaShards]paddedLock
+	biasData []float32
+
+	mu     sync.Mutex
+	failed error // first insert failure since the last err
+}
+
+type denseSlot struct {
+	buckets uint64
+	first   uint64 // index of the first bucket in used
+	offset  uint64 // float offset of the first entry in data
+	entry   uint64 // floats of an entry
+}
+
+// newDenseTable preallocates the buckets of every slot, entry gives the floats of an entry of a slot
+func newDenseTable(config *conf.AllConfig, entry func(x *conf.FeatureConfig) int) (*denseTable, error) {
+	t := &denseTable{slots: make(map[uint16]denseSlot)}
+	var buckets, floats uint64
+	for _, x := range config.FeatureList {
+		n := conf.HashBuckets(config, x)
+		if n == 0 {
+			return nil, fmt.Errorf("dense param_store needs hash_buckets of slot %d", x.SlotId)
+		}
+		slot := uint16(x.SlotId)
+		if _, ok := t.slots[slot]; ok {
+			continue
+		}
+		ds := denseSlot{buckets: n, first: buckets, offset: floats, entry: uint64(entry(x))}
+		t.slots[slot] = ds
+		t.order = append(t.order, slot)
+		buckets += n
+		floats += n * ds.entry
+	}
+	sort.Slice(t.order, func(i, j int) bool {
+		return t.order[i] < t.order[j]
+	})
+	glog.Infof("dense store of %d buckets, %d MB", buckets, floats*4>>20)
+	t.data = make([]float32, floats)
+	t.used = make([]uint32, buckets)
+	return t, nil
+}
+
+func (t *denseTable) bias(n int) []float32 {
+	t.biasData = make([]float32, n)
+	return t.biasData
+}
+
+// locate returns the slot and bucket of key, ok is false for a key outside the hashed slots
+func (t *denseTable) locate(key uint64) (denseSlot, uint64, bool) {
+	ds, ok := t.slots[uint16(key/base.KMAXSIGN)]
+	bucket := key % base.KMAXSIGN
+	if !ok || bucket >= ds.buckets {
+		return ds, 0, false
+	}
+	return ds, bucket, true
+}
+
+func (t *denseTable) entry(ds denseSlot, bucket uint64) []float32 {
+	start := ds.offset + bucket*ds.entry
+	e := t.data[start : start+ds.entry]
+	n := entrySize(e)
+	return e[:n:n]
+}
+
+func (t *denseTable) lookup(key, h uint64) []float32 {
+	ds, bucket, ok := t.locate(key)
+	if !ok || atomic.LoadUint32(&t.used[ds.first+bucket]) == 0 {
+		return nil
+	}
+	return t.entry(ds, bucket)
+}
+
+func (t *denseTable) insert(key, h uint64, n int, text string, init func(e []float32)) []float32 {
+	ds, bucket, ok := t.locate(key)
+	if !ok {
+		t.fail(fmt.Errorf("key %d is not in a hashed slot of the dense store", key))
+		return nil
+	}
+	if uint64(n) > ds.entry {
+		t.fail(fmt.Errorf("entry of %d floats does not fit the dense store entry of %d", n, ds.entry))
+		return nil
+	}
+	i := ds.first + bucket
+	l := &t.locks[i%arenaShards].spinLock
+	l.lock()
+	defer l.unlock()
+	if atomic.LoadUint32(&t.used[i]) == 0 {
+		start := ds.offset + bucket*ds.entry
+		init(t.data[start : start+uint64(n) : start+uint64(n)])
+		atomic.StoreUint32(&t.used[i], 1)
+	}
+	return t.entry(ds, bucket)
+}
+
+func (t *denseTable) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed == nil {
+		t.failed = err
+	}
+}
+
+func (t *denseTable) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.failed
+	t.failed = nil
+	return err
+}
+
+func (t *denseTable) text(key, h uint64, e []float32) string {
+	return ""
+}
+
+// each visits the used buckets, which are always in key order
+func (t *denseTable) each(sorted bool, f func(key uint64, e []float32)) {
+	for _, slot := range t.order {
+		ds := t.slots[slot]
+		for b := uint64(0); b < ds.buckets; b++ {
+			if atomic.LoadUint32(&t.used[ds.first+b]) != 0 {
+				f(uint64(slot)*base.KMAXSIGN+b, t.entry(ds, b))
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+	"linearmodel/dataloader"
+)
+
+// embInit creates the embedding of a new key, see emb_init in OptimConfig
+type embInit struct {
+	kind   string
+	scale  float32 // uniform half range or truncated normal stddev, 0 keeps (-0.5, 0.5) / norm
+	fields int     // number of slots, fan in of xavier and he
+	seed   uint64  // non zero seed draws from a hash of the key instead of the global random source
+
+	// pretrained embeddings by key, read only after newEmbInit
+	pretrained map[uint64][]float32
+}
+
+// newEmbInit checks the init scheme and loads emb_init_file, sizeOf gives the embedding size of a slot
+func newEmbInit(config *conf.AllConfig, sizeOf func(slot uint16) (uint32, float32)) (*embInit, error) {
+	e := &embInit{
+		kind:   config.OptimConfig.GetEmbInit(),
+		scale:  config.OptimConfig.GetEmbInitScale(),
+		fields: len(config.FeatureList),
+		seed:   config.Seed,
+	}
+	switch e.kind {
+	case "", "uniform", "zero", "truncated_normal", "xavier", "he":
+	default:
+		return nil, fmt.Errorf("unknown emb_init: %s", e.kind)
+	}
+	path := config.OptimConfig.GetEmbInitFile()
+	if e.kind == "zero" && path == "" {
+		// the gradient of an embedding is the sum of the others, all zero embeddings stay zero
+		return nil, fmt.Errorf("emb_init zero needs emb_init_file, all zero embeddings are never learned")
+	}
+	if e.fields == 0 {
+		e.fields = 1
+	}
+	if path != "" {
+		loader := new(dataloader.DataLoader)
+		if err := loader.InitConfig(config); err != nil {
+			return nil, err
+		}
+		pretrained, err := loadPretrained(path, loader.FeatureKey, sizeOf)
+		if err != nil {
+			return nil, err
+		}
+		e.pretrained = pretrained
+	}
+	return e, nil
+}
+
+// vec returns the initial embedding of key, norm is the legacy uniform norm of the slot
+func (e *embInit) vec(key uint64, size uint32, norm float32) []float32 {
+	if v, ok := e.pretrained[key]; ok {
+		vec := make([]float32, size)
+		copy(vec, v)
+		return vec
+	}
+	next := rand.Float64
+	if e.seed != 0 {
+		next = base.HashSource(key, e.seed)
+	}
+	switch e.kind {
+	case "zero":
+		return make([]float32, size)
+	case "truncated_normal":
+		stddev := e.scale
+		if stddev == 0 {
+			stddev = 1.0 / norm
+		}
+		return base.TruncNormalVec32(size, stddev, next)
+	case "xavier":
+		return base.TruncNormalVec32(size, float32(math.Sqrt(2.0/float64(e.fields+int(size)))), next)
+	case "he":
+		return base.TruncNormalVec32(size, float32(math.Sqrt(2.0/float64(e.fields))), next)
+	}
+	if e.scale != 0 {
+		return base.UniformVec32(size, e.scale, next)
+	}
+	if e.seed != 0 {
+		return base.HashVec32(key, e.seed, size, norm)
+	}
+	return base.RandVec32(size, norm)
+}
+
+// loadPretrained reads "slot\ttext\tv1,v2,..." lines, key gives the key of a feature as the dataloader makes it.
+// Lines of features the dataloader drops, e.g. of slots out of the feature list, are counted and skipped.
+func loadPretrained(path string, key func(slot uint16, text string) (uint64, error),
+	sizeOf func(slot uint16) (uint32, float32)) (map[uint64][]float32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pretrained := make(map[uint64][]float32)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	count, skipped := 0, 0
+	for scanner.Scan() {
+		count++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		row := strings.Split(line, "\t")
+		if len(row) != 3 {
+			return nil, fmt.Errorf("wrong line[%d] in %s: want slot, text and vector", count, path)
+		}
+		slot, err := strconv.ParseUint(row[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("wrong slot[%d] in %s: %s", count, path, err)
+		}
+		fea, err := key(uint16(slot), row[1])
+		if err != nil {
+			if skipped == 0 {
+				glog.Warningf("skip line[%d] in %s: %v", count, path, err)
+			}
+			skipped++
+			continue
+		}
+		size, _ := sizeOf(uint16(slot))
+		vec, err := base.StringToVec(row[2], int(size))
+		if err != nil {
+			return nil, fmt.Errorf("wrong vector[%d] in %s, want size %d: %s", count, path, size, err)
+		}
+		pretrained[fea] = vec
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	glog.Infof("load %d pretrained embeddings from %s, skip %d lines of no feature", len(pretrained), path, skipped)
+	return pretrained, nil
+}
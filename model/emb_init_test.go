@@ -0,0 +1,133 @@
+package model
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/dataloader"
+)
+
+func TestEmbInit_Schemes(t *testing.T) {
+	for _, kind := range []string{"uniform", "truncated_normal", "xavier", "he"} {
+		config := _gen_fm_config()
+		config.OptimConfig.EmbSize = 64
+		config.OptimConfig.EmbInit = kind
+		config.OptimConfig.EmbInitScale = 0.1
+		config.Seed = 3
+		fm := &FMModel{}
+		if err := fm.Init(config); err != nil {
+			t.Fatal(kind, err)
+		}
+		vec := fm.model.getWeight(42, 101, "", true).VecW
+		if len(vec) != 64 {
+			t.Fatalf("%s: vec size %d", kind, len(vec))
+		}
+		var bound float64
+		switch kind {
+		case "uniform":
+			bound = 0.1
+		case "truncated_normal":
+			bound = 0.2
+		case "xavier":
+			bound = 2 * math.Sqrt(2.0/float64(4+64))
+		case "he":
+			bound = 2 * math.Sqrt(2.0/4)
+		}
+		nonZero := 0
+		for _, v := range vec {
+			if math.Abs(float64(v)) > bound {
+				t.Errorf("%s: %v out of bound %v", kind, v, bound)
+			}
+			if v != 0 {
+				nonZero++
+			}
+		}
+		if nonZero == 0 {
+			t.Errorf("%s: all zero", kind)
+		}
+	}
+
+	config := _gen_fm_config()
+	config.OptimConfig.EmbInit = "zero"
+	if err := (&FMModel{}).Init(config); err == nil {
+		t.Error("zero emb_init without emb_init_file should fail")
+	}
+
+	config = _gen_fm_config()
+	config.OptimConfig.EmbInit = "gaussian"
+	if err := (&FMModel{}).Init(config); err == nil {
+		t.Error("unknown emb_init should fail")
+	}
+}
+
+func TestEmbInit_Pretrained(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emb")
+	data := "101\tuser_a\t0.5,-0.25\n201\titem_b\t1,2\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := _gen_fm_config()
+	config.OptimConfig.EmbInit = "zero"
+	config.OptimConfig.EmbInitFile = path
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	fea := base.Feature{Slot: 101, Text: "user_a"}
+	fea.Encode()
+	vec := fm.model.getWeight(fea.Fea, fea.Slot, fea.Text, true).VecW
+	if base.NEQFloat32(vec[0], 0.5) || base.NEQFloat32(vec[1], -0.25) {
+		t.Errorf("pretrained vec %v", vec)
+	}
+	// text of another slot is another key
+	fea = base.Feature{Slot: 103, Text: "user_a"}
+	fea.Encode()
+	vec = fm.model.getWeight(fea.Fea, fea.Slot, fea.Text, true).VecW
+	if vec[0] != 0 || vec[1] != 0 {
+		t.Errorf("missing key should fall back to emb_init, got %v", vec)
+	}
+
+	if err := os.WriteFile(path, []byte("101\tuser_a\t0.5,-0.25,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&FMModel{}).Init(config); err == nil {
+		t.Error("vector size different from emb_size should fail")
+	}
+}
+
+func TestEmbInit_PretrainedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "emb")
+	data := "101\tuser_a\t0.5,-0.25\n301\tuser_a|item_b\t1,2\n999\tuser_a\t3,4\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buckets := uint64(1000)
+	config := _gen_fm_config()
+	config.FeatureList[0].HashBuckets = &buckets
+	config.FeatureList[3].CrossOf = []uint64{101, 201}
+	config.OptimConfig.EmbInit = "zero"
+	config.OptimConfig.EmbInitFile = path
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	loader := new(dataloader.DataLoader)
+	if err := loader.InitConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	ins := loader.ParseIns([]string{"1\t101:user_a 201:item_b\n"})
+	if len(ins) != 1 || len(ins[0].Feas) != 3 {
+		t.Fatalf("parse %v", ins)
+	}
+	want := map[uint16][]float32{101: {0.5, -0.25}, 201: {0, 0}, 301: {1, 2}}
+	for _, x := range ins[0].Feas {
+		vec := fm.model.getWeight(x.Fea, x.Slot, x.Text, true).VecW
+		if !reflect.DeepEqual(vec, want[x.Slot]) {
+			t.Errorf("slot %d: pretrained vec %v, want %v", x.Slot, vec, want[x.Slot])
+		}
+	}
+}
@@ -7,13 +7,16 @@ import (
 
 	"linearmodel/base"
 	"linearmodel/conf"
+	"linearmodel/loss"
 	"linearmodel/optim"
 )
 
 type FFMModel struct {
-	model *concurrentMap
-	optim *optim.Ftrl
-	conf  *conf.AllConfig
+	model    paramStore
+	optim    optim.Optimizer
+	schedule *optim.Schedule
+	loss     loss.Loss
+	conf     *conf.AllConfig
 
 	// new field info
 	field_vec     []int16
@@ -33,8 +36,12 @@ type FFMModel struct {
 
 //
 func (ffm *FFMModel) Init(conf *conf.AllConfig) error {
-	ffm.optim = new(optim.Ftrl)
-	ffm.optim.Init(conf.OptimConfig)
+	if loss.IsRanking(conf.LossConfig) {
+		return fmt.Errorf("ffm does not support ranking loss")
+	}
+	ffm.schedule = optim.NewSchedule(conf.OptimConfig)
+	ffm.optim = optim.NewOptimizer(conf.OptimConfig, conf.FeatureList, ffm.schedule)
+	ffm.loss = loss.NewLoss(conf.LossConfig)
 	ffm.conf = conf
 
 	ffm.field_vec = []int16{}
@@ -71,6 +78,9 @@ func (ffm *FFMModel) Init(conf *conf.AllConfig) error {
 		ffm.field_to_side[uint64(field)] = side
 
 		ffm.slot_map[uint16(slot)] = true
+		if x.EmbSize != nil {
+			glog.Warningf("ffm does not support per slot emb_size, ignored for slot %d", slot)
+		}
 	}
 
 	ffm.num_of_field = len(slot_dict)
@@ -97,16 +107,28 @@ func (ffm *FFMModel) Init(conf *conf.AllConfig) error {
 		}
 	}
 
-	ffm.model = NewConcurrentMap(uint64(MODELCAP), ffm.full_size)
-	return nil
+	model, err := newParamStore(conf, "", ffm.full_size, float32(ffm.full_size), ffm.optim)
+	if err != nil {
+		return err
+	}
+	ffm.model = model
+	return ffm.model.initEmb(conf)
 }
 
-func (ffm *FFMModel) Save(path string) error {
-	err := ffm.model.load(path, int(ffm.full_size))
+func (ffm *FFMModel) Load(path string) error {
+	err := loadStore(ffm.model, path, ffm.schedule)
 	return err
 }
 
-func (ffm *FFMModel) Load(path string) error {
+func (ffm *FFMModel) paramStores() map[string]paramStore {
+	return map[string]paramStore{"": ffm.model}
+}
+
+func (ffm *FFMModel) Close() error {
+	return closeStores(ffm.model)
+}
+
+func (ffm *FFMModel) Save(path string) error {
 	metaLine := fmt.Sprintf("%d\t%d\t", ffm.emb_size, ffm.num_of_field)
 	n := len(ffm.conf.FeatureList)
 	for i, feaInfo := range ffm.conf.FeatureList {
@@ -116,7 +138,7 @@ func (ffm *FFMModel) Load(path string) error {
 			metaLine += "\t"
 		}
 	}
-	err := ffm.model.save(path, metaLine)
+	err := saveStore(ffm.model, path, metaLine, ffm.schedule)
 	return err
 }
 
@@ -128,18 +150,23 @@ func (ffm *FFMModel) Eval(p bool) {
 func (ffm *FFMModel) Predict(inslist []*base.Instance) ([]base.Result, error) {
 	n := len(inslist)
 	res := make([]base.Result, n, n)
+	release := pullBatch(inslist, false, ffm.model)
 	for i, ins := range inslist {
-		x, _ := ffm.predictz(ins, false)
-		res[i] = base.Result{UserId: ins.UserId, Label: ins.Label, Score: x}
+		z, _ := ffm.predictz(ins, false)
+		res[i] = base.Result{UserId: ins.UserId, Label: ins.Label, Score: ffm.loss.Predict(z)}
 	}
-	return res, nil
+	release()
+	return res, storeErr(ffm.model)
 }
 
 func (ffm *FFMModel) Train(inslist []*base.Instance) error {
+	ffm.schedule.Advance(len(inslist))
+	release := pullBatch(inslist, true, ffm.model)
 	for _, ins := range inslist {
 		ffm.train(ins)
 	}
-	return nil
+	release()
+	return storeErr(ffm.model)
 }
 
 func (ffm *FFMModel) predictz(ins *base.Instance, initial bool) (float32, [][]float32) {
@@ -164,8 +191,10 @@ func (ffm *FFMModel) predictz(ins *base.Instance, initial bool) (float32, [][]fl
 		field := ffm.slot_to_field[uint64(slot)]
 
 		if field > 0 {
-			ffm_vec = ffm.inplaceAddFFM(ffm_vec, param[i].VecW, int(field))
-			ffm_norm = ffm.inplaceAddNorm(ffm_norm, param[i].VecW, int(field)) // self fm interaction term norm
+			// numeric features enter the interactions as v*x
+			vec := scaleVec(param[i].VecW, ins.Feas[i].Val())
+			ffm_vec = ffm.inplaceAddFFM(ffm_vec, vec, int(field))
+			ffm_norm = ffm.inplaceAddNorm(ffm_norm, vec, int(field)) // self fm interaction term norm
 		}
 	}
 
@@ -181,31 +210,30 @@ func (ffm *FFMModel) predictz(ins *base.Instance, initial bool) (float32, [][]fl
 	}
 	z := ffm.model.getWeight(0, 0, "", false).W
 	for i := 0; i < n; i++ {
-		z += param[i].W
+		x := ins.Feas[i].Val()
+		z += param[i].W * x
 		field := ffm.slot_to_field[uint64(ins.Feas[i].Slot)]
 		if field > 0 {
-			grad_vec[i] = ffm.calcGrad(int(field), ffm_vec, param[i].VecW)
+			// dz/dv = x * dz/d(v*x)
+			grad_vec[i] = scaleVec(ffm.calcGrad(int(field), ffm_vec, scaleVec(param[i].VecW, x)), x)
 		}
 	}
 	z += float32(ffm_score + fm_score/2.0)
-	return base.Sigmoid32(z), grad_vec
+	return z, grad_vec
 }
 
 func (ffm *FFMModel) train(ins *base.Instance) {
 	//glog.V(5).Info(">>> [train] input ins: ", ins.String())
-	p, ffmGrad := ffm.predictz(ins, true)
-	curGrad := p
+	z, ffmGrad := ffm.predictz(ins, true)
 	label := ins.Label
-	if label > 0 {
-		curGrad -= 1.0
-	}
+	curGrad := ffm.loss.Gradient(z, label)
 	opt := ffm.optim
 	m := len(ins.Feas)
 	ffm.model.update(0, 0, label, curGrad, opt)
 	for j := 0; j < m; j++ {
 		key := ins.Feas[j].Fea
 		slot := ins.Feas[j].Slot
-		ffm.model.update(key, slot, label, curGrad, opt)
+		ffm.model.update(key, slot, label, curGrad*ins.Feas[j].Val(), opt)
 	}
 	for j := 0; j < m; j++ {
 		key := ins.Feas[j].Fea
@@ -227,6 +255,14 @@ func (ffm *FFMModel) buildGrad(field int, grad float32, ffmGrad []float32) []flo
 	return gradVec
 }
 
+// scaleVec returns v times x, v itself when x is 1
+func scaleVec(v []float32, x float32) []float32 {
+	if x == 1 {
+		return v
+	}
+	return base.InPlaceVecTimeAdd(make([]float32, len(v)), v, 0, x)
+}
+
 func (ffm *FFMModel) inplaceAddFFM(vecFfm []float32, vecW []float32, field int) []float32 {
 	size := int(ffm.emb_size) * ffm.num_of_field
 	startIndex := size * (field - 1)
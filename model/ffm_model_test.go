@@ -2,6 +2,7 @@ package model
 
 import (
 	"math/rand"
+	"path/filepath"
 	"testing"
 
 	"linearmodel/base"
@@ -49,6 +50,10 @@ func TestFFMModel_Init(t *testing.T) {
 	if int(ffm.full_size) != int(ffm.num_of_field)*int(config.OptimConfig.EmbSize) {
 		t.Error("full size error")
 	}
+	config.LossConfig = &conf.LossConfig{Name: "bpr"}
+	if err := new(FFMModel).Init(config); err == nil {
+		t.Error("ranking loss should fail")
+	}
 }
 
 func TestFFMModel_Train(t *testing.T) {
@@ -88,7 +93,7 @@ func TestFFMModel_Train(t *testing.T) {
 			VecZ: []float32{0.0325161, 0.0038293, -0.0183388, 0.0065225, 0.0004638, -0.0094504},
 			VecN: []float32{0.0008251, 0.0000130, 0.0004306, 0.0000499, 0.0000002, 0.0000977}},
 	}
-	if !base.EQParameter(trueParameters[0], ffm.model.bias, false) {
+	if !base.EQParameter(trueParameters[0], ffm.model.get(0, 0, false), false) {
 		t.Error("bias term not the same")
 	}
 	for k, v := range trueParameters {
@@ -126,7 +131,7 @@ func TestFFMModel_Train(t *testing.T) {
 			VecZ: []float32{0.0615860, 0.0131866, -0.0094692, 0.0043040, 0.0053555, -0.0070492},
 			VecN: []float32{0.0016353, 0.0000998, 0.0005102, 0.0000549, 0.0000241, 0.0001035}},
 	}
-	if !base.EQParameter(trueParameters[0], ffm.model.bias, false) {
+	if !base.EQParameter(trueParameters[0], ffm.model.get(0, 0, false), false) {
 		t.Error("bias term not the same")
 	}
 	for k, v := range trueParameters {
@@ -142,5 +147,49 @@ func TestFFMModel_Train_Predict(t *testing.T) {
 }
 
 func TestFFMModel_Save_Load(t *testing.T) {
+	save_path := filepath.Join(t.TempDir(), "ffm_model")
+	config := _gen_ffm_config()
+	ffm := new(FFMModel)
+	ffm.Init(config)
+	ffm.Train(_gen_ffm_instance())
+	if err := ffm.Save(save_path); err != nil {
+		t.Fatal("save file error: ", err)
+	}
+
+	new_ffm := new(FFMModel)
+	new_ffm.Init(config)
+	if err := new_ffm.Load(save_path); err != nil {
+		t.Fatal("load file error: ", err)
+	}
+	if base.NEQFloat32(ffm.model.get(0, 0, false).W, new_ffm.model.get(0, 0, false).W) {
+		t.Error("save or load bias error")
+	}
+	n := 0
+	ffm.model.each(func(k uint64, v *base.Parameter) {
+		n++
+		new_pm := new_ffm.model.get(k, v.Slot, false)
+		if new_pm == nil {
+			t.Error("load error, missing key: ", k)
+			return
+		}
+		if base.NEQFloat32(v.W, new_pm.W) || base.NEQSliceFloat32(v.VecW, new_pm.VecW) {
+			t.Error("save or load error: ", k, v, new_pm)
+		}
+	})
+	if n < 6 {
+		t.Errorf("saved %d keys, want the 6 trained", n)
+	}
+	res, _ := ffm.Predict(_gen_ffm_instance())
+	new_res, _ := new_ffm.Predict(_gen_ffm_instance())
+	for i := range res {
+		if base.NEQFloat32(res[i].Score, new_res[i].Score) {
+			t.Errorf("score %d of the loaded model %f, want %f", i, new_res[i].Score, res[i].Score)
+		}
+	}
+}
 
+func TestFFMModel_FeatureValue(t *testing.T) {
+	ffm := new(FFMModel)
+	ffm.Init(_gen_ffm_config())
+	_check_emb_grad(t, ffm.model, _gen_valued_instance(), ffm.predictz)
 }
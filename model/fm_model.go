@@ -6,32 +6,52 @@ import (
 
 	"linearmodel/base"
 	"linearmodel/conf"
+	"linearmodel/loss"
 	"linearmodel/optim"
 )
 
 type FMModel struct {
-	model   *concurrentMap
-	optim   optim.Optimizer
-	conf    *conf.AllConfig
-	sample  float64
-	embSize uint32
-	eval    bool
+	model    paramStore
+	optim    optim.Optimizer
+	schedule *optim.Schedule
+	loss     loss.Loss
+	conf     *conf.AllConfig
+	sample   float64
+	embSize  uint32
+	sumSize  uint32 // max embedding size over slots
+	eval     bool
 
 	group_sparse bool
 }
 
 func (fm *FMModel) Init(conf *conf.AllConfig) error {
 	fm.embSize = conf.OptimConfig.EmbSize
-	fm.model = NewConcurrentMap(uint64(MODELCAP), fm.embSize)
-	fm.model.norm = float32(math.Sqrt(float64(fm.embSize)))
-	fm.optim = &optim.Ftrl{}
-	fm.optim.Init(conf.OptimConfig)
+	fm.schedule = optim.NewSchedule(conf.OptimConfig)
+	fm.optim = optim.NewOptimizer(conf.OptimConfig, conf.FeatureList, fm.schedule)
+	model, err := newParamStore(conf, "", fm.embSize, sqrtNorm(fm.embSize), fm.optim)
+	if err != nil {
+		return err
+	}
+	fm.model = model
+	fm.sumSize = fm.model.initSlots(conf.FeatureList, sqrtNorm)
+	if err := fm.model.initEmb(conf); err != nil {
+		return err
+	}
+	fm.loss = loss.NewLoss(conf.LossConfig)
 	fm.conf = conf
 	return nil
 }
 
+func (fm *FMModel) paramStores() map[string]paramStore {
+	return map[string]paramStore{"": fm.model}
+}
+
+func (fm *FMModel) Close() error {
+	return closeStores(fm.model)
+}
+
 func (fm *FMModel) Load(path string) error {
-	err := fm.model.load(path, int(fm.embSize))
+	err := loadStore(fm.model, path, fm.schedule)
 	return err
 }
 
@@ -45,69 +65,125 @@ func (fm *FMModel) Save(path string) error {
 			metaLine += "\t"
 		}
 	}
-	err := fm.model.save(path, metaLine)
+	err := saveStore(fm.model, path, metaLine, fm.schedule)
 	return err
 }
 
 func (fm *FMModel) Predict(inslist []*base.Instance) ([]base.Result, error) {
 	n := len(inslist)
 	res := make([]base.Result, n, n)
+	release := pullBatch(inslist, false, fm.model)
 	for i := 0; i < n; i++ {
 		ins := inslist[i]
-		x, _, _ := fm.predict_(ins, false)
-		res[i] = base.Result{UserId: ins.UserId, Label: ins.Label, Score: x}
+		z, _ := fm.predict_(ins, false)
+		res[i] = base.Result{UserId: ins.UserId, Label: ins.Label, Score: fm.loss.Predict(z)}
 	}
-	return res, nil
+	release()
+	return res, storeErr(fm.model)
 }
 
 func (fm *FMModel) Train(inslist []*base.Instance) error {
-	n := len(inslist)
-	for i := 0; i < n; i++ {
-		ins := inslist[i]
-		_, grad, gradVec := fm.predict_(ins, true)
-		m := len(ins.Feas)
-		fm.model.update(0, 0, ins.Label, grad, fm.optim)
+	fm.schedule.Advance(len(inslist))
+	release := pullBatch(inslist, true, fm.model)
+	var batch *gradBatch
+	if fm.conf.MiniBatch {
+		batch = newGradBatch(len(inslist))
+	}
+	if rank, ok := fm.loss.(loss.RankLoss); ok {
+		fm.trainRank(inslist, rank, batch)
+	} else {
+		n := len(inslist)
+		for i := 0; i < n; i++ {
+			ins := inslist[i]
+			z, gradVec := fm.predict_(ins, true)
+			fm.apply(ins, fm.loss.Gradient(z, ins.Label), gradVec, batch)
+		}
+	}
+	if batch != nil {
+		batch.apply(fm.model, fm.optim)
+	}
+	release()
+	return storeErr(fm.model)
+}
+
+func (fm *FMModel) trainRank(inslist []*base.Instance, rank loss.RankLoss, batch *gradBatch) {
+	for _, group := range groupByUser(inslist) {
+		z := make([]float32, len(group))
+		labels := make([]float32, len(group))
+		gradVecs := make([][][]float32, len(group))
+		for i, ins := range group {
+			z[i], gradVecs[i] = fm.predict_(ins, true)
+			labels[i] = ins.Label
+		}
+		grads := rank.Gradients(z, labels)
+		for i, ins := range group {
+			fm.apply(ins, grads[i], gradVecs[i], batch)
+		}
+	}
+}
+
+// apply updates weights with dloss/dz = grad, gradVec holds dz/dv for each feature and is scaled in place.
+// The gradient of a linear weight is grad times the value of its feature.
+// In mini batch mode the gradients are added to batch instead.
+func (fm *FMModel) apply(ins *base.Instance, grad float32, gradVec [][]float32, batch *gradBatch) {
+	for _, gradv := range gradVec {
+		for j := range gradv {
+			gradv[j] *= grad
+		}
+	}
+	m := len(ins.Feas)
+	if batch != nil {
+		batch.add(0, 0, ins.Label, grad, nil)
 		for j := 0; j < m; j++ {
-			fea := ins.Feas[j]
-			key := fea.Fea
-			slot := fea.Slot
-			//fm.model.update(key, slot, ins.Label, grad, fm.optim)
-			//fm.model.updateEmb(key, slot, ins.Label, gradVec[j], fm.optim)
-			fm.model.updateWeightAndEmb(key, slot, ins.Label, grad, gradVec[j], fm.optim)
+			batch.add(ins.Feas[j].Fea, ins.Feas[j].Slot, ins.Label, grad*ins.Feas[j].Val(), gradVec[j])
 		}
+		return
+	}
+	fm.model.update(0, 0, ins.Label, grad, fm.optim)
+	for j := 0; j < m; j++ {
+		fea := ins.Feas[j]
+		key := fea.Fea
+		slot := fea.Slot
+		//fm.model.update(key, slot, ins.Label, grad, fm.optim)
+		//fm.model.updateEmb(key, slot, ins.Label, gradVec[j], fm.optim)
+		fm.model.updateWeightAndEmb(key, slot, ins.Label, grad*fea.Val(), gradVec[j], fm.optim)
 	}
-	return nil
 }
 
-func (fm *FMModel) predict_(ins *base.Instance, needInit bool) (float32, float32, [][]float32) {
+// predict_ returns the raw score z, and dz/dv of every feature embedding when needInit is set.
+// With feature values x, z = b + sum w_i*x_i + (|sum v_i*x_i|^2 - sum |v_i|^2*x_i^2) / 2 and
+// dz/dv_i = x_i * (sum v_j*x_j - v_i*x_i).
+func (fm *FMModel) predict_(ins *base.Instance, needInit bool) (float32, [][]float32) {
 	z := fm.model.getWeight(0, 0, "", false).W
-	sumVec := make([]float32, fm.embSize)
+	// slots with smaller embedding are zero padded to sumSize
+	sumVec := make([]float32, fm.sumSize)
 	gradVec := make([][]float32, 0, len(ins.Feas))
 	for i, n := 0, len(ins.Feas); i < n; i++ {
 		fea := ins.Feas[i].Fea
 		slot := ins.Feas[i].Slot
 		text := ins.Feas[i].Text
+		x := ins.Feas[i].Val()
 		factor := fm.model.getWeight(fea, slot, text, needInit)
-		z += (factor.W - base.VecNorm32(factor.VecW)/2.0)
-		sumVec = base.InPlaceVecTimeAdd(sumVec, factor.VecW, 1.0, 1.0)
+		z += (factor.W*x - base.VecNorm32(factor.VecW)*x*x/2.0)
+		sumVec = base.InPlaceVecTimeAdd(sumVec, factor.VecW, 1.0, x)
 		gradVec = append(gradVec, factor.VecW)
 	}
 	z += base.VecNorm32(sumVec) / 2.0
-	p := base.Sigmoid32(z)
-	grad := p
-	if ins.Label > 0 {
-		grad -= 1.0
-	}
 	if needInit {
-		for _, gradv := range gradVec {
+		for i, gradv := range gradVec {
+			x := ins.Feas[i].Val()
 			for j := range gradv {
-				gradv[j] = grad * (sumVec[j] - gradv[j])
+				gradv[j] = x * (sumVec[j] - gradv[j]*x)
 			}
 		}
 	}
-	return p, grad, gradVec
+	return z, gradVec
 }
 
 func (fm *FMModel) Eval(p bool) {
 	fm.eval = p
 }
+
+func sqrtNorm(size uint32) float32 {
+	return float32(math.Sqrt(float64(size)))
+}
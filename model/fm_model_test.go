@@ -1,8 +1,11 @@
 package model
 
 import (
+	"math"
 	"math/rand"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"linearmodel/base"
 	"linearmodel/conf"
@@ -74,7 +77,7 @@ func TestFMModel_Train(t *testing.T) {
 		22: &base.Parameter{Slot: 301, Fea: 22, Text: "", W: 0.3331682, Z: -0.6995542, N: 0.4893760,
 			VecW: []float32{0.0930276, -0.0179544}, VecZ: []float32{-0.1519662, 0.0235054}, VecN: []float32{0.0469936, 0.0029794}},
 	}
-	if !base.EQParameter(trueParameters[0], fm.model.bias, false) {
+	if !base.EQParameter(trueParameters[0], fm.model.get(0, 0, false), false) {
 		t.Error("bias term not the same")
 	}
 	for k, v := range trueParameters {
@@ -99,7 +102,7 @@ func TestFMModel_Train(t *testing.T) {
 		22: &base.Parameter{Slot: 301, Fea: 22, Text: "", W: 0.5416449, Z: -1.1314875, N: 0.6469969,
 			VecW: []float32{0.1347290, 0.0346926}, VecZ: []float32{-0.2229768, -0.0479419}, VecN: []float32{0.0517568, 0.0082724}},
 	}
-	if !base.EQParameter(trueParameters[0], fm.model.bias, false) {
+	if !base.EQParameter(trueParameters[0], fm.model.get(0, 0, false), false) {
 		t.Error("bias term not the same")
 	}
 	for k, v := range trueParameters {
@@ -144,20 +147,156 @@ func TestFMModel_Save_Load(t *testing.T) {
 		t.Error("load file error: ", err)
 	}
 
-	if base.NEQFloat32(lr.model.bias.W, new_lr.model.bias.W) {
+	if base.NEQFloat32(lr.model.get(0, 0, false).W, new_lr.model.get(0, 0, false).W) {
 		t.Error("save or load bias error")
 	}
 
-	for _, x := range lr.model.modelData {
-		for k, v := range x.data {
-			new_pm := new_lr.model.get(k, v.Slot, false)
-			if new_pm == nil {
-				t.Error("load error, missing key: ", k)
-				continue
+	lr.model.each(func(k uint64, v *base.Parameter) {
+		new_pm := new_lr.model.get(k, v.Slot, false)
+		if new_pm == nil {
+			t.Error("load error, missing key: ", k)
+			return
+		}
+		if base.NEQFloat32(v.W, new_pm.W) || base.NEQSliceFloat32(v.VecW, new_pm.VecW) {
+			t.Error("save or load error: ", k, v, new_pm)
+		}
+	})
+}
+
+func TestFMModel_SlotEmbSize(t *testing.T) {
+	rand.Seed(0)
+	insList := _gen_fm_instance()
+	config := _gen_fm_config()
+	size := uint32(4)
+	config.FeatureList[1].EmbSize = &size
+	fm := &FMModel{}
+	fm.Init(config)
+	if fm.sumSize != 4 {
+		t.Error("max embedding size error: ", fm.sumSize)
+	}
+	fm.Train(insList)
+	if n := len(fm.model.get(2, 103, false).VecW); n != 4 {
+		t.Error("slot embedding size error: ", n)
+	}
+	if n := len(fm.model.get(1, 101, false).VecW); n != 2 {
+		t.Error("default embedding size error: ", n)
+	}
+	save_path := filepath.Join(t.TempDir(), "model")
+	if err := fm.Save(save_path); err != nil {
+		t.Error("save file error: ", err)
+	}
+	new_fm := &FMModel{}
+	new_fm.Init(config)
+	if err := new_fm.Load(save_path); err != nil {
+		t.Error("load file error: ", err)
+	}
+	res, _ := fm.Predict(insList)
+	new_res, _ := new_fm.Predict(insList)
+	for i := range res {
+		if base.NEQFloat32(res[i].Score, new_res[i].Score) {
+			t.Error("predict after load error: ", res[i].Score, new_res[i].Score)
+		}
+	}
+}
+
+func TestFMModel_Seed(t *testing.T) {
+	train := func(reverse bool) *FMModel {
+		config := _gen_fm_config()
+		config.Seed = 7
+		fm := &FMModel{}
+		fm.Init(config)
+		insList := _gen_fm_instance()
+		if reverse {
+			// embeddings only depend on key and seed, not on the order they are created in
+			for i := len(insList) - 1; i >= 0; i-- {
+				for _, fea := range insList[i].Feas {
+					fm.model.getWeight(fea.Fea, fea.Slot, "", true)
+				}
+			}
+		}
+		rand.Seed(time.Now().UnixNano())
+		for i := 0; i < 3; i++ {
+			fm.Train(insList)
+		}
+		return fm
+	}
+	a, b := train(false), train(true)
+	for _, fea := range _gen_fm_instance()[1].Feas {
+		wa := a.model.getWeight(fea.Fea, fea.Slot, "", false)
+		wb := b.model.getWeight(fea.Fea, fea.Slot, "", false)
+		if wa.W != wb.W {
+			t.Errorf("slot %d weight %v != %v", fea.Slot, wa.W, wb.W)
+		}
+		for j := range wa.VecW {
+			if wa.VecW[j] != wb.VecW[j] {
+				t.Errorf("slot %d vec %v != %v", fea.Slot, wa.VecW, wb.VecW)
+				break
 			}
-			if base.NEQFloat32(v.W, new_pm.W) || base.NEQSliceFloat32(v.VecW, new_pm.VecW) {
-				t.Error("save or load error: ", k, v, new_pm)
+		}
+	}
+	c := &FMModel{}
+	config := _gen_fm_config()
+	config.Seed = 8
+	c.Init(config)
+	c.Train(_gen_fm_instance())
+	wa := a.model.getWeight(1, 101, "", false)
+	wc := c.model.getWeight(1, 101, "", false)
+	if wa.VecW[0] == wc.VecW[0] {
+		t.Error("different seeds should init different embeddings")
+	}
+}
+
+// _gen_valued_instance has numeric features, two of them in the same slot
+func _gen_valued_instance() *base.Instance {
+	return &base.Instance{Feas: []*base.Feature{{Fea: 1, Slot: 101, Value: 2}, {Fea: 2, Slot: 103, Value: -0.5},
+		{Fea: 4, Slot: 103}, {Fea: 10, Slot: 201, Value: 3}, {Fea: 21, Slot: 301}}, Label: 1}
+}
+
+// _check_emb_grad compares dz/dv of predict with central differences, z is linear in every
+// embedding entry so they agree up to rounding
+func _check_emb_grad(t *testing.T, store paramStore, ins *base.Instance,
+	predict func(ins *base.Instance, needInit bool) (float32, [][]float32)) {
+	_, grads := predict(ins, true)
+	eps := float32(0.01)
+	for i, fea := range ins.Feas {
+		p := store.get(fea.Fea, fea.Slot, false)
+		vec := append([]float32(nil), p.VecW...)
+		for k := range vec {
+			shifted := *p
+			shifted.VecW = append([]float32(nil), vec...)
+			shifted.VecW[k] = vec[k] + eps
+			store.set(fea.Fea, &shifted)
+			zUp, _ := predict(ins, false)
+			shifted.VecW[k] = vec[k] - eps
+			store.set(fea.Fea, &shifted)
+			zDown, _ := predict(ins, false)
+			shifted.VecW[k] = vec[k]
+			store.set(fea.Fea, &shifted)
+			if diff := (zUp - zDown) / (2 * eps); math.Abs(float64(diff-grads[i][k])) > 1e-3 {
+				t.Errorf("feature %d dz/dv[%d] = %f, central difference %f", i, k, grads[i][k], diff)
 			}
 		}
 	}
 }
+
+func TestFMModel_FeatureValue(t *testing.T) {
+	fm := &FMModel{}
+	fm.Init(_gen_fm_config())
+	ins := _gen_valued_instance()
+	_check_emb_grad(t, fm.model, ins, fm.predict_)
+
+	// z = b + sum w*x + (|sum v*x|^2 - sum |v|^2*x^2) / 2
+	z, _ := fm.predict_(ins, false)
+	want := fm.model.get(0, 0, false).W
+	sum := make([]float32, 2)
+	for _, fea := range ins.Feas {
+		p := fm.model.get(fea.Fea, fea.Slot, false)
+		x := fea.Val()
+		want += p.W*x - base.VecNorm32(p.VecW)*x*x/2
+		base.InPlaceVecTimeAdd(sum, p.VecW, 1, x)
+	}
+	want += base.VecNorm32(sum) / 2
+	if base.NEQFloat32(z, want) {
+		t.Errorf("z = %f, want %f", z, want)
+	}
+}
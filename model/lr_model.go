@@ -5,29 +5,45 @@ import (
 
 	"linearmodel/base"
 	"linearmodel/conf"
+	"linearmodel/loss"
 	"linearmodel/optim"
 )
 
 type LRModel struct {
-	model   *concurrentMap
-	optim   optim.Optimizer
-	conf    *conf.AllConfig
-	sample  float64
-	embSize uint32
-	eval    bool
+	model    paramStore
+	optim    optim.Optimizer
+	schedule *optim.Schedule
+	loss     loss.Loss
+	conf     *conf.AllConfig
+	sample   float64
+	embSize  uint32
+	eval     bool
 }
 
 func (lr *LRModel) Init(conf *conf.AllConfig) error {
 	lr.embSize = conf.OptimConfig.EmbSize
-	lr.model = NewConcurrentMap(uint64(MODELCAP), 0)
-	lr.optim = &optim.Ftrl{}
-	lr.optim.Init(conf.OptimConfig)
+	lr.schedule = optim.NewSchedule(conf.OptimConfig)
+	lr.optim = optim.NewOptimizer(conf.OptimConfig, conf.FeatureList, lr.schedule)
+	model, err := newParamStore(conf, "", 0, 0, lr.optim)
+	if err != nil {
+		return err
+	}
+	lr.model = model
+	lr.loss = loss.NewLoss(conf.LossConfig)
 	lr.conf = conf
 	return nil
 }
 
+func (lr *LRModel) paramStores() map[string]paramStore {
+	return map[string]paramStore{"": lr.model}
+}
+
+func (lr *LRModel) Close() error {
+	return closeStores(lr.model)
+}
+
 func (lr *LRModel) Load(path string) error {
-	err := lr.model.load(path, 0)
+	err := loadStore(lr.model, path, lr.schedule)
 	return err
 }
 
@@ -41,52 +57,90 @@ func (lr *LRModel) Save(path string) error {
 			metaLine += "\t"
 		}
 	}
-	err := lr.model.save(path, metaLine)
+	err := saveStore(lr.model, path, metaLine, lr.schedule)
 	return err
 }
 
 func (lr *LRModel) Predict(inslist []*base.Instance) ([]base.Result, error) {
 	n := len(inslist)
 	res := make([]base.Result, n, n)
+	release := pullBatch(inslist, false, lr.model)
 	for i := 0; i < n; i++ {
 		ins := inslist[i]
-		res[i] = base.Result{UserId: ins.UserId, Label: ins.Label, Score: lr.predictz(ins, false)}
+		res[i] = base.Result{UserId: ins.UserId, Label: ins.Label, Score: lr.loss.Predict(lr.predictz(ins, false))}
 	}
-	return res, nil
+	release()
+	return res, storeErr(lr.model)
 }
 
 func (lr *LRModel) predictz(ins *base.Instance, needInit bool) float32 {
 	z := lr.model.getWeight(0, 0, "", false).W
 	for i, n := 0, len(ins.Feas); i < n; i++ {
 		fea := ins.Feas[i]
-		z += lr.model.getWeight(fea.Fea, fea.Slot, fea.Text, needInit).W
+		z += lr.model.getWeight(fea.Fea, fea.Slot, fea.Text, needInit).W * fea.Val()
 	}
-	return base.Sigmoid32(z)
+	return z
 }
 
 func (lr *LRModel) gradient(ins *base.Instance) float32 {
-	// g = p - y
-	g := lr.predictz(ins, true)
-	if ins.Label > 0 {
-		g -= 1.0
-	}
-	return g
+	return lr.loss.Gradient(lr.predictz(ins, true), ins.Label)
 }
 
 func (lr *LRModel) Train(inslist []*base.Instance) error {
-	n := len(inslist)
-	for i := 0; i < n; i++ {
-		ins := inslist[i]
-		grad := lr.gradient(ins)
-		m := len(ins.Feas)
-		lr.model.update(0, 0, ins.Label, grad, lr.optim)
+	lr.schedule.Advance(len(inslist))
+	release := pullBatch(inslist, true, lr.model)
+	var batch *gradBatch
+	if lr.conf.MiniBatch {
+		batch = newGradBatch(len(inslist))
+	}
+	if rank, ok := lr.loss.(loss.RankLoss); ok {
+		lr.trainRank(inslist, rank, batch)
+	} else {
+		n := len(inslist)
+		for i := 0; i < n; i++ {
+			ins := inslist[i]
+			lr.apply(ins, lr.gradient(ins), batch)
+		}
+	}
+	if batch != nil {
+		batch.apply(lr.model, lr.optim)
+	}
+	release()
+	return storeErr(lr.model)
+}
+
+func (lr *LRModel) trainRank(inslist []*base.Instance, rank loss.RankLoss, batch *gradBatch) {
+	for _, group := range groupByUser(inslist) {
+		z := make([]float32, len(group))
+		labels := make([]float32, len(group))
+		for i, ins := range group {
+			z[i] = lr.predictz(ins, true)
+			labels[i] = ins.Label
+		}
+		grads := rank.Gradients(z, labels)
+		for i, ins := range group {
+			lr.apply(ins, grads[i], batch)
+		}
+	}
+}
+
+// apply updates weights of the instance, or adds its gradient to batch in mini batch mode.
+// The gradient of a weight is grad times the value of its feature.
+func (lr *LRModel) apply(ins *base.Instance, grad float32, batch *gradBatch) {
+	m := len(ins.Feas)
+	if batch != nil {
+		batch.add(0, 0, ins.Label, grad, nil)
 		for j := 0; j < m; j++ {
-			key := ins.Feas[j].Fea
-			slot := ins.Feas[j].Slot
-			lr.model.update(key, slot, ins.Label, grad, lr.optim)
+			batch.add(ins.Feas[j].Fea, ins.Feas[j].Slot, ins.Label, grad*ins.Feas[j].Val(), nil)
 		}
+		return
+	}
+	lr.model.update(0, 0, ins.Label, grad, lr.optim)
+	for j := 0; j < m; j++ {
+		key := ins.Feas[j].Fea
+		slot := ins.Feas[j].Slot
+		lr.model.update(key, slot, ins.Label, grad*ins.Feas[j].Val(), lr.optim)
 	}
-	return nil
 }
 
 func (lr *LRModel) Eval(p bool) {
@@ -65,7 +65,7 @@ func TestLRModel_Train(t *testing.T) {
 		21: &base.Parameter{Slot: 301, Fea: 21, Text: "", W: -0.25, Z: 0.5, N: 0.25},
 		22: &base.Parameter{Slot: 301, Fea: 22, Text: "", W: 0.3255315, Z: -0.679179, N: 0.461284},
 	}
-	if !base.EQParameter(trueParameters[0], lr.model.bias, false) {
+	if !base.EQParameter(trueParameters[0], lr.model.get(0, 0, false), false) {
 		t.Error("bias term not the same")
 	}
 	for k, v := range trueParameters {
@@ -84,7 +84,7 @@ func TestLRModel_Train(t *testing.T) {
 		21: &base.Parameter{Slot: 301, Fea: 21, Text: "", W: -0.4686705, Z: 0.90917259, N: 0.39253696},
 		22: &base.Parameter{Slot: 301, Fea: 22, Text: "", W: 0.540484068, Z: -1.12237206, N: 0.6266083},
 	}
-	if !base.EQParameter(trueParameters[0], lr.model.bias, false) {
+	if !base.EQParameter(trueParameters[0], lr.model.get(0, 0, false), false) {
 		t.Error("bias term not the same")
 	}
 	for k, v := range trueParameters {
@@ -129,20 +129,56 @@ func TestLRModel_Save_LOAD(t *testing.T) {
 		t.Error("load file error: ", err)
 	}
 
-	if base.NEQFloat32(lr.model.bias.W, new_lr.model.bias.W) {
+	if base.NEQFloat32(lr.model.get(0, 0, false).W, new_lr.model.get(0, 0, false).W) {
 		t.Error("save or load bias error")
 	}
 
-	for _, x := range lr.model.modelData {
-		for k, v := range x.data {
-			new_pm := new_lr.model.get(k, v.Slot, false)
-			if new_pm == nil {
-				t.Error("load error, missing key: ", k)
-				continue
-			}
-			if base.NEQFloat32(v.W, new_pm.W) || base.NEQSliceFloat32(v.VecW, new_pm.VecW) {
-				t.Error("save or load error: ", k, v, new_pm)
-			}
+	lr.model.each(func(k uint64, v *base.Parameter) {
+		new_pm := new_lr.model.get(k, v.Slot, false)
+		if new_pm == nil {
+			t.Error("load error, missing key: ", k)
+			return
+		}
+		if base.NEQFloat32(v.W, new_pm.W) || base.NEQSliceFloat32(v.VecW, new_pm.VecW) {
+			t.Error("save or load error: ", k, v, new_pm)
+		}
+	})
+}
+
+func TestLRModel_TrainRank(t *testing.T) {
+	insList := _gen_lr_instance()
+	config := _gen_lr_config()
+	config.LossConfig = &conf.LossConfig{Name: "ranknet"}
+	lr := &LRModel{}
+	lr.Init(config)
+	lr.Train(insList)
+	lr.Train(insList)
+	res, _ := lr.Predict(insList)
+	if res[1].Score <= res[0].Score {
+		t.Error("ranknet should rank positive instance first: ", res[0].Score, res[1].Score)
+	}
+	if pm := lr.model.get(0, 0, false); base.NEQFloat32(pm.W, 0.0) {
+		t.Error("pairwise loss should not move bias term: ", pm.W)
+	}
+}
+
+func TestLRModel_FeatureValue(t *testing.T) {
+	lr := &LRModel{}
+	lr.Init(_gen_lr_config())
+	ins := _gen_valued_instance()
+	lr.Train([]*base.Instance{ins})
+	want := lr.model.get(0, 0, false).W
+	for _, fea := range ins.Feas {
+		want += lr.model.get(fea.Fea, fea.Slot, false).W * fea.Val()
+	}
+	if z := lr.predictz(ins, false); base.NEQFloat32(z, want) {
+		t.Errorf("z = %f, want %f", z, want)
+	}
+	// the first update of w is the gradient times the value, scaled by the learning rate
+	grad := lr.loss.Gradient(0, ins.Label)
+	for _, fea := range ins.Feas[:2] {
+		if z := lr.model.get(fea.Fea, fea.Slot, false).Z; base.NEQFloat32(z, grad*fea.Val()) {
+			t.Errorf("slot %d z = %f, want %f", fea.Slot, z, grad*fea.Val())
 		}
 	}
 }
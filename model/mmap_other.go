@@ -0,0 +1,21 @@
+//go:build !(darwin || dragonfly || freebsd || linux || openbsd)
+
+package model
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, fmt.Errorf("mmap param_store is not supported on %s", runtime.GOOS)
+}
+
+func munmap(data []byte) error {
+	return nil
+}
+
+func msync(data []byte) error {
+	return nil
+}
@@ -0,0 +1,313 @@
+package model
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/golang/glog"
+)
+
+const (
+	mmapMagic      = 0x31305041454d4c // "LMEAP01"
+	mmapHeaderSize = 4096             // bytes before the first bucket
+	mmapRegionBits = 6
+	mmapRegions    = 1 << mmapRegionBits
+	mmapMaxLoad    = 0.9
+	mmapCapacity   = 1 << 24 // default keys of a table
+)
+
+// header words
+const (
+	mwMagic  = iota
+	mwBucket // floats of a bucket
+	mwCapacity
+	mwCount                         // entries of every region
+	mwBias  = mwCount + mmapRegions // the bias entry starts at float 2 * mwBias
+)
+
+// bucket floats: key (2), text ref (2), entry. The text ref is 1 + the offset of the
+// length prefixed text in the text file, 0 for no text.
+const (
+	mbKey   = 0
+	mbText  = 2
+	mbEntry = 4
+)
+
+// mmapTable is an entryTable in a memory mapped file, so the OS pages cold keys out and a
+// trained file can be opened again without loading. Regions of fixed size buckets are open
+// addressing tables, inserts take the spin lock of the region. The mapping never grows since
+// lookups hold no lock, an insert in a full region fails and err returns the failure.
+type mmapTable struct {
+	path     string
+	capacity uint64 // keys the table was sized for
+	data     []byte
+	words    []uint64  // data as uint64
+	floats   []float32 // data as float32
+	bucket   uint64    // floats of a bucket
+	buckets  uint64    // buckets of a region
+	locks    [mmapRegions]paddedLock
+
+	textLock sync.Mutex
+	textFile *os.File
+	textSize int64
+
+	mu     sync.Mutex
+	failed error // first insert failure since the last err
+}
+
+// openMmapTable maps path, creating it for capacity keys of at most entry floats. An existing
+// file must have been created with the same capacity and entry size.
+func openMmapTable(path string, capacity uint64, entry int) (*mmapTable, error) {
+	if capacity == 0 {
+		capacity = mmapCapacity
+	}
+	t := &mmapTable{path: path, capacity: capacity, bucket: uint64(mbEntry + entry), buckets: 16}
+	if t.bucket%2 != 0 {
+		// keep keys 8 byte aligned
+		t.bucket++
+	}
+	for float64(t.buckets*mmapRegions)*mmapMaxLoad < float64(capacity) {
+		t.buckets *= 2
+	}
+	size := int64(mmapHeaderSize) + int64(t.buckets*mmapRegions*t.bucket*4)
+	if 2*mwBias+headerSize+3 > mmapHeaderSize/4 {
+		return nil, fmt.Errorf("mmap header too small")
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fresh := st.Size() == 0
+	if fresh {
+		if err := f.Truncate(size); err != nil {
+			return nil, err
+		}
+	} else if st.Size() != size {
+		return nil, fmt.Errorf("%s has %d bytes, want %d: it was created with another mmap_capacity, emb_size "+
+			"or optimizer", path, st.Size(), size)
+	}
+	if t.data, err = mmapFile(f, int(size)); err != nil {
+		return nil, err
+	}
+	t.words = unsafe.Slice((*uint64)(unsafe.Pointer(&t.data[0])), len(t.data)/8)
+	t.floats = unsafe.Slice((*float32)(unsafe.Pointer(&t.data[0])), len(t.data)/4)
+	if fresh {
+		t.words[mwMagic] = mmapMagic
+		t.words[mwBucket] = t.bucket
+		t.words[mwCapacity] = t.buckets * mmapRegions
+	} else if t.words[mwMagic] != mmapMagic || t.words[mwBucket] != t.bucket ||
+		t.words[mwCapacity] != t.buckets*mmapRegions {
+		munmap(t.data)
+		return nil, fmt.Errorf("%s is not an mmap store of the same layout", path)
+	}
+
+	if t.textFile, err = os.OpenFile(path+".text", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		munmap(t.data)
+		return nil, err
+	}
+	if st, err = t.textFile.Stat(); err != nil {
+		return nil, err
+	}
+	t.textSize = st.Size()
+	if !fresh {
+		var count uint64
+		for r := 0; r < mmapRegions; r++ {
+			count += t.words[mwCount+r]
+		}
+		glog.Infof("open mmap store %s with %d keys", path, count)
+	}
+	return t, nil
+}
+
+func (t *mmapTable) bias(n int) []float32 {
+	return t.floats[2*mwBias : 2*mwBias+n : 2*mwBias+n]
+}
+
+func (t *mmapTable) region(h uint64) uint64 {
+	return h >> (64 - mmapRegionBits)
+}
+
+// find returns the bucket of key, or the empty bucket where it would be inserted
+func (t *mmapTable) find(key, h uint64) (uint64, bool) {
+	first := t.region(h) * t.buckets
+	mask := t.buckets - 1
+	for i := h & mask; ; i = (i + 1) & mask {
+		b := first + i
+		k := atomic.LoadUint64(t.keyOf(b))
+		if k == key {
+			return b, true
+		}
+		if k == 0 {
+			return b, false
+		}
+	}
+}
+
+func (t *mmapTable) keyOf(b uint64) *uint64 {
+	return &t.words[(mmapHeaderSize/4+b*t.bucket+mbKey)/2]
+}
+
+func (t *mmapTable) textOf(b uint64) *uint64 {
+	return &t.words[(mmapHeaderSize/4+b*t.bucket+mbText)/2]
+}
+
+func (t *mmapTable) entry(b uint64) []float32 {
+	start := mmapHeaderSize/4 + b*t.bucket + mbEntry
+	e := t.floats[start : start+t.bucket-mbEntry]
+	n := entrySize(e)
+	return e[:n:n]
+}
+
+func (t *mmapTable) lookup(key, h uint64) []float32 {
+	if b, ok := t.find(key, h); ok {
+		return t.entry(b)
+	}
+	return nil
+}
+
+func (t *mmapTable) insert(key, h uint64, n int, text string, init func(e []float32)) []float32 {
+	r := t.region(h)
+	l := &t.locks[r].spinLock
+	l.lock()
+	defer l.unlock()
+	b, ok := t.find(key, h)
+	if ok {
+		return t.entry(b)
+	}
+	if float64(t.words[mwCount+r]+1) > mmapMaxLoad*float64(t.buckets) {
+		t.fail(fmt.Errorf("mmap store %s is full, a region of mmap_capacity %d holds %d keys: raise mmap_capacity",
+			t.path, t.capacity, t.words[mwCount+r]))
+		return nil
+	}
+	if uint64(n) > t.bucket-mbEntry {
+		t.fail(fmt.Errorf("entry of %d floats does not fit a bucket of %s", n, t.path))
+		return nil
+	}
+	start := mmapHeaderSize/4 + b*t.bucket + mbEntry
+	e := t.floats[start : start+uint64(n) : start+uint64(n)]
+	init(e)
+	if text != "" {
+		*t.textOf(b) = t.appendText(text)
+	}
+	atomic.StoreUint64(t.keyOf(b), key)
+	t.words[mwCount+r]++
+	return e
+}
+
+func (t *mmapTable) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed == nil {
+		t.failed = err
+	}
+}
+
+func (t *mmapTable) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := t.failed
+	t.failed = nil
+	return err
+}
+
+func (t *mmapTable) appendText(text string) uint64 {
+	t.textLock.Lock()
+	defer t.textLock.Unlock()
+	buf := make([]byte, binary.MaxVarintLen64+len(text))
+	n := binary.PutUvarint(buf, uint64(len(text)))
+	n += copy(buf[n:], text)
+	if _, err := t.textFile.Write(buf[:n]); err != nil {
+		glog.Errorf("write text of %s error: %v", t.path, err)
+		return 0
+	}
+	ref := uint64(t.textSize) + 1
+	t.textSize += int64(n)
+	return ref
+}
+
+func (t *mmapTable) text(key, h uint64, e []float32) string {
+	b, ok := t.find(key, h)
+	if !ok {
+		return ""
+	}
+	ref := atomic.LoadUint64(t.textOf(b))
+	if ref == 0 {
+		return ""
+	}
+	prefix := make([]byte, binary.MaxVarintLen64)
+	n, err := t.textFile.ReadAt(prefix, int64(ref-1))
+	if err != nil && err != io.EOF {
+		glog.Errorf("read text of %s error: %v", t.path, err)
+		return ""
+	}
+	size, m := binary.Uvarint(prefix[:n])
+	if m <= 0 {
+		glog.Errorf("bad text at %d of %s", ref-1, t.path)
+		return ""
+	}
+	text := make([]byte, size)
+	if _, err := t.textFile.ReadAt(text, int64(ref-1)+int64(m)); err != nil {
+		glog.Errorf("read text of %s error: %v", t.path, err)
+		return ""
+	}
+	return string(text)
+}
+
+func (t *mmapTable) each(sorted bool, f func(key uint64, e []float32)) {
+	type keyBucket struct {
+		key    uint64
+		bucket uint64
+	}
+	for r := uint64(0); r < mmapRegions; r++ {
+		items := make([]keyBucket, 0, t.words[mwCount+r])
+		for b := r * t.buckets; b < (r+1)*t.buckets; b++ {
+			if k := atomic.LoadUint64(t.keyOf(b)); k != 0 {
+				items = append(items, keyBucket{key: k, bucket: b})
+			}
+		}
+		if sorted {
+			sort.Slice(items, func(i, j int) bool {
+				return items[i].key < items[j].key
+			})
+		}
+		for _, x := range items {
+			f(x.key, t.entry(x.bucket))
+		}
+	}
+}
+
+// flush writes the mapped pages and the texts to disk
+func (t *mmapTable) flush() error {
+	if err := msync(t.data); err != nil {
+		return err
+	}
+	return t.textFile.Sync()
+}
+
+// close flushes the table, unmaps it and closes the text file, the table is not used after
+func (t *mmapTable) close() error {
+	if t.data == nil {
+		return nil
+	}
+	err := t.flush()
+	if e := munmap(t.data); err == nil {
+		err = e
+	}
+	if e := t.textFile.Close(); err == nil {
+		err = e
+	}
+	t.data, t.words, t.floats = nil, nil, nil
+	return err
+}
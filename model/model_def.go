@@ -20,4 +20,6 @@ type IModel interface {
 	Eval(p bool)
 	Load(path string) error
 	Save(path string) error
+	// Close releases the files of the parameter stores, the model is not used after
+	Close() error
 }
@@ -0,0 +1,262 @@
+package model
+
+import (
+	"fmt"
+	"math"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+	"linearmodel/loss"
+	"linearmodel/optim"
+)
+
+// MTFMModel is a multi-task FM, every task owns its linear weights and bias,
+// and all tasks share the feature embeddings.
+type MTFMModel struct {
+	model    paramStore   // shared embeddings
+	tasks    []paramStore // linear weights and bias of each task
+	optim    optim.Optimizer
+	schedule *optim.Schedule
+	loss     loss.Loss
+	conf     *conf.AllConfig
+	embSize  uint32
+	sumSize  uint32 // max embedding size over slots
+	taskNum  int
+	esmm     bool
+	eval     bool
+}
+
+func (mt *MTFMModel) Init(conf *conf.AllConfig) error {
+	mt.embSize = conf.OptimConfig.EmbSize
+	mt.taskNum = len(conf.MultiTaskConfig.GetTaskName())
+	mt.esmm = conf.MultiTaskConfig.GetEsmm()
+	if mt.taskNum == 0 {
+		return fmt.Errorf("multi task model needs task_name in multi_task_config")
+	}
+	if mt.esmm && mt.taskNum != 2 {
+		return fmt.Errorf("esmm needs exactly 2 tasks (ctr, cvr), got %d", mt.taskNum)
+	}
+	if name := conf.LossConfig.GetName(); mt.esmm && name != "" && name != "logistic" {
+		return fmt.Errorf("esmm only supports logistic loss, got %s", name)
+	}
+	if loss.IsRanking(conf.LossConfig) {
+		return fmt.Errorf("multi task model does not support ranking loss")
+	}
+	mt.schedule = optim.NewSchedule(conf.OptimConfig)
+	mt.optim = optim.NewOptimizer(conf.OptimConfig, conf.FeatureList, mt.schedule)
+	model, err := newParamStore(conf, "", mt.embSize, sqrtNorm(mt.embSize), partOptim{mt.optim, false})
+	if err != nil {
+		return err
+	}
+	mt.model = model
+	mt.sumSize = mt.model.initSlots(conf.FeatureList, sqrtNorm)
+	if err := mt.model.initEmb(conf); err != nil {
+		return err
+	}
+	mt.tasks = make([]paramStore, mt.taskNum)
+	for i := range mt.tasks {
+		name := conf.MultiTaskConfig.TaskName[i]
+		if mt.tasks[i], err = newParamStore(conf, name, 0, 0, partOptim{mt.optim, true}); err != nil {
+			return err
+		}
+	}
+	mt.loss = loss.NewLoss(conf.LossConfig)
+	mt.conf = conf
+	return nil
+}
+
+// partOptim sizes the entries of a store that keeps only the linear weights or only the embeddings of its keys,
+// the optimizer state of the other part is not allocated
+type partOptim struct {
+	optim.Optimizer
+	linear bool
+}
+
+func (o partOptim) StateSize(n int) (int, int) {
+	state, vecState := o.Optimizer.StateSize(n)
+	if o.linear {
+		return state, 0
+	}
+	return 0, vecState
+}
+
+// taskPath is the file of the linear part of a task, the shared embeddings are saved to path itself
+func (mt *MTFMModel) taskPath(path string, i int) string {
+	return fmt.Sprintf("%s.%s", path, mt.conf.MultiTaskConfig.TaskName[i])
+}
+
+// stores are the shared store and the stores of the tasks
+func (mt *MTFMModel) stores() []paramStore {
+	return append([]paramStore{mt.model}, mt.tasks...)
+}
+
+func (mt *MTFMModel) storeErr() error {
+	return storeErr(mt.stores()...)
+}
+
+func (mt *MTFMModel) paramStores() map[string]paramStore {
+	stores := map[string]paramStore{"": mt.model}
+	for i, name := range mt.conf.MultiTaskConfig.TaskName {
+		stores[name] = mt.tasks[i]
+	}
+	return stores
+}
+
+func (mt *MTFMModel) Close() error {
+	return closeStores(mt.stores()...)
+}
+
+func (mt *MTFMModel) Load(path string) error {
+	if err := loadStore(mt.model, path, mt.schedule); err != nil {
+		return err
+	}
+	for i, task := range mt.tasks {
+		if err := loadStore(task, mt.taskPath(path, i), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt *MTFMModel) Save(path string) error {
+	metaLine := fmt.Sprintf("%d\t%d\t", mt.embSize, 0)
+	n := len(mt.conf.FeatureList)
+	for i, feaInfo := range mt.conf.FeatureList {
+		info := fmt.Sprintf("%d:%d", feaInfo.SlotId, feaInfo.Cross)
+		metaLine += info
+		if i != n-1 {
+			metaLine += "\t"
+		}
+	}
+	if err := saveStore(mt.model, path, metaLine, mt.schedule); err != nil {
+		return err
+	}
+	for i, task := range mt.tasks {
+		if err := saveStore(task, mt.taskPath(path, i), metaLine, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Predict scores every task, Score is the first task. With esmm the second score is ctcvr = ctr * cvr,
+// aligned with the conversion label.
+func (mt *MTFMModel) Predict(inslist []*base.Instance) ([]base.Result, error) {
+	n := len(inslist)
+	res := make([]base.Result, n, n)
+	release := pullBatch(inslist, false, mt.stores()...)
+	for i := 0; i < n; i++ {
+		ins := inslist[i]
+		z, _ := mt.predict_(ins, false)
+		scores := make([]float32, mt.taskNum)
+		for t := range scores {
+			scores[t] = mt.loss.Predict(z[t])
+		}
+		if mt.esmm {
+			scores[1] = scores[0] * scores[1]
+		}
+		res[i] = base.Result{UserId: ins.UserId, Label: ins.Label, Score: scores[0],
+			Labels: mt.labels(ins), Scores: scores}
+	}
+	release()
+	return res, mt.storeErr()
+}
+
+func (mt *MTFMModel) Train(inslist []*base.Instance) error {
+	mt.schedule.Advance(len(inslist))
+	release := pullBatch(inslist, true, mt.stores()...)
+	for _, ins := range inslist {
+		z, gradVec := mt.predict_(ins, true)
+		labels := mt.labels(ins)
+		grads := mt.gradients(z, labels)
+		embGrad := float32(0.0)
+		for t := range grads {
+			embGrad += grads[t]
+		}
+		for _, gradv := range gradVec {
+			for j := range gradv {
+				gradv[j] *= embGrad
+			}
+		}
+		// tasks without a label have no loss
+		for t, task := range mt.tasks[:len(labels)] {
+			task.update(0, 0, labels[t], grads[t], mt.optim)
+			for _, fea := range ins.Feas {
+				task.update(fea.Fea, fea.Slot, labels[t], grads[t]*fea.Val(), mt.optim)
+			}
+		}
+		for j, fea := range ins.Feas {
+			mt.model.updateEmb(fea.Fea, fea.Slot, ins.Label, gradVec[j], mt.optim)
+		}
+	}
+	release()
+	return mt.storeErr()
+}
+
+// labels are the task labels of ins, a line may leave out the labels of the last tasks
+func (mt *MTFMModel) labels(ins *base.Instance) []float32 {
+	if ins.Labels == nil {
+		return []float32{ins.Label}
+	}
+	if len(ins.Labels) > mt.taskNum {
+		return ins.Labels[:mt.taskNum]
+	}
+	return ins.Labels
+}
+
+// gradients returns dloss/dz of each task, zero for the tasks without a label
+func (mt *MTFMModel) gradients(z []float32, labels []float32) []float32 {
+	grads := make([]float32, mt.taskNum)
+	if !mt.esmm || len(labels) < 2 {
+		for t := range labels {
+			grads[t] = mt.loss.Gradient(z[t], labels[t])
+		}
+		return grads
+	}
+	// esmm: loss = logloss(ctr, click) + logloss(ctr*cvr, conversion)
+	eps := float32(1e-7)
+	ctr, cvr := base.Sigmoid32(z[0]), base.Sigmoid32(z[1])
+	ctcvr := ctr * cvr
+	r := (ctcvr - labels[1]) / float32(math.Max(float64(1.0-ctcvr), float64(eps)))
+	grads[0] = ctr - labels[0] + r*(1.0-ctr)
+	grads[1] = r * (1.0 - cvr)
+	return grads
+}
+
+// predict_ returns the raw score of each task, and dz/dv of every feature embedding when needInit is set
+func (mt *MTFMModel) predict_(ins *base.Instance, needInit bool) ([]float32, [][]float32) {
+	z := make([]float32, mt.taskNum)
+	for t, task := range mt.tasks {
+		z[t] = task.getWeight(0, 0, "", false).W
+	}
+	cross := float32(0.0)
+	sumVec := make([]float32, mt.sumSize)
+	gradVec := make([][]float32, 0, len(ins.Feas))
+	for _, fea := range ins.Feas {
+		for t, task := range mt.tasks {
+			z[t] += task.getWeight(fea.Fea, fea.Slot, fea.Text, needInit).W * fea.Val()
+		}
+		x := fea.Val()
+		factor := mt.model.getWeight(fea.Fea, fea.Slot, fea.Text, needInit)
+		cross -= base.VecNorm32(factor.VecW) * x * x / 2.0
+		sumVec = base.InPlaceVecTimeAdd(sumVec, factor.VecW, 1.0, x)
+		gradVec = append(gradVec, factor.VecW)
+	}
+	cross += base.VecNorm32(sumVec) / 2.0
+	for t := range z {
+		z[t] += cross
+	}
+	if needInit {
+		for i, gradv := range gradVec {
+			x := ins.Feas[i].Val()
+			for j := range gradv {
+				gradv[j] = x * (sumVec[j] - gradv[j]*x)
+			}
+		}
+	}
+	return z, gradVec
+}
+
+func (mt *MTFMModel) Eval(p bool) {
+	mt.eval = p
+}
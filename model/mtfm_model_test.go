@@ -0,0 +1,188 @@
+package model
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+func _gen_mtfm_instance() []*base.Instance {
+	inslist := _gen_fm_instance()
+	inslist[0].Labels = []float32{0, 0}
+	inslist[1].Labels = []float32{1, 1}
+	return inslist
+}
+
+func _gen_mtfm_config(esmm bool) *conf.AllConfig {
+	config := _gen_fm_config()
+	config.MultiTaskConfig = &conf.MultiTaskConfig{TaskName: []string{"ctr", "cvr"}, Esmm: esmm}
+	return config
+}
+
+func TestMTFMModel_Init(t *testing.T) {
+	config := _gen_fm_config()
+	mt := &MTFMModel{}
+	if err := mt.Init(config); err == nil {
+		t.Error("init without task should fail")
+	}
+	config.MultiTaskConfig = &conf.MultiTaskConfig{TaskName: []string{"ctr", "cvr", "stay"}, Esmm: true}
+	if err := mt.Init(config); err == nil {
+		t.Error("esmm with 3 tasks should fail")
+	}
+	if err := mt.Init(_gen_mtfm_config(true)); err != nil || len(mt.tasks) != 2 {
+		t.Error("init esmm error: ", err)
+	}
+}
+
+func TestMTFMModel_Gradients(t *testing.T) {
+	mt := &MTFMModel{}
+	mt.Init(_gen_mtfm_config(true))
+	z := []float32{0.3, -0.4}
+	labels := []float32{1, 0}
+	esmmLoss := func(z0, z1 float64) float64 {
+		ctr, cvr := base.Sigmoid(z0), base.Sigmoid(z1)
+		return -math.Log(ctr) - math.Log(1-ctr*cvr)
+	}
+	eps := 1e-4
+	g0 := (esmmLoss(0.3+eps, -0.4) - esmmLoss(0.3-eps, -0.4)) / (2 * eps)
+	g1 := (esmmLoss(0.3, -0.4+eps) - esmmLoss(0.3, -0.4-eps)) / (2 * eps)
+	grads := mt.gradients(z, labels)
+	if math.Abs(float64(grads[0])-g0) > 1e-3 || math.Abs(float64(grads[1])-g1) > 1e-3 {
+		t.Errorf("esmm gradient = %v, numeric gradient = [%.6f %.6f]", grads, g0, g1)
+	}
+}
+
+func TestMTFMModel_Train_Predict(t *testing.T) {
+	rand.Seed(0)
+	insList := _gen_mtfm_instance()
+	mt := &MTFMModel{}
+	mt.Init(_gen_mtfm_config(true))
+	for i := 0; i < 5; i++ {
+		mt.Train(insList)
+	}
+	res, _ := mt.Predict(insList)
+	for i, r := range res {
+		if len(r.Scores) != 2 || len(r.Labels) != 2 || r.Score != r.Scores[0] {
+			t.Fatal("multi task result error: ", r)
+		}
+		if r.Scores[1] > r.Scores[0] {
+			t.Errorf("ctcvr should not be greater than ctr: %d %v", i, r.Scores)
+		}
+	}
+	if res[1].Scores[0] <= res[0].Scores[0] || res[1].Scores[1] <= res[0].Scores[1] {
+		t.Error("positive instance should be scored higher on both tasks: ", res[0].Scores, res[1].Scores)
+	}
+	// embeddings are shared, linear weights are not
+	if len(mt.model.get(3, 103, false).VecW) != 2 {
+		t.Error("shared embedding not created")
+	}
+	if !base.NEQFloat32(mt.tasks[0].get(3, 103, false).W, mt.tasks[1].get(3, 103, false).W) {
+		t.Error("task linear weights should differ")
+	}
+}
+
+func TestMTFMModel_Save_Load(t *testing.T) {
+	save_path := "/tmp/mtfm_model"
+	insList := _gen_mtfm_instance()
+	config := _gen_mtfm_config(false)
+	mt := &MTFMModel{}
+	mt.Init(config)
+	mt.Train(insList)
+	if err := mt.Save(save_path); err != nil {
+		t.Error("save file error: ", err)
+	}
+	new_mt := &MTFMModel{}
+	new_mt.Init(config)
+	if err := new_mt.Load(save_path); err != nil {
+		t.Error("load file error: ", err)
+	}
+	res, _ := mt.Predict(insList)
+	new_res, _ := new_mt.Predict(insList)
+	for i := range res {
+		if base.NEQSliceFloat32(res[i].Scores, new_res[i].Scores) {
+			t.Error("predict after load error: ", res[i].Scores, new_res[i].Scores)
+		}
+	}
+}
+
+func TestMTFMModel_MissingLabel(t *testing.T) {
+	insList := _gen_fm_instance()
+	mt := &MTFMModel{}
+	mt.Init(_gen_mtfm_config(true))
+	mt.Train(insList)
+	// only the first task has a label, the second is not trained
+	if p := mt.tasks[0].get(3, 103, false); p == nil || p.Show != 1 {
+		t.Errorf("labeled task should be trained: %v", p)
+	}
+	if p := mt.tasks[1].get(3, 103, false); p != nil && (p.Show != 0 || p.W != 0) {
+		t.Errorf("task without label should not be trained: %v", p)
+	}
+	if w := mt.tasks[1].get(0, 0, false).W; w != 0 {
+		t.Errorf("bias of the task without label should not move: %v", w)
+	}
+	res, _ := mt.Predict(insList)
+	if len(res[0].Labels) != 1 || len(res[0].Scores) != 2 {
+		t.Errorf("missing labels should not be reported: %v", res[0])
+	}
+}
+
+func TestMTFMModel_StateSize(t *testing.T) {
+	config := _gen_mtfm_config(false)
+	config.OptimConfig.Optimizer = "adam"
+	config.ParamStore = "arena"
+	mt := &MTFMModel{}
+	if err := mt.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	mt.Train(_gen_mtfm_instance())
+	// the shared store keeps no linear state, the task stores no embedding state
+	if p := mt.model.get(3, 103, false); len(p.State) != 0 || len(p.VecState) != 5 {
+		t.Errorf("shared state %v %v", p.State, p.VecState)
+	}
+	if p := mt.tasks[0].get(3, 103, false); len(p.State) != 3 || len(p.VecState) != 0 {
+		t.Errorf("task state %v %v", p.State, p.VecState)
+	}
+}
+
+func TestMTFMModel_SeedSave(t *testing.T) {
+	save := func(dir string) {
+		config := _gen_mtfm_config(false)
+		config.Seed = 7
+		mt := &MTFMModel{}
+		if err := mt.Init(config); err != nil {
+			t.Fatal(err)
+		}
+		var inslist []*base.Instance
+		for i := 1; i <= 200; i++ {
+			inslist = append(inslist, &base.Instance{Feas: []*base.Feature{{Fea: uint64(i), Slot: 101},
+				{Fea: uint64(1000 + i%7), Slot: 201}}, Label: float32(i % 2), Labels: []float32{float32(i % 2), 0}})
+		}
+		mt.Train(inslist)
+		if err := mt.Save(filepath.Join(dir, "model")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := t.TempDir(), t.TempDir()
+	save(a)
+	save(b)
+	// the shared and every task file are written in key order
+	for _, name := range []string{"model", "model.ctr", "model.cvr"} {
+		da, err := os.ReadFile(filepath.Join(a, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := os.ReadFile(filepath.Join(b, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(da, db) {
+			t.Errorf("%s differs between two seeded runs", name)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"sort"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+	"linearmodel/optim"
+)
+
+// kinds of a pushed gradient, one per update method of paramStore
+const (
+	psUpdate = iota
+	psUpdateEmb
+	psUpdateWeightAndEmb
+	psApplyGrad
+)
+
+// PSServer owns the keys k with k % shards == shard of every store of a parameter server job.
+// A store is created by the first worker that inits it, and the optimizer runs on the server.
+type PSServer struct {
+	config *conf.AllConfig
+	shard  int
+	shards int
+
+	mu     sync.Mutex
+	stores map[string]*psShard
+}
+
+type psShard struct {
+	store    paramStore
+	schedule *optim.Schedule
+	optim    optim.Optimizer
+	steps    map[uint64]int64 // last step pushed by every worker
+	stepLock sync.Mutex
+	// push, set and each take lock alone, so a get or pull never reads a parameter being updated
+	lock sync.RWMutex
+
+	cursorLock sync.Mutex
+	cursors    map[uint64][]PSEntry // entries left to page of every Each in progress
+	nextCursor uint64
+}
+
+type PSInitArgs struct {
+	Name string
+	Size uint32
+	Norm float32
+}
+
+// PSSlotArgs carries the slots of a store with their own embedding size and init norm
+type PSSlotArgs struct {
+	Name  string
+	Slots map[uint16]PSSlot
+}
+
+type PSSlot struct {
+	Size uint32
+	Norm float32
+}
+
+// slotSetter is a store that takes the slots of a worker
+type slotSetter interface {
+	setSlots(slots map[uint16]slotInfo)
+}
+
+type PSKeyArgs struct {
+	Name     string
+	Key      uint64
+	Slot     uint16
+	Text     string
+	NeedInit bool
+}
+
+type PSParam struct {
+	Found bool
+	P     base.Parameter
+}
+
+type PSSetArgs struct {
+	Name string
+	Key  uint64
+	P    base.Parameter
+}
+
+type PSGrad struct {
+	Kind    int
+	Key     uint64
+	Slot    uint16
+	Label   float32
+	Show    int
+	Click   int
+	Grad    float32
+	GradVec []float32
+}
+
+// PSPushArgs is a batch of gradients, Step is the number of instances the worker trained so far
+type PSPushArgs struct {
+	Name   string
+	Worker uint64
+	Step   int64
+	Grads  []PSGrad
+}
+
+// PSPullArgs asks for the weights of keys, texts are kept for keys created by the pull
+type PSPullArgs struct {
+	Name     string
+	NeedInit bool
+	Keys     []uint64
+	Slots    []uint16
+	Texts    []string
+}
+
+func (a *PSPullArgs) add(key uint64, slot uint16, text string) {
+	a.Keys = append(a.Keys, key)
+	a.Slots = append(a.Slots, slot)
+	a.Texts = append(a.Texts, text)
+}
+
+type PSEntry struct {
+	Key uint64
+	P   base.Parameter
+}
+
+type PSSetAllArgs struct {
+	Name    string
+	Entries []PSEntry
+}
+
+// PSEachArgs asks for the next page of an Each, cursor 0 starts a new one
+type PSEachArgs struct {
+	Name   string
+	Cursor uint64
+	Limit  int
+}
+
+// PSEachReply is a page of entries in key order, Cursor is 0 after the last page
+type PSEachReply struct {
+	Cursor  uint64
+	Entries []PSEntry
+}
+
+func NewPSServer(config *conf.AllConfig, shard, shards int) *PSServer {
+	return &PSServer{config: config, shard: shard, shards: shards, stores: make(map[string]*psShard)}
+}
+
+// psRPC holds the methods workers call, apart from those of PSServer
+type psRPC PSServer
+
+// Serve answers workers on l until it is closed
+func (s *PSServer) Serve(l net.Listener) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("PS", (*psRPC)(s)); err != nil {
+		glog.Fatalf("register ps server error: %v", err)
+	}
+	glog.Infof("ps server %d/%d listens on %s", s.shard, s.shards, l.Addr())
+	server.Accept(l)
+}
+
+func (s *psRPC) shardOf(name string) (*psShard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh, ok := s.stores[name]
+	if !ok {
+		return nil, fmt.Errorf("ps store %q is not initialized", name)
+	}
+	return sh, nil
+}
+
+func (s *psRPC) Init(args *PSInitArgs, reply *bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.stores[args.Name]; ok {
+		*reply = true
+		return nil
+	}
+	config := proto.Clone(s.config).(*conf.AllConfig)
+	if config.ParamStore == "ps" {
+		config.ParamStore = "map"
+	}
+	schedule := optim.NewSchedule(config.OptimConfig)
+	opt := optim.NewOptimizer(config.OptimConfig, config.FeatureList, schedule)
+	store, err := newParamStore(config, args.Name, args.Size, args.Norm, opt)
+	if err != nil {
+		return err
+	}
+	s.stores[args.Name] = &psShard{store: store, schedule: schedule, optim: opt, steps: make(map[uint64]int64),
+		cursors: make(map[uint64][]PSEntry)}
+	glog.Infof("ps server %d inits store %q of emb size %d", s.shard, args.Name, args.Size)
+	*reply = true
+	return nil
+}
+
+func (s *psRPC) InitSlots(args *PSSlotArgs, reply *bool) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	st, ok := sh.store.(slotSetter)
+	if !ok {
+		return fmt.Errorf("ps store %q of type %T has no slots", args.Name, sh.store)
+	}
+	slots := make(map[uint16]slotInfo, len(args.Slots))
+	for slot, x := range args.Slots {
+		slots[slot] = slotInfo{size: x.Size, norm: x.Norm}
+	}
+	st.setSlots(slots)
+	*reply = true
+	return nil
+}
+
+func (s *psRPC) InitEmb(args *PSSlotArgs, reply *bool) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	*reply = true
+	return sh.store.initEmb(s.config)
+}
+
+func (s *psRPC) GetWeight(args *PSKeyArgs, reply *base.Weight) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	sh.lock.RLock()
+	defer sh.lock.RUnlock()
+	*reply = copyWeight(sh.store.getWeight(args.Key, args.Slot, args.Text, args.NeedInit))
+	return nil
+}
+
+// Pull returns the weights of args.Keys in order
+func (s *psRPC) Pull(args *PSPullArgs, reply *[]base.Weight) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	sh.lock.RLock()
+	defer sh.lock.RUnlock()
+	weights := make([]base.Weight, len(args.Keys))
+	for i, key := range args.Keys {
+		weights[i] = copyWeight(sh.store.getWeight(key, args.Slots[i], args.Texts[i], args.NeedInit))
+	}
+	*reply = weights
+	return nil
+}
+
+func (s *psRPC) Get(args *PSKeyArgs, reply *PSParam) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	sh.lock.RLock()
+	defer sh.lock.RUnlock()
+	if p := sh.store.get(args.Key, args.Slot, args.NeedInit); p != nil {
+		reply.Found, reply.P = true, copyParameter(p)
+	}
+	return nil
+}
+
+func (s *psRPC) Set(args *PSSetArgs, reply *bool) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	p := args.P
+	sh.store.set(args.Key, &p)
+	*reply = true
+	return nil
+}
+
+// SetAll sets the parameters of a batch of keys
+// SetAll sets the entries of a load in one call
+func (s *psRPC) SetAll(args *PSSetAllArgs, reply *bool) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	for i := range args.Entries {
+		sh.store.set(args.Entries[i].Key, &args.Entries[i].P)
+	}
+	*reply = true
+	return nil
+}
+
+// Push applies gradients with the optimizer of the server, after moving its schedule by the
+// instances the worker trained since its last push
+func (s *psRPC) Push(args *PSPushArgs, reply *bool) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	sh.stepLock.Lock()
+	if last := sh.steps[args.Worker]; args.Step > last {
+		sh.schedule.Advance(int(args.Step - last))
+		sh.steps[args.Worker] = args.Step
+	}
+	sh.stepLock.Unlock()
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	for i := range args.Grads {
+		g := &args.Grads[i]
+		switch g.Kind {
+		case psUpdate:
+			sh.store.update(g.Key, g.Slot, g.Label, g.Grad, sh.optim)
+		case psUpdateEmb:
+			sh.store.updateEmb(g.Key, g.Slot, g.Label, g.GradVec, sh.optim)
+		case psUpdateWeightAndEmb:
+			sh.store.updateWeightAndEmb(g.Key, g.Slot, g.Label, g.Grad, g.GradVec, sh.optim)
+		case psApplyGrad:
+			sh.store.applyGrad(g.Key, g.Slot, g.Show, g.Click, g.Grad, g.GradVec, sh.optim)
+		default:
+			return fmt.Errorf("unknown gradient kind %d", g.Kind)
+		}
+	}
+	*reply = true
+	return nil
+}
+
+// Each returns the parameters of the shard other than the bias in key order, args.Limit at a time. The
+// first page copies the shard while no push or pull runs, and the next pages are read from the copy.
+// The copy of an Each not paged to its end is kept until the server stops.
+func (s *psRPC) Each(args *PSEachArgs, reply *PSEachReply) error {
+	sh, err := s.shardOf(args.Name)
+	if err != nil {
+		return err
+	}
+	if args.Limit <= 0 {
+		return fmt.Errorf("each of ps store %q needs a page limit", args.Name)
+	}
+	var entries []PSEntry
+	if args.Cursor == 0 {
+		sh.lock.Lock()
+		sh.store.each(func(k uint64, v *base.Parameter) {
+			entries = append(entries, PSEntry{Key: k, P: copyParameter(v)})
+		})
+		sh.lock.Unlock()
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Key < entries[j].Key
+		})
+	} else {
+		sh.cursorLock.Lock()
+		var ok bool
+		entries, ok = sh.cursors[args.Cursor]
+		delete(sh.cursors, args.Cursor)
+		sh.cursorLock.Unlock()
+		if !ok {
+			return fmt.Errorf("each of ps store %q has no cursor %d", args.Name, args.Cursor)
+		}
+	}
+	if len(entries) <= args.Limit {
+		reply.Cursor, reply.Entries = 0, entries
+		return nil
+	}
+	sh.cursorLock.Lock()
+	sh.nextCursor++
+	reply.Cursor = sh.nextCursor
+	sh.cursors[reply.Cursor] = entries[args.Limit:]
+	sh.cursorLock.Unlock()
+	reply.Entries = entries[:args.Limit]
+	return nil
+}
+
+// copyWeight and copyParameter copy the vectors too, a reply is encoded after the lock of the shard is
+// released
+func copyWeight(w *base.Weight) base.Weight {
+	return base.Weight{W: w.W, VecW: append([]float32(nil), w.VecW...)}
+}
+
+func copyParameter(p *base.Parameter) base.Parameter {
+	c := *p
+	c.State = append([]float32(nil), p.State...)
+	c.VecW = append([]float32(nil), p.VecW...)
+	c.VecZ = append([]float32(nil), p.VecZ...)
+	c.VecN = append([]float32(nil), p.VecN...)
+	c.VecState = append([]float32(nil), p.VecState...)
+	return c
+}
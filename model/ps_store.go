@@ -0,0 +1,390 @@
+package model
+
+import (
+	"fmt"
+	"net/rpc"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+	"linearmodel/optim"
+)
+
+// psStore is the paramStore of a worker: every key lives on parameter server key % n, weights
+// are pulled by key and gradients are pushed to the optimizer of the server, the opt argument of
+// the update methods is not used. A failed call is logged and its error is kept for failingStore,
+// the models return it from Train so the trainer counts the batch as failed.
+type psStore struct {
+	slotTable
+	name     string
+	worker   uint64 // ps_worker of the config, tells apart the steps of the workers on a server
+	servers  []string
+	clients  []*rpc.Client
+	schedule *optim.Schedule // global step of the worker, sent along with gradients
+
+	mu     sync.Mutex
+	failed error // first error of a call since the last err
+	calls  int64 // calls made, read by tests
+
+	open        int32 // batches between pull and release
+	cacheLock   sync.RWMutex
+	cache       map[uint64]*psCached // weights pulled for the open batches
+	pendingLock sync.Mutex
+	pending     [][]PSGrad // gradients of the open batches by server
+}
+
+// psEachPage is the number of entries a server sends per call of each
+const psEachPage = 1 << 16
+
+// psCached is a pulled weight and the number of open batches that pulled it
+type psCached struct {
+	w    base.Weight
+	refs int
+}
+
+// pullStore is a store that fetches the weights of a batch before training it and sends its gradients after.
+// Weights read between pull and release are those pulled, gradients are sent by release.
+type pullStore interface {
+	pull(inslist []*base.Instance, needInit bool) []uint64
+	release(keys []uint64)
+}
+
+// pullBatch pulls the weights of inslist for the stores that pull, the returned func releases them
+func pullBatch(inslist []*base.Instance, needInit bool, stores ...paramStore) func() {
+	var release []func()
+	for _, s := range stores {
+		if p, ok := s.(pullStore); ok {
+			keys := p.pull(inslist, needInit)
+			release = append(release, func() { p.release(keys) })
+		}
+	}
+	return func() {
+		for _, f := range release {
+			f()
+		}
+	}
+}
+
+func newPSStore(config *conf.AllConfig, name string, size uint32, norm float32, opt optim.Optimizer) (*psStore,
+	error) {
+	if len(config.PsServers) == 0 {
+		return nil, fmt.Errorf("ps param_store needs ps_servers")
+	}
+	s := &psStore{name: name, worker: config.PsWorker, servers: config.PsServers, cache: make(map[uint64]*psCached),
+		pending: make([][]PSGrad, len(config.PsServers))}
+	if opt != nil {
+		s.schedule = opt.Schedule()
+	}
+	s.size = size
+	s.norm = norm
+	s.seed = config.Seed
+	for _, addr := range config.PsServers {
+		client, err := rpc.Dial("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("connect ps server %s error: %v", addr, err)
+		}
+		s.clients = append(s.clients, client)
+	}
+	args := &PSInitArgs{Name: name, Size: size, Norm: norm}
+	for i := range s.clients {
+		if err := s.clients[i].Call("PS.Init", args, new(bool)); err != nil {
+			return nil, fmt.Errorf("init ps server %s error: %v", s.servers[i], err)
+		}
+	}
+	return s, nil
+}
+
+func (s *psStore) server(key uint64) int {
+	return int(key % uint64(len(s.clients)))
+}
+
+func (s *psStore) call(i int, method string, args interface{}, reply interface{}) error {
+	atomic.AddInt64(&s.calls, 1)
+	err := s.clients[i].Call(method, args, reply)
+	if err != nil {
+		err = fmt.Errorf("%s on ps server %s error: %v", method, s.servers[i], err)
+		glog.Error(err)
+		s.mu.Lock()
+		if s.failed == nil {
+			s.failed = err
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *psStore) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.failed
+	s.failed = nil
+	return err
+}
+
+func (s *psStore) initSlots(features []*conf.FeatureConfig, norm func(size uint32) float32) uint32 {
+	maxSize := s.slotTable.initSlots(features, norm)
+	args := &PSSlotArgs{Name: s.name, Slots: make(map[uint16]PSSlot)}
+	for slot, info := range s.slots {
+		args.Slots[slot] = PSSlot{Size: info.size, Norm: info.norm}
+	}
+	for i := range s.clients {
+		s.call(i, "PS.InitSlots", args, new(bool))
+	}
+	return maxSize
+}
+
+func (s *psStore) initEmb(config *conf.AllConfig) error {
+	// an error of initSlots
+	if err := s.err(); err != nil {
+		return err
+	}
+	// the local init only checks the config, embeddings are created by the servers
+	if err := s.slotTable.initEmb(config); err != nil {
+		return err
+	}
+	for i := range s.clients {
+		if err := s.clients[i].Call("PS.InitEmb", &PSSlotArgs{Name: s.name}, new(bool)); err != nil {
+			return fmt.Errorf("init emb of ps server %s error: %v", s.servers[i], err)
+		}
+	}
+	return nil
+}
+
+// getWeight reads the weights pulled for the batches being trained, keys not pulled are fetched alone
+func (s *psStore) getWeight(key uint64, slot uint16, text string, needInit bool) *base.Weight {
+	s.cacheLock.RLock()
+	c, ok := s.cache[key]
+	s.cacheLock.RUnlock()
+	if ok {
+		w := c.w
+		w.VecW = append([]float32(nil), c.w.VecW...)
+		return &w
+	}
+	w := new(base.Weight)
+	s.call(s.server(key), "PS.GetWeight", &PSKeyArgs{Name: s.name, Key: key, Slot: slot, Text: text,
+		NeedInit: needInit}, w)
+	s.fillVec(key, slot, w)
+	return w
+}
+
+// fillVec gives a weight never created its zero embedding, it comes back without one
+func (s *psStore) fillVec(key uint64, slot uint16, w *base.Weight) {
+	if key != 0 {
+		size, _ := s.sizeOf(slot)
+		if len(w.VecW) != int(size) {
+			w.VecW = make([]float32, size)
+		}
+	}
+}
+
+// pull fetches the weights of the keys of inslist and the bias with one call per server. The
+// weights are read by getWeight, and gradients are kept to be pushed by the end of the batch.
+// Batches of several training threads may overlap.
+func (s *psStore) pull(inslist []*base.Instance, needInit bool) []uint64 {
+	args := make([]PSPullArgs, len(s.clients))
+	seen := map[uint64]bool{0: true}
+	args[s.server(0)].add(0, 0, "")
+	for _, ins := range inslist {
+		for _, fea := range ins.Feas {
+			if !seen[fea.Fea] {
+				seen[fea.Fea] = true
+				args[s.server(fea.Fea)].add(fea.Fea, fea.Slot, fea.Text)
+			}
+		}
+	}
+	atomic.AddInt32(&s.open, 1)
+	replies := make([][]base.Weight, len(s.clients))
+	group := sync.WaitGroup{}
+	for i := range args {
+		if len(args[i].Keys) == 0 {
+			continue
+		}
+		args[i].Name, args[i].NeedInit = s.name, needInit
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			s.call(i, "PS.Pull", &args[i], &replies[i])
+		}(i)
+	}
+	group.Wait()
+	keys := make([]uint64, 0, len(seen))
+	s.cacheLock.Lock()
+	for i := range args {
+		for j, key := range args[i].Keys {
+			c, ok := s.cache[key]
+			if !ok {
+				c = &psCached{}
+				s.cache[key] = c
+			}
+			c.refs++
+			keys = append(keys, key)
+			if j < len(replies[i]) {
+				c.w = replies[i][j]
+			} else if ok {
+				// a failed pull keeps the weight of another batch, the error is returned by the batch
+				continue
+			}
+			s.fillVec(key, args[i].Slots[j], &c.w)
+		}
+	}
+	s.cacheLock.Unlock()
+	return keys
+}
+
+// release pushes the gradients kept so far with one call per server, and drops the weights
+// pulled for keys that no other batch uses
+func (s *psStore) release(keys []uint64) {
+	atomic.AddInt32(&s.open, -1)
+	s.pushPending()
+	s.cacheLock.Lock()
+	for _, key := range keys {
+		if c := s.cache[key]; c != nil {
+			if c.refs--; c.refs == 0 {
+				delete(s.cache, key)
+			}
+		}
+	}
+	s.cacheLock.Unlock()
+}
+
+func (s *psStore) get(key uint64, slot uint16, needInit bool) *base.Parameter {
+	reply := new(PSParam)
+	err := s.call(s.server(key), "PS.Get", &PSKeyArgs{Name: s.name, Key: key, Slot: slot, NeedInit: needInit}, reply)
+	if err != nil || !reply.Found {
+		return nil
+	}
+	return &reply.P
+}
+
+func (s *psStore) set(key uint64, parameter *base.Parameter) {
+	s.call(s.server(key), "PS.Set", &PSSetArgs{Name: s.name, Key: key, P: *parameter}, new(bool))
+}
+
+// setAll sets entries with one call per server, a failed call is returned by err
+func (s *psStore) setAll(entries []PSEntry) {
+	args := make([]PSSetAllArgs, len(s.clients))
+	for i := range entries {
+		j := s.server(entries[i].Key)
+		args[j].Entries = append(args[j].Entries, entries[i])
+	}
+	group := sync.WaitGroup{}
+	for i := range args {
+		if len(args[i].Entries) == 0 {
+			continue
+		}
+		args[i].Name = s.name
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			s.call(i, "PS.SetAll", &args[i], new(bool))
+		}(i)
+	}
+	group.Wait()
+}
+
+// each visits the servers in turn, keys of a server in ascending order and psEachPage per call. It stops at
+// a failed call, which is returned by err.
+func (s *psStore) each(f func(key uint64, p *base.Parameter)) {
+	for i := range s.clients {
+		args := &PSEachArgs{Name: s.name, Limit: psEachPage}
+		for {
+			reply := new(PSEachReply)
+			if s.call(i, "PS.Each", args, reply) != nil {
+				return
+			}
+			for j := range reply.Entries {
+				f(reply.Entries[j].Key, &reply.Entries[j].P)
+			}
+			if reply.Cursor == 0 {
+				break
+			}
+			args.Cursor = reply.Cursor
+		}
+	}
+}
+
+// push sends grads of keys owned by server i along with the step of the worker
+func (s *psStore) push(i int, grads []PSGrad) {
+	args := &PSPushArgs{Name: s.name, Worker: s.worker, Step: s.schedule.Step(), Grads: grads}
+	s.call(i, "PS.Push", args, new(bool))
+}
+
+// pushOne keeps g for the end of the batch, or pushes it at once when no batch is open
+func (s *psStore) pushOne(g PSGrad) {
+	if atomic.LoadInt32(&s.open) == 0 {
+		s.push(s.server(g.Key), []PSGrad{g})
+		return
+	}
+	// the caller may reuse the vector
+	g.GradVec = append([]float32(nil), g.GradVec...)
+	i := s.server(g.Key)
+	s.pendingLock.Lock()
+	s.pending[i] = append(s.pending[i], g)
+	s.pendingLock.Unlock()
+}
+
+// pushPending pushes the gradients kept for every server, with one call per server
+func (s *psStore) pushPending() {
+	s.pendingLock.Lock()
+	batches := s.pending
+	s.pending = make([][]PSGrad, len(s.clients))
+	s.pendingLock.Unlock()
+	s.pushAll(batches)
+}
+
+func (s *psStore) pushAll(batches [][]PSGrad) {
+	group := sync.WaitGroup{}
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		group.Add(1)
+		go func(i int, batch []PSGrad) {
+			defer group.Done()
+			s.push(i, batch)
+		}(i, batch)
+	}
+	group.Wait()
+}
+
+func (s *psStore) update(key uint64, slot uint16, label float32, grad float32, opt optim.Optimizer) {
+	s.pushOne(PSGrad{Kind: psUpdate, Key: key, Slot: slot, Label: label, Grad: grad})
+}
+
+func (s *psStore) updateEmb(key uint64, slot uint16, label float32, grad []float32, opt optim.Optimizer) {
+	s.pushOne(PSGrad{Kind: psUpdateEmb, Key: key, Slot: slot, Label: label, GradVec: grad})
+}
+
+func (s *psStore) updateWeightAndEmb(key uint64, slot uint16, label float32, grad float32, gradVec []float32,
+	opt optim.Optimizer) {
+	s.pushOne(PSGrad{Kind: psUpdateWeightAndEmb, Key: key, Slot: slot, Label: label, Grad: grad, GradVec: gradVec})
+}
+
+func (s *psStore) applyGrad(key uint64, slot uint16, show, click int, grad float32, gradVec []float32,
+	opt optim.Optimizer) {
+	s.pushOne(PSGrad{Kind: psApplyGrad, Key: key, Slot: slot, Show: show, Click: click, Grad: grad, GradVec: gradVec})
+}
+
+// applyBatch keeps the gradients of a mini batch for the end of the batch, or pushes them with one call
+// per server when no batch is open
+func (s *psStore) applyBatch(grads []keyGrad) {
+	batches := make([][]PSGrad, len(s.clients))
+	for i := range grads {
+		kg := &grads[i]
+		j := s.server(kg.key)
+		batches[j] = append(batches[j], PSGrad{Kind: psApplyGrad, Key: kg.key, Slot: kg.slot, Show: kg.show,
+			Click: kg.click, Grad: kg.grad, GradVec: kg.gradVec})
+	}
+	if atomic.LoadInt32(&s.open) == 0 {
+		s.pushAll(batches)
+		return
+	}
+	s.pendingLock.Lock()
+	for i := range batches {
+		s.pending[i] = append(s.pending[i], batches[i]...)
+	}
+	s.pendingLock.Unlock()
+}
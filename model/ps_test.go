@@ -0,0 +1,320 @@
+package model
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// startPS serves n parameter servers of config on loopback and sets ps_servers
+func startPS(t *testing.T, config *conf.AllConfig, n int) {
+	config.PsServers = nil
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go NewPSServer(config, i, n).Serve(l)
+		config.PsServers = append(config.PsServers, l.Addr().String())
+	}
+}
+
+func TestPSStore_SameAsMap(t *testing.T) {
+	insList := _gen_bench_instance(200, 8, 50)
+	size := uint32(3)
+	for _, name := range []string{"lr", "fm", "fm_batch"} {
+		var stores [2]paramStore
+		for i, store := range []string{"map", "ps"} {
+			config := _gen_fm_config()
+			config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: 102},
+				&conf.FeatureConfig{SlotId: 104, EmbSize: &size})
+			config.OptimConfig.Optimizer = "adam"
+			config.OptimConfig.LrSchedule = "inverse_sqrt"
+			config.OptimConfig.WarmupSteps = 50
+			config.Seed = 1
+			config.MiniBatch = name == "fm_batch"
+			if store == "ps" {
+				startPS(t, config, 3)
+				config.ParamStore = "ps"
+			}
+			var m IModel
+			if name == "lr" {
+				lr := &LRModel{}
+				if err := lr.Init(config); err != nil {
+					t.Fatal(err)
+				}
+				m, stores[i] = lr, lr.model
+			} else {
+				fm := &FMModel{}
+				if err := fm.Init(config); err != nil {
+					t.Fatal(err)
+				}
+				m, stores[i] = fm, fm.model
+			}
+			// a ps worker reads the weights pulled at the start of a batch, so without mini_batch both
+			// train an instance per batch
+			for j := 0; j < 2; j++ {
+				if config.MiniBatch {
+					m.Train(insList)
+					continue
+				}
+				for _, ins := range insList {
+					m.Train([]*base.Instance{ins})
+				}
+			}
+		}
+		count := 0
+		stores[0].each(func(k uint64, v *base.Parameter) {
+			count++
+			p := stores[1].get(k, v.Slot, false)
+			if p == nil || !base.EQParameter(v, p, false) || !eqState(v, p) {
+				t.Errorf("%s: ps store differs at key %d: %v %v", name, k, v, p)
+			}
+		})
+		stores[1].each(func(k uint64, v *base.Parameter) {
+			count--
+		})
+		if count != 0 {
+			t.Errorf("%s: key count differs by %d", name, count)
+		}
+		if !base.EQParameter(stores[0].get(0, 0, false), stores[1].get(0, 0, false), true) {
+			t.Errorf("%s: bias differs", name)
+		}
+	}
+}
+
+func TestPSStore_CallsPerBatch(t *testing.T) {
+	insList := _gen_bench_instance(200, 8, 50)
+	for _, miniBatch := range []bool{false, true} {
+		config := _gen_fm_config()
+		config.MiniBatch = miniBatch
+		startPS(t, config, 3)
+		config.ParamStore = "ps"
+		fm := &FMModel{}
+		if err := fm.Init(config); err != nil {
+			t.Fatal(err)
+		}
+		s := fm.model.(*psStore)
+		calls := s.calls
+		if err := fm.Train(insList); err != nil {
+			t.Fatal(err)
+		}
+		// a pull and a push per server
+		if n := s.calls - calls; n != 6 {
+			t.Errorf("mini_batch %v: train took %d calls, want 6", miniBatch, n)
+		}
+		calls = s.calls
+		if _, err := fm.Predict(insList); err != nil {
+			t.Fatal(err)
+		}
+		if n := s.calls - calls; n != 3 {
+			t.Errorf("mini_batch %v: predict took %d calls, want 3", miniBatch, n)
+		}
+		if len(s.cache) != 0 {
+			t.Errorf("mini_batch %v: %d weights left in the cache", miniBatch, len(s.cache))
+		}
+	}
+}
+
+func TestPSStore_SaveLoad(t *testing.T) {
+	config := _gen_fm_config()
+	startPS(t, config, 2)
+	config.ParamStore = "ps"
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	fm.Train(_gen_fm_instance())
+	path := filepath.Join(t.TempDir(), "model")
+	if err := fm.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	// a second job loads the model into its own servers
+	loadConfig := _gen_fm_config()
+	startPS(t, loadConfig, 3)
+	loadConfig.ParamStore = "ps"
+	loaded := &FMModel{}
+	if err := loaded.Init(loadConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	res, _ := fm.Predict(_gen_fm_instance())
+	res2, _ := loaded.Predict(_gen_fm_instance())
+	if base.NEQFloat32(res[0].Score, res2[0].Score) || base.NEQFloat32(res[1].Score, res2[1].Score) {
+		t.Errorf("loaded model predicts %v, want %v", res2, res)
+	}
+
+	config.PsServers = nil
+	if err := (&FMModel{}).Init(config); err == nil {
+		t.Error("ps store without servers should fail")
+	}
+}
+
+func TestPSStore_CallError(t *testing.T) {
+	config := _gen_fm_config()
+	startPS(t, config, 2)
+	config.ParamStore = "ps"
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.Train(_gen_fm_instance()); err != nil {
+		t.Fatal(err)
+	}
+	fm.model.(*psStore).clients[1].Close()
+	if err := fm.Train(_gen_fm_instance()); err == nil {
+		t.Error("train with a closed server should fail")
+	}
+	if _, err := fm.Predict(_gen_fm_instance()); err == nil {
+		t.Error("predict with a closed server should fail")
+	}
+	if err := fm.Save(filepath.Join(t.TempDir(), "model")); err == nil {
+		t.Error("save with a closed server should fail")
+	}
+}
+
+func TestPSServer_Slots(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// the server takes the slots of the worker, not those of its own feature list
+	server := NewPSServer(_gen_fm_config(), 0, 1)
+	go server.Serve(l)
+	config := _gen_fm_config()
+	config.PsServers = []string{l.Addr().String()}
+	config.ParamStore = "ps"
+	size, other := uint32(3), uint32(5)
+	config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: 102, EmbSize: &size},
+		&conf.FeatureConfig{SlotId: 104, EmbSize: &other})
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "task"} {
+		if name != "" {
+			s, err := newPSStore(config, name, 2, 0.5, fm.optim)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.initSlots(config.FeatureList[:5], func(size uint32) float32 { return 0.25 })
+		}
+		sh, err := (*psRPC)(server).shardOf(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, slot := range []uint16{101, 102, 104} {
+			wantSize, wantNorm := fm.model.sizeOf(slot)
+			if name != "" {
+				wantSize, wantNorm = 2, 0.5
+				if slot == 102 {
+					wantSize, wantNorm = 3, 0.25
+				}
+			}
+			if size, norm := sh.store.sizeOf(slot); size != wantSize || norm != wantNorm {
+				t.Errorf("store %q slot %d: size %d norm %g, want %d %g", name, slot, size, norm, wantSize, wantNorm)
+			}
+		}
+	}
+}
+
+func TestPSStore_SaveWhileTraining(t *testing.T) {
+	config := _gen_fm_config()
+	startPS(t, config, 2)
+	config.ParamStore = "ps"
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	insList := _gen_bench_instance(200, 8, 1000)
+	done := make(chan error)
+	go func() {
+		for _, ins := range insList {
+			if err := fm.Train([]*base.Instance{ins}); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	// a checkpoint saves while keys are pushed, run with -race
+	path := filepath.Join(t.TempDir(), "model")
+	for i := 0; i < 5; i++ {
+		if err := fm.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPSServer_EachPages(t *testing.T) {
+	config := _gen_fm_config()
+	startPS(t, config, 1)
+	config.ParamStore = "ps"
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	fm.Train(_gen_bench_instance(50, 8, 100))
+	want := 0
+	fm.model.each(func(key uint64, p *base.Parameter) { want++ })
+
+	s := fm.model.(*psStore)
+	var entries []PSEntry
+	s.each(func(key uint64, p *base.Parameter) { entries = append(entries, PSEntry{Key: key, P: *p}) })
+	// setting the entries back leaves the store as it is
+	s.setAll(entries)
+	if err := storeErr(s); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	fm.model.each(func(key uint64, p *base.Parameter) { count++ })
+	if count != want {
+		t.Errorf("set all changed the key count from %d to %d", want, count)
+	}
+
+	// the store of the worker is copied to a local server and paged three keys at a time
+	server := (*psRPC)(NewPSServer(config, 0, 1))
+	if err := server.Init(&PSInitArgs{Size: 2}, new(bool)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetAll(&PSSetAllArgs{Entries: entries}, new(bool)); err != nil {
+		t.Fatal(err)
+	}
+	args := &PSEachArgs{Limit: 3}
+	got := 0
+	for {
+		reply := new(PSEachReply)
+		if err := server.Each(args, reply); err != nil {
+			t.Fatal(err)
+		}
+		if len(reply.Entries) > 3 || reply.Cursor != 0 && len(reply.Entries) != 3 {
+			t.Fatalf("page of %d entries, cursor %d", len(reply.Entries), reply.Cursor)
+		}
+		for _, e := range reply.Entries {
+			if e.Key != entries[got].Key {
+				t.Fatalf("entry %d is key %d, want %d", got, e.Key, entries[got].Key)
+			}
+			got++
+		}
+		if reply.Cursor == 0 {
+			break
+		}
+		args.Cursor = reply.Cursor
+	}
+	if got != want || len(entries) != want {
+		t.Errorf("paged %d of %d keys, each visited %d", got, len(entries), want)
+	}
+	if err := server.Each(&PSEachArgs{Cursor: 7, Limit: 3}, new(PSEachReply)); err == nil {
+		t.Error("each with an unknown cursor should fail")
+	}
+}
@@ -0,0 +1,31 @@
+package model
+
+import (
+	"linearmodel/base"
+)
+
+// groupByUser splits a batch into query/user groups, keeping the first-seen order of users.
+// Groups with a single label value carry no pairwise information and are dropped.
+func groupByUser(inslist []*base.Instance) [][]*base.Instance {
+	index := make(map[uint64]int)
+	groups := [][]*base.Instance{}
+	for _, ins := range inslist {
+		i, ok := index[ins.UserId]
+		if !ok {
+			i = len(groups)
+			index[ins.UserId] = i
+			groups = append(groups, []*base.Instance{})
+		}
+		groups[i] = append(groups[i], ins)
+	}
+	res := groups[:0]
+	for _, group := range groups {
+		for _, ins := range group[1:] {
+			if ins.Label != group[0].Label {
+				res = append(res, group)
+				break
+			}
+		}
+	}
+	return res
+}
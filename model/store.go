@@ -0,0 +1,424 @@
+package model
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+	"linearmodel/optim"
+)
+
+// paramStore keeps the parameters of a model by feature key, key 0 is the bias.
+type paramStore interface {
+	initSlots(features []*conf.FeatureConfig, norm func(size uint32) float32) uint32
+	initEmb(config *conf.AllConfig) error
+	sizeOf(slot uint16) (uint32, float32)
+
+	// getWeight copies the weight of key, creating the parameter first when needInit is set
+	getWeight(key uint64, slot uint16, text string, needInit bool) *base.Weight
+	// get returns the parameter of key, a copy for stores not made of base.Parameter
+	get(key uint64, slot uint16, needInit bool) *base.Parameter
+	set(key uint64, parameter *base.Parameter)
+	// each calls f on every parameter other than the bias, in key order inside a shard when seeded
+	each(f func(key uint64, p *base.Parameter))
+
+	update(key uint64, slot uint16, label float32, grad float32, opt optim.Optimizer)
+	updateEmb(key uint64, slot uint16, label float32, grad []float32, opt optim.Optimizer)
+	updateWeightAndEmb(key uint64, slot uint16, label float32, grad float32, gradVec []float32, opt optim.Optimizer)
+	applyGrad(key uint64, slot uint16, show, click int, grad float32, gradVec []float32, opt optim.Optimizer)
+}
+
+// newParamStore creates the store selected by param_store, opt is the optimizer that will update it.
+// name tells apart the stores of one model, the mmap store of a non empty name is mmap_path.name.
+func newParamStore(config *conf.AllConfig, name string, size uint32, norm float32, opt optim.Optimizer) (paramStore,
+	error) {
+	switch config.GetParamStore() {
+	case "", "map":
+		m := NewConcurrentMap(uint64(MODELCAP), size)
+		m.norm = norm
+		m.seed = config.Seed
+		return m, nil
+	case "arena":
+		return newArenaStore(newMemTable(uint64(MODELCAP)), size, norm, config.Seed, opt), nil
+	case "mmap":
+		path := config.GetMmapPath()
+		if path == "" {
+			return nil, fmt.Errorf("mmap param_store needs mmap_path")
+		}
+		if name != "" {
+			path += "." + name
+		}
+		// buckets fit the largest entry
+		maxEntry := entryFloats(size, &conf.FeatureConfig{}, opt)
+		for _, x := range config.FeatureList {
+			if n := entryFloats(size, x, opt); n > maxEntry {
+				maxEntry = n
+			}
+		}
+		table, err := openMmapTable(path, config.GetMmapCapacity(), maxEntry)
+		if err != nil {
+			return nil, err
+		}
+		return newArenaStore(table, size, norm, config.Seed, opt), nil
+	case "dense":
+		table, err := newDenseTable(config, func(x *conf.FeatureConfig) int {
+			return entryFloats(size, x, opt)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return newArenaStore(table, size, norm, config.Seed, opt), nil
+	case "ps":
+		return newPSStore(config, name, size, norm, opt)
+	}
+	return nil, fmt.Errorf("unknown param_store: %s", config.GetParamStore())
+}
+
+// entryFloats is the size of an arena entry of slot x in a store of embedding size, 0 for lr
+func entryFloats(size uint32, x *conf.FeatureConfig, opt optim.Optimizer) int {
+	if size > 0 && x.EmbSize != nil {
+		size = *x.EmbSize
+	}
+	state, vecState := 0, 0
+	if opt != nil {
+		state, vecState = opt.StateSize(int(size))
+	}
+	return headerSize + state + 3*int(size) + vecState
+}
+
+// failingStore is a store whose calls may fail, err returns the first error since its last call
+type failingStore interface {
+	err() error
+}
+
+// storeErr is the error of the failing stores among stores
+func storeErr(stores ...paramStore) error {
+	var errs []error
+	for _, s := range stores {
+		if f, ok := s.(failingStore); ok {
+			errs = append(errs, f.err())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setStore is a store that sets many keys in one call, loadStore sets keys loadBatch at a time
+type setStore interface {
+	setAll(entries []PSEntry)
+}
+
+const loadBatch = 4096
+
+// flusher is a store backed by files, flush writes them to disk
+type flusher interface {
+	flush() error
+}
+
+// closer is a store holding files or mappings, close flushes and releases them
+type closer interface {
+	close() error
+}
+
+// closeStores closes the stores among stores that hold files
+func closeStores(stores ...paramStore) error {
+	var errs []error
+	for _, s := range stores {
+		if c, ok := s.(closer); ok {
+			errs = append(errs, c.close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// slotTable is the embedding size and init of every slot, shared by the stores
+type slotTable struct {
+	size uint32
+	norm float32
+	seed uint64   // non zero seed: embeddings are initialized by key hash and saved in key order
+	emb  *embInit // init scheme of new embeddings, nil for the legacy uniform init
+
+	// slots with their own embedding size, read only after initSlots
+	slots map[uint16]slotInfo
+}
+
+type slotInfo struct {
+	size uint32
+	norm float32
+}
+
+// initSlots applies per slot emb_size of the feature list, norm gives the init norm of a size.
+// It returns the max embedding size over all slots.
+func (b *slotTable) initSlots(features []*conf.FeatureConfig, norm func(size uint32) float32) uint32 {
+	b.slots = make(map[uint16]slotInfo)
+	maxSize := b.size
+	for _, x := range features {
+		if x.EmbSize == nil {
+			continue
+		}
+		size := *x.EmbSize
+		b.slots[uint16(x.SlotId)] = slotInfo{size: size, norm: norm(size)}
+		if size > maxSize {
+			maxSize = size
+		}
+	}
+	return maxSize
+}
+
+// setSlots replaces the slots with their own embedding size, a parameter server takes those of the worker
+func (b *slotTable) setSlots(slots map[uint16]slotInfo) {
+	b.slots = slots
+}
+
+func (b *slotTable) sizeOf(slot uint16) (uint32, float32) {
+	if info, ok := b.slots[slot]; ok {
+		return info.size, info.norm
+	}
+	return b.size, b.norm
+}
+
+// initEmb sets up the init scheme of new embeddings, it must run after initSlots
+func (b *slotTable) initEmb(config *conf.AllConfig) error {
+	emb, err := newEmbInit(config, b.sizeOf)
+	if err != nil {
+		return err
+	}
+	b.emb = emb
+	return nil
+}
+
+// newVec is the initial embedding of a new key
+func (b *slotTable) newVec(key uint64, slot uint16) []float32 {
+	size, norm := b.sizeOf(slot)
+	if b.emb != nil {
+		return b.emb.vec(key, size, norm)
+	}
+	if b.seed != 0 {
+		return base.HashVec32(key, b.seed, size, norm)
+	}
+	return base.RandVec32(size, norm)
+}
+
+// saveStore writes the meta line, the bias and then one line per key. A key line is
+// "text slot key w vec" followed by the state a later run needs to resume training: "show click z n state
+// vecz vecn vecstate". The bias line is "0 w step z n state" with the step of schedule.
+func saveStore(s paramStore, p string, info string, schedule *optim.Schedule) error {
+	f, err := os.Create(p)
+	defer f.Close()
+	wr := bufio.NewWriter(f)
+	if err != nil {
+		glog.Errorf("creat path: %s fail", p)
+		return err
+	}
+	wr.WriteString(info + "\n")
+	bias := s.get(0, 0, false)
+	wr.WriteString(fmt.Sprintf("0\t%s\t%d\t%s\t%s\t%s\n", stateToString(bias.W), schedule.Step(), stateToString(bias.Z),
+		stateToString(bias.N), stateVecToString(bias.State)))
+	wr.Flush()
+	s.each(func(k uint64, v *base.Parameter) {
+		wr.WriteString(fmt.Sprintf("%s\t%d\t%d\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", v.Text, v.Slot, k,
+			stateToString(v.W), stateVecToString(v.VecW), v.Show, v.Click, stateToString(v.Z), stateToString(v.N),
+			stateVecToString(v.State), stateVecToString(v.VecZ), stateVecToString(v.VecN),
+			stateVecToString(v.VecState)))
+	})
+	if err := wr.Flush(); err != nil {
+		return err
+	}
+	if err := storeErr(s); err != nil {
+		return err
+	}
+	if fl, ok := s.(flusher); ok {
+		return fl.flush()
+	}
+	return nil
+}
+
+// stateToString keeps every bit of a float32, so training resumes from the same parameters
+func stateToString(x float32) string {
+	return strconv.FormatFloat(float64(x), 'g', -1, 32)
+}
+
+func stateVecToString(vec []float32) string {
+	row := make([]string, len(vec))
+	for i, x := range vec {
+		row[i] = stateToString(x)
+	}
+	return strings.Join(row, ",")
+}
+
+// stringToState parses a comma separated state of any size, "" is no state
+func stringToState(line string) ([]float32, error) {
+	if line == "" {
+		return nil, nil
+	}
+	return base.StringToVec(line, strings.Count(line, ",")+1)
+}
+
+// parseState parses the optimizer columns of a line: z, n and state of the weight when vec is false, z, n and
+// state of the embedding otherwise
+func parseState(p *base.Parameter, row []string, vec bool) error {
+	if !vec {
+		z, err := strconv.ParseFloat(row[0], 32)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseFloat(row[1], 32)
+		if err != nil {
+			return err
+		}
+		state, err := stringToState(row[2])
+		if err != nil {
+			return err
+		}
+		p.Z, p.N, p.State = float32(z), float32(n), state
+		return nil
+	}
+	vecZ, err := stringToState(row[0])
+	if err != nil {
+		return err
+	}
+	vecN, err := stringToState(row[1])
+	if err != nil {
+		return err
+	}
+	vecState, err := stringToState(row[2])
+	if err != nil {
+		return err
+	}
+	if len(vecZ) != len(p.VecW) || len(vecN) != len(p.VecW) {
+		return fmt.Errorf("embedding state size %d, %d differs from emb_size %d", len(vecZ), len(vecN), len(p.VecW))
+	}
+	p.VecZ, p.VecN, p.VecState = vecZ, vecN, vecState
+	return nil
+}
+
+// loadStore reads a file written by saveStore, embedding sizes follow the slots of s. The optimizer state and
+// the step of schedule are restored when the file has them; files of older versions, and files written by
+// modeltool, have weights only and training resumes from a zero state.
+func loadStore(s paramStore, p string, schedule *optim.Schedule) error {
+	f, err := os.Open(p)
+	defer f.Close()
+	if err != nil {
+		glog.Errorf("load path error: %s", err)
+		return err
+	}
+	r := bufio.NewReader(f)
+	// skip first line
+	_, err = r.ReadString('\n')
+	if err != nil {
+		glog.Error("read meta info error")
+	}
+	biasLine, err := r.ReadString('\n')
+	if err != nil {
+		glog.Error("read bias info error")
+	}
+	line := strings.TrimSuffix(biasLine, "\n")
+	row := strings.Split(line, "\t")
+	if len(row) != 2 && len(row) != 6 {
+		return fmt.Errorf("bias term parse error")
+	}
+	k, err := strconv.ParseUint(row[0], 10, 64)
+	if err != nil {
+		glog.Errorf("parse k error")
+		return err
+	}
+	biasW, err := strconv.ParseFloat(row[1], 64)
+	if err != nil {
+		return err
+	}
+	pm := new(base.Parameter)
+	pm.W = float32(biasW)
+	if len(row) == 6 {
+		step, err := strconv.ParseInt(row[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bias term parse error: %v", err)
+		}
+		if err := parseState(pm, row[3:], false); err != nil {
+			return fmt.Errorf("bias term parse error: %v", err)
+		}
+		schedule.SetStep(step)
+	}
+	s.set(k, pm)
+
+	setter, batched := s.(setStore)
+	var batch []PSEntry
+	setBatch := func() error {
+		setter.setAll(batch)
+		batch = batch[:0]
+		return storeErr(s)
+	}
+	count := 0
+	for {
+		bt, err := r.ReadString('\n')
+		// fmt.Println(string(bt), err)
+		count++
+		if err != nil {
+			break
+		}
+		line := strings.TrimSuffix(bt, "\n")
+		row := strings.Split(line, "\t")
+		if len(row) != 5 && len(row) != 13 {
+			glog.Errorf("wrong line[%d]: %s in file %s", count, line, p)
+			continue
+		}
+		text := base.DeepCopyString(row[0])
+		slot, err := strconv.ParseUint(row[1], 10, 64)
+		if err != nil {
+			glog.Errorf("wrong key[%d]: %s in file %s, err=%s", count, row[1], p, err)
+			continue
+		}
+		key, err := strconv.ParseUint(row[2], 10, 64)
+		if err != nil {
+			glog.Errorf("wrong key[%d]: %s in file %s, err=%s", count, row[2], p, err)
+			continue
+		}
+		val, err := strconv.ParseFloat(row[3], 10)
+		if err != nil {
+			glog.Errorf("wrong key[%d]: %s in file %s, err=%s", count, row[3], p, err)
+			continue
+		}
+		vecSize, _ := s.sizeOf(uint16(slot))
+		vec, err := base.StringToVec(row[4], int(vecSize))
+		if err != nil {
+			glog.Errorf("wrong vec[%d]: %s in file %s, err=%s", count, row[4], p, err)
+			continue
+		}
+		pm := base.NewParameterWithVec(vec)
+		pm.Slot = uint16(slot)
+		pm.Fea = key
+		pm.Text = text
+		pm.W = float32(val)
+		if len(row) == 13 {
+			show, err1 := strconv.Atoi(row[5])
+			click, err2 := strconv.Atoi(row[6])
+			if err := errors.Join(err1, err2, parseState(pm, row[7:10], false),
+				parseState(pm, row[10:13], true)); err != nil {
+				glog.Errorf("wrong state[%d] in file %s, err=%s", count, p, err)
+				continue
+			}
+			pm.Show, pm.Click = show, click
+		}
+		if !batched {
+			s.set(key, pm)
+			continue
+		}
+		// a failed batch stops the load
+		if batch = append(batch, PSEntry{Key: key, P: *pm}); len(batch) == loadBatch {
+			if err := setBatch(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := setBatch(); err != nil {
+			return err
+		}
+	}
+	return storeErr(s)
+}
@@ -0,0 +1,430 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// eqState compares counters and optimizer state, a state never touched is the same as a zero state
+func eqState(p1, p2 *base.Parameter) bool {
+	zeroPad := func(s []float32, n int) []float32 {
+		if s == nil {
+			return make([]float32, n)
+		}
+		return s
+	}
+	return p1.Show == p2.Show && p1.Click == p2.Click &&
+		!base.NEQSliceFloat32(zeroPad(p1.State, len(p2.State)), p2.State) &&
+		!base.NEQSliceFloat32(zeroPad(p1.VecState, len(p2.VecState)), p2.VecState)
+}
+
+func TestArenaStore_SameAsMap(t *testing.T) {
+	insList := _gen_bench_instance(300, 8, 50)
+	size := uint32(3)
+	for _, optimizer := range []string{"ftrl", "adam", "adagrad", "sgd"} {
+		for _, name := range []string{"lr", "fm", "fm_batch"} {
+			var models [3]IModel
+			var stores [3]paramStore
+			for i, store := range []string{"map", "arena", "mmap"} {
+				config := _gen_fm_config()
+				config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: 102},
+					&conf.FeatureConfig{SlotId: 104, EmbSize: &size})
+				config.OptimConfig.Optimizer = optimizer
+				config.OptimConfig.SgdDecay = 0.1
+				if optimizer == "sgd" {
+					config.OptimConfig.Beta, config.OptimConfig.EmbBeta = 0, 0
+				}
+				config.ParamStore = store
+				config.MmapPath = filepath.Join(t.TempDir(), "model.mmap")
+				config.MmapCapacity = 1000
+				config.Seed = 1
+				config.MiniBatch = name == "fm_batch"
+				if name == "lr" {
+					lr := &LRModel{}
+					lr.Init(config)
+					models[i], stores[i] = lr, lr.model
+				} else {
+					fm := &FMModel{}
+					fm.Init(config)
+					models[i], stores[i] = fm, fm.model
+				}
+				for j := 0; j < 3; j++ {
+					models[i].Train(insList)
+				}
+			}
+			for _, other := range stores[1:] {
+				count := 0
+				stores[0].each(func(k uint64, v *base.Parameter) {
+					count++
+					p := other.get(k, v.Slot, false)
+					if p == nil || !base.EQParameter(v, p, false) || !eqState(v, p) {
+						t.Errorf("%s %s: %T differs at key %d: %v %v", optimizer, name, other, k, v, p)
+					}
+				})
+				other.each(func(k uint64, v *base.Parameter) {
+					count--
+				})
+				if count != 0 {
+					t.Errorf("%s %s: key count differs by %d", optimizer, name, count)
+				}
+				if !base.EQParameter(stores[0].get(0, 0, false), other.get(0, 0, false), true) {
+					t.Errorf("%s %s: bias differs", optimizer, name)
+				}
+			}
+		}
+	}
+}
+
+func TestArenaStore_SaveLoad(t *testing.T) {
+	config := _gen_fm_config()
+	config.ParamStore = "arena"
+	fm := &FMModel{}
+	fm.Init(config)
+	fm.Train(_gen_fm_instance())
+	fm.model.getWeight(7, 101, "text_7", true)
+	path := filepath.Join(t.TempDir(), "model")
+	if err := fm.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []string{"map", "arena"} {
+		config.ParamStore = store
+		loaded := &FMModel{}
+		loaded.Init(config)
+		if err := loaded.Load(path); err != nil {
+			t.Fatal(err)
+		}
+		if base.NEQFloat32(fm.model.get(0, 0, false).W, loaded.model.get(0, 0, false).W) {
+			t.Error("save or load bias error")
+		}
+		fm.model.each(func(k uint64, v *base.Parameter) {
+			p := loaded.model.get(k, v.Slot, false)
+			if p == nil || base.NEQFloat32(v.W, p.W) || base.NEQSliceFloat32(v.VecW, p.VecW) || v.Text != p.Text {
+				t.Errorf("%s: load error at key %d: %v %v", store, k, v, p)
+			}
+		})
+	}
+}
+
+func TestStore_ResumeFromSave(t *testing.T) {
+	insList := _gen_bench_instance(300, 8, 50)
+	for _, optimizer := range []string{"ftrl", "adam"} {
+		for _, store := range []string{"map", "arena"} {
+			config := _gen_fm_config()
+			config.OptimConfig.Optimizer = optimizer
+			config.OptimConfig.LrSchedule = "inverse_sqrt"
+			config.OptimConfig.WarmupSteps = 100
+			config.ParamStore = store
+			config.Seed = 1
+			whole, half, resumed := &FMModel{}, &FMModel{}, &FMModel{}
+			for _, fm := range []*FMModel{whole, half, resumed} {
+				fm.Init(config)
+			}
+			whole.Train(insList)
+			whole.Train(insList)
+			half.Train(insList)
+			path := filepath.Join(t.TempDir(), "model")
+			if err := half.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			if err := resumed.Load(path); err != nil {
+				t.Fatal(err)
+			}
+			if resumed.schedule.Step() != half.schedule.Step() {
+				t.Errorf("%s %s: step %d, want %d", optimizer, store, resumed.schedule.Step(), half.schedule.Step())
+			}
+			resumed.Train(insList)
+			count := 0
+			whole.model.each(func(k uint64, v *base.Parameter) {
+				count++
+				p := resumed.model.get(k, v.Slot, false)
+				if p == nil || !base.EQParameter(v, p, false) || !eqState(v, p) {
+					t.Errorf("%s %s: resumed model differs at key %d: %v %v", optimizer, store, k, v, p)
+				}
+			})
+			if count == 0 {
+				t.Errorf("%s %s: no key trained", optimizer, store)
+			}
+			if !base.EQParameter(whole.model.get(0, 0, false), resumed.model.get(0, 0, false), true) {
+				t.Errorf("%s %s: resumed bias differs", optimizer, store)
+			}
+		}
+	}
+}
+
+func TestLoadStore_SkipWrongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model")
+	lines := "meta\n0\t0.5\n" +
+		"a\t101\t1\t0.1\t0.1,0.2\n" +
+		"b\t101\t2\n" +
+		"c\t101\t3\t0.3\tx,y\n" +
+		"d\t101\t4\t0.4\t0.3,0.4\n"
+	if err := os.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fm := &FMModel{}
+	fm.Init(_gen_fm_config())
+	if err := loadStore(fm.model, path, nil); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	fm.model.each(func(k uint64, v *base.Parameter) {
+		count++
+	})
+	if count != 2 || fm.model.get(1, 101, false) == nil || fm.model.get(4, 101, false) == nil {
+		t.Errorf("want keys 1 and 4 only, got %d keys", count)
+	}
+}
+
+func TestMmapStore_Reopen(t *testing.T) {
+	config := _gen_fm_config()
+	config.OptimConfig.Optimizer = "adam"
+	config.ParamStore = "mmap"
+	config.MmapPath = filepath.Join(t.TempDir(), "model.mmap")
+	config.MmapCapacity = 100
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	fm.Train(_gen_fm_instance())
+	fm.model.getWeight(7, 101, "text_7", true)
+	if err := fm.Save(filepath.Join(t.TempDir(), "model")); err != nil {
+		t.Fatal(err)
+	}
+	// a new model on the same file starts from the trained parameters without Load
+	reopened := &FMModel{}
+	if err := reopened.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	if !base.EQParameter(fm.model.get(0, 0, false), reopened.model.get(0, 0, false), false) {
+		t.Error("reopen bias error")
+	}
+	count := 0
+	fm.model.each(func(k uint64, v *base.Parameter) {
+		count++
+		p := reopened.model.get(k, v.Slot, false)
+		if p == nil || !base.EQParameter(v, p, false) || !eqState(v, p) {
+			t.Errorf("reopen error at key %d: %v %v", k, v, p)
+		}
+	})
+	reopened.model.each(func(k uint64, v *base.Parameter) {
+		count--
+	})
+	if count != 0 {
+		t.Errorf("reopened key count differs by %d", count)
+	}
+	if p := reopened.model.get(7, 101, false); p == nil || p.Text != "text_7" {
+		t.Error("reopen text error")
+	}
+	res, _ := fm.Predict(_gen_fm_instance())
+	res2, _ := reopened.Predict(_gen_fm_instance())
+	if base.NEQFloat32(res[0].Score, res2[0].Score) || base.NEQFloat32(res[1].Score, res2[1].Score) {
+		t.Error("reopened model predicts differently")
+	}
+
+	// close flushes what was trained since the save, and a closed file opens again
+	reopened.Train(_gen_fm_instance())
+	want := reopened.model.get(7, 101, false)
+	if err := fm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Errorf("a second close should do nothing: %v", err)
+	}
+	if table := reopened.model.(*arenaStore).table.(*mmapTable); table.data != nil {
+		t.Error("close should unmap the file")
+	}
+	third := &FMModel{}
+	if err := third.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	if p := third.model.get(7, 101, false); p == nil || !base.EQParameter(want, p, false) || p.Text != "text_7" {
+		t.Errorf("reopened after close: %v, want %v", p, want)
+	}
+
+	config.OptimConfig.EmbSize = 4
+	if err := (&FMModel{}).Init(config); err == nil {
+		t.Error("opening a file of another layout should fail")
+	}
+}
+
+func TestMmapStore_Full(t *testing.T) {
+	config := _gen_fm_config()
+	config.ParamStore = "mmap"
+	config.MmapPath = filepath.Join(t.TempDir(), "model.mmap")
+	config.MmapCapacity = 100
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	// 64 regions of 16 buckets take 14 keys each
+	var inslist []*base.Instance
+	for i := 1; i <= 2000; i++ {
+		inslist = append(inslist, &base.Instance{Feas: []*base.Feature{{Fea: uint64(i), Slot: 101}}, Label: 1})
+	}
+	if err := fm.Train(inslist); err == nil || !strings.Contains(err.Error(), "mmap_capacity 100") {
+		t.Errorf("a full mmap store should fail training, got %v", err)
+	}
+	if err := fm.Train(_gen_fm_instance()); err != nil {
+		t.Errorf("keys that fit should train after a failure: %v", err)
+	}
+}
+
+func TestDenseStore_SameAsMap(t *testing.T) {
+	insList := _gen_bench_instance(300, 8, 50)
+	size := uint32(3)
+	buckets := uint64(8)
+	for _, ins := range insList {
+		for _, fea := range ins.Feas {
+			// slot 104 has its own bucket count
+			if fea.Slot == 104 {
+				fea.Bucket(buckets)
+			} else {
+				fea.Bucket(16)
+			}
+		}
+	}
+	var stores [2]paramStore
+	for i, store := range []string{"map", "dense"} {
+		config := _gen_fm_config()
+		config.FeatureList = append(config.FeatureList, &conf.FeatureConfig{SlotId: 102},
+			&conf.FeatureConfig{SlotId: 104, EmbSize: &size, HashBuckets: &buckets})
+		config.HashBuckets = 16
+		config.OptimConfig.Optimizer = "adam"
+		config.ParamStore = store
+		config.Seed = 1
+		fm := &FMModel{}
+		if err := fm.Init(config); err != nil {
+			t.Fatal(err)
+		}
+		fm.Train(insList)
+		stores[i] = fm.model
+	}
+	count := 0
+	stores[0].each(func(k uint64, v *base.Parameter) {
+		count++
+		if slot := k / base.KMAXSIGN; k%base.KMAXSIGN >= 16 || slot == 104 && k%base.KMAXSIGN >= 8 {
+			t.Errorf("key %d out of the buckets of slot %d", k, slot)
+		}
+		p := stores[1].get(k, v.Slot, false)
+		if p == nil || !base.EQParameter(v, p, false) || !eqState(v, p) {
+			t.Errorf("dense store differs at key %d: %v %v", k, v, p)
+		}
+	})
+	stores[1].each(func(k uint64, v *base.Parameter) {
+		count--
+	})
+	if count != 0 {
+		t.Errorf("key count differs by %d", count)
+	}
+	// 5 slots of 16 and one of 8 buckets: adam state is 3 floats, vectors 3 * emb_size and 2 * emb_size + 1
+	table := stores[1].(*arenaStore).table.(*denseTable)
+	if want := 5*16*(headerSize+3+5*2+1) + 8*(headerSize+3+5*3+1); len(table.data) != want {
+		t.Errorf("dense store has %d floats, want %d", len(table.data), want)
+	}
+
+	// a key that was not bucketed fails the batch, not the process
+	config := _gen_fm_config()
+	config.HashBuckets = 16
+	config.ParamStore = "dense"
+	fm := &FMModel{}
+	if err := fm.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	raw := []*base.Instance{{Feas: []*base.Feature{{Fea: 12345, Slot: 101}}, Label: 1}}
+	if err := fm.Train(raw); err == nil || !strings.Contains(err.Error(), "not in a hashed slot") {
+		t.Errorf("a key outside the buckets should fail training, got %v", err)
+	}
+	fea := &base.Feature{Fea: 12345, Slot: 101}
+	fea.Bucket(16)
+	if err := fm.Train([]*base.Instance{{Feas: []*base.Feature{fea}, Label: 1}}); err != nil {
+		t.Errorf("bucketed keys should train after a failure: %v", err)
+	}
+
+	config = _gen_fm_config()
+	config.HashBuckets = 16
+	config.FeatureList[0].HashBuckets = new(uint64)
+	config.ParamStore = "dense"
+	if err := (&FMModel{}).Init(config); err == nil {
+		t.Error("dense store of an unbounded slot should fail")
+	}
+}
+
+func TestArenaStore_ConcurrentInsert(t *testing.T) {
+	config := _gen_fm_config()
+	s := newArenaStore(newMemTable(16), 4, 2, 0, nil)
+	s.initSlots(config.FeatureList, sqrtNorm)
+	n, workers := 20000, 8
+	group := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		group.Add(1)
+		go func(w int) {
+			defer group.Done()
+			// every worker inserts all keys, in a different order
+			for i := 0; i < n; i++ {
+				key := uint64((i*7+w*n/workers)%n + 1)
+				s.getWeight(key, uint16(101+key%4), fmt.Sprint(key), true)
+			}
+		}(w)
+	}
+	group.Wait()
+	count := 0
+	s.each(func(k uint64, v *base.Parameter) {
+		count++
+		if v.Slot != uint16(101+k%4) || v.Text != fmt.Sprint(k) || len(v.VecW) != 4 {
+			t.Errorf("wrong entry %d: %v", k, v)
+		}
+	})
+	if count != n {
+		t.Errorf("want %d keys, got %d", n, count)
+	}
+}
+
+func benchmarkStore(b *testing.B, store string, embSize uint32) {
+	config := _gen_fm_config()
+	config.OptimConfig.EmbSize = embSize
+	config.ParamStore = store
+	fm := &FMModel{}
+	fm.Init(config)
+	vocab := 50000
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	// the keys of _gen_bench_instance
+	for slot := uint64(101); slot <= 104; slot++ {
+		for i := 1; i <= vocab+1; i++ {
+			fm.model.getWeight(slot*1e6+uint64(i), uint16(slot), "", true)
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	start := time.Now()
+	runtime.GC()
+	gc := time.Since(start)
+	benchmarkTrain(b, fm, _gen_bench_instance(10000, 40, vocab))
+	// after the run, ResetTimer drops metrics reported before it
+	keys := float64(4 * (vocab + 1))
+	b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/keys, "heap-bytes/key")
+	b.ReportMetric(float64(after.HeapObjects-before.HeapObjects)/keys, "objects/key")
+	b.ReportMetric(float64(gc.Microseconds()), "gc-us")
+}
+
+func BenchmarkStore_Map(b *testing.B) {
+	benchmarkStore(b, "map", 8)
+}
+
+func BenchmarkStore_Arena(b *testing.B) {
+	benchmarkStore(b, "arena", 8)
+}
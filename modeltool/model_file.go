@@ -0,0 +1,218 @@
+package modeltool
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"linearmodel/base"
+)
+
+// Entry is one key of a saved model
+type Entry struct {
+	Text string
+	Slot uint16
+	Key  uint64
+	W    float32
+	Vec  []float32
+}
+
+// ModelFile is a model written by Save: the meta line, the bias and one entry per key in file order.
+// The optimizer state of the file is not kept, a model written by Write resumes training from a zero state.
+type ModelFile struct {
+	Meta    string
+	Bias    float32
+	Entries []*Entry
+}
+
+// Read loads a saved model file
+func Read(path string) (*ModelFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := &ModelFile{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	count := 0
+	for scanner.Scan() {
+		count++
+		line := scanner.Text()
+		switch count {
+		case 1:
+			m.Meta = line
+			continue
+		case 2:
+			row := strings.Split(line, "\t")
+			if (len(row) != 2 && len(row) != 6) || row[0] != "0" {
+				return nil, fmt.Errorf("wrong bias line in %s: %s", path, line)
+			}
+			bias, err := strconv.ParseFloat(row[1], 32)
+			if err != nil {
+				return nil, fmt.Errorf("wrong bias in %s: %v", path, err)
+			}
+			m.Bias = float32(bias)
+			continue
+		}
+		e, err := parseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("wrong line[%d] in %s: %v", count, path, err)
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if count < 2 {
+		return nil, fmt.Errorf("%s is not a model file: meta or bias line missing", path)
+	}
+	return m, nil
+}
+
+func parseEntry(line string) (*Entry, error) {
+	row := strings.Split(line, "\t")
+	if len(row) != 5 && len(row) != 13 {
+		return nil, fmt.Errorf("want 5 or 13 columns, got %d", len(row))
+	}
+	slot, err := strconv.ParseUint(row[1], 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	key, err := strconv.ParseUint(row[2], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	w, err := strconv.ParseFloat(row[3], 32)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	if row[4] != "" {
+		size = strings.Count(row[4], ",") + 1
+	}
+	vec, err := base.StringToVec(row[4], size)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{Text: row[0], Slot: uint16(slot), Key: key, W: float32(w), Vec: vec}, nil
+}
+
+// Write saves m in the format of Save, so the trainer can load it
+func (m *ModelFile) Write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	wr := bufio.NewWriter(f)
+	wr.WriteString(m.Meta + "\n")
+	wr.WriteString(fmt.Sprintf("0\t%.8f\n", m.Bias))
+	for _, e := range m.Entries {
+		wr.WriteString(fmt.Sprintf("%s\t%d\t%d\t%.7f\t%s\n", e.Text, e.Slot, e.Key, e.W, base.VecToString(e.Vec)))
+	}
+	return wr.Flush()
+}
+
+// index maps keys to entries
+func (m *ModelFile) index() map[uint64]*Entry {
+	idx := make(map[uint64]*Entry, len(m.Entries))
+	for _, e := range m.Entries {
+		idx[e.Key] = e
+	}
+	return idx
+}
+
+// Filter keeps the entries of slots when drop is false, and removes them when it is set
+func (m *ModelFile) Filter(slots map[uint16]bool, drop bool) *ModelFile {
+	out := &ModelFile{Meta: m.Meta, Bias: m.Bias}
+	for _, e := range m.Entries {
+		if slots[e.Slot] != drop {
+			out.Entries = append(out.Entries, e)
+		}
+	}
+	return out
+}
+
+// Merge combines models key by key. In "avg" mode the weights and embeddings of a key are the
+// weighted average over the models that have it, in "latest" mode the last model with the key
+// wins. weights is one per model, nil weighs them equally. The meta line is the first model's.
+func Merge(models []*ModelFile, weights []float64, mode string) (*ModelFile, error) {
+	if len(models) == 0 {
+		return nil, fmt.Errorf("no model to merge")
+	}
+	if weights == nil {
+		weights = make([]float64, len(models))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	if len(weights) != len(models) {
+		return nil, fmt.Errorf("%d weights for %d models", len(weights), len(models))
+	}
+	if mode != "avg" && mode != "latest" {
+		return nil, fmt.Errorf("unknown merge mode: %s", mode)
+	}
+	out := &ModelFile{Meta: models[0].Meta}
+	type acc struct {
+		entry  *Entry
+		w      float64
+		vec    []float64
+		weight float64
+	}
+	merged := make(map[uint64]*acc)
+	var order []uint64
+	var bias, biasWeight float64
+	for i, m := range models {
+		if m.Meta != out.Meta {
+			return nil, fmt.Errorf("model %d has another meta line: %q, want %q", i, m.Meta, out.Meta)
+		}
+		if mode == "latest" {
+			bias, biasWeight = float64(m.Bias), 1
+		} else {
+			bias += weights[i] * float64(m.Bias)
+			biasWeight += weights[i]
+		}
+		for _, e := range m.Entries {
+			a, ok := merged[e.Key]
+			if !ok {
+				a = &acc{entry: e, vec: make([]float64, len(e.Vec))}
+				merged[e.Key] = a
+				order = append(order, e.Key)
+			}
+			if len(e.Vec) != len(a.vec) {
+				return nil, fmt.Errorf("key %d of slot %d has embedding size %d in model %d, want %d", e.Key, e.Slot,
+					len(e.Vec), i, len(a.vec))
+			}
+			if mode == "latest" {
+				a.entry, a.w, a.weight = e, float64(e.W), 1
+				for j, v := range e.Vec {
+					a.vec[j] = float64(v)
+				}
+				continue
+			}
+			a.w += weights[i] * float64(e.W)
+			a.weight += weights[i]
+			for j, v := range e.Vec {
+				a.vec[j] += weights[i] * float64(v)
+			}
+		}
+	}
+	if biasWeight != 0 {
+		out.Bias = float32(bias / biasWeight)
+	}
+	for _, key := range order {
+		a := merged[key]
+		e := &Entry{Text: a.entry.Text, Slot: a.entry.Slot, Key: key, Vec: make([]float32, len(a.vec))}
+		if a.weight != 0 {
+			e.W = float32(a.w / a.weight)
+			for j, v := range a.vec {
+				e.Vec[j] = float32(v / a.weight)
+			}
+		}
+		out.Entries = append(out.Entries, e)
+	}
+	return out, nil
+}
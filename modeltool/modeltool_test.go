@@ -0,0 +1,109 @@
+package modeltool
+
+import (
+	"path/filepath"
+	"testing"
+
+	"linearmodel/base"
+)
+
+func _gen_model(bias float32, entries ...*Entry) *ModelFile {
+	return &ModelFile{Meta: "2\t0\t101:0\t102:0", Bias: bias, Entries: entries}
+}
+
+func TestModelFile_ReadWrite(t *testing.T) {
+	m := _gen_model(0.5, &Entry{Text: "a", Slot: 101, Key: 1, W: 0.25, Vec: []float32{1, -1}},
+		&Entry{Text: "b", Slot: 102, Key: 2, W: 0, Vec: []float32{0, 0}})
+	path := filepath.Join(t.TempDir(), "model")
+	if err := m.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Meta != m.Meta || read.Bias != m.Bias || len(read.Entries) != 2 {
+		t.Fatalf("read %v", read)
+	}
+	for i, e := range read.Entries {
+		want := m.Entries[i]
+		if e.Text != want.Text || e.Slot != want.Slot || e.Key != want.Key || e.W != want.W ||
+			base.NEQSliceFloat32(e.Vec, want.Vec) {
+			t.Errorf("entry %d: %v, want %v", i, e, want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	m1 := _gen_model(1, &Entry{Slot: 101, Key: 1, W: 1, Vec: []float32{1, 0}},
+		&Entry{Slot: 101, Key: 2, W: 2, Vec: []float32{2, 2}})
+	m2 := _gen_model(3, &Entry{Slot: 101, Key: 1, W: 3, Vec: []float32{0, 1}},
+		&Entry{Slot: 102, Key: 3, W: 4, Vec: []float32{4, 4}})
+	avg, err := Merge([]*ModelFile{m1, m2}, []float64{3, 1}, "avg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.NEQFloat32(avg.Bias, 1.5) || len(avg.Entries) != 3 {
+		t.Fatalf("avg merge %v", avg)
+	}
+	// key 1 is in both models, keys 2 and 3 keep their only value
+	want := map[uint64]*Entry{1: {W: 1.5, Vec: []float32{0.75, 0.25}}, 2: {W: 2, Vec: []float32{2, 2}},
+		3: {W: 4, Vec: []float32{4, 4}}}
+	for _, e := range avg.Entries {
+		if base.NEQFloat32(e.W, want[e.Key].W) || base.NEQSliceFloat32(e.Vec, want[e.Key].Vec) {
+			t.Errorf("avg key %d: %v, want %v", e.Key, e, want[e.Key])
+		}
+	}
+
+	latest, err := Merge([]*ModelFile{m1, m2}, nil, "latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Bias != 3 || latest.Entries[0].W != 3 || latest.Entries[1].W != 2 {
+		t.Errorf("latest merge %v", latest)
+	}
+
+	m2.Entries[0].Vec = []float32{1}
+	if _, err := Merge([]*ModelFile{m1, m2}, nil, "avg"); err == nil {
+		t.Error("merge of another embedding size should fail")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	m := _gen_model(1, &Entry{Slot: 101, Key: 1}, &Entry{Slot: 102, Key: 2}, &Entry{Slot: 103, Key: 3})
+	slots := map[uint16]bool{101: true, 103: true}
+	if kept := m.Filter(slots, false); len(kept.Entries) != 2 || kept.Entries[1].Key != 3 || kept.Bias != 1 {
+		t.Errorf("keep %v", kept.Entries)
+	}
+	if dropped := m.Filter(slots, true); len(dropped.Entries) != 1 || dropped.Entries[0].Key != 2 {
+		t.Errorf("drop %v", dropped.Entries)
+	}
+}
+
+func TestDiffAndStats(t *testing.T) {
+	before := _gen_model(0, &Entry{Slot: 101, Key: 1, W: 1, Vec: []float32{0, 0}},
+		&Entry{Slot: 101, Key: 2, W: 0, Vec: []float32{1, 0}})
+	after := _gen_model(0, &Entry{Slot: 101, Key: 1, W: 1.5, Vec: []float32{3, 4}},
+		&Entry{Slot: 102, Key: 3, W: 0.01, Vec: []float32{0, 0}})
+	diffs := Diff(before, after)
+	if len(diffs) != 2 {
+		t.Fatalf("diff %v", diffs)
+	}
+	d := diffs[0]
+	if d.Slot != 101 || d.Added != 0 || d.Removed != 1 || d.Common != 1 || d.WDrift.Max != 0.5 ||
+		d.VecDrift.P50 != 5 {
+		t.Errorf("diff of slot 101 %+v", d)
+	}
+	if diffs[1].Slot != 102 || diffs[1].Added != 1 {
+		t.Errorf("diff of slot 102 %+v", diffs[1])
+	}
+
+	stats := Stats(before)
+	if len(stats) != 1 || stats[0].Keys != 2 || stats[0].Sparsity() != 0.5 || stats[0].ZeroVec != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	// |w| 0 and 1, |vec| 0 and 1
+	if stats[0].WHist[0] != 1 || stats[0].WHist[5] != 1 || stats[0].VecHist[0] != 1 || stats[0].VecHist[5] != 1 {
+		t.Errorf("histograms %v %v", stats[0].WHist, stats[0].VecHist)
+	}
+}
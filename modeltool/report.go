@@ -0,0 +1,173 @@
+package modeltool
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"linearmodel/base"
+)
+
+// SlotDiff compares the keys of one slot in two models
+type SlotDiff struct {
+	Slot    uint16
+	Added   int // keys only in the after model
+	Removed int // keys only in the before model
+	Common  int
+	// quantiles of |w after - w before| and of the l2 distance of embeddings over common keys
+	WDrift   Quantiles
+	VecDrift Quantiles
+}
+
+// Quantiles summarizes a distribution
+type Quantiles struct {
+	P50, P90, P99, Max float64
+}
+
+func quantiles(x []float64) Quantiles {
+	if len(x) == 0 {
+		return Quantiles{}
+	}
+	sort.Float64s(x)
+	at := func(q float64) float64 {
+		return x[int(q*float64(len(x)-1))]
+	}
+	return Quantiles{P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: x[len(x)-1]}
+}
+
+// Diff compares the before and after model slot by slot, in slot order
+func Diff(before, after *ModelFile) []SlotDiff {
+	beforeIdx := before.index()
+	slots := make(map[uint16]*SlotDiff)
+	wDrift := make(map[uint16][]float64)
+	vecDrift := make(map[uint16][]float64)
+	slotOf := func(slot uint16) *SlotDiff {
+		d, ok := slots[slot]
+		if !ok {
+			d = &SlotDiff{Slot: slot}
+			slots[slot] = d
+		}
+		return d
+	}
+	seen := make(map[uint64]bool, len(after.Entries))
+	for _, e := range after.Entries {
+		seen[e.Key] = true
+		d := slotOf(e.Slot)
+		o, ok := beforeIdx[e.Key]
+		if !ok {
+			d.Added++
+			continue
+		}
+		d.Common++
+		wDrift[e.Slot] = append(wDrift[e.Slot], math.Abs(float64(e.W-o.W)))
+		if len(e.Vec) == len(o.Vec) {
+			vec := base.InPlaceVecTimeAdd(append([]float32(nil), e.Vec...), o.Vec, 1.0, -1.0)
+			vecDrift[e.Slot] = append(vecDrift[e.Slot], math.Sqrt(float64(base.VecNorm32(vec))))
+		}
+	}
+	for _, e := range before.Entries {
+		if !seen[e.Key] {
+			slotOf(e.Slot).Removed++
+		}
+	}
+	diffs := make([]SlotDiff, 0, len(slots))
+	for slot, d := range slots {
+		d.WDrift = quantiles(wDrift[slot])
+		d.VecDrift = quantiles(vecDrift[slot])
+		diffs = append(diffs, *d)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Slot < diffs[j].Slot
+	})
+	return diffs
+}
+
+func PrintDiff(w io.Writer, diffs []SlotDiff) {
+	fmt.Fprintf(w, "slot\tadded\tremoved\tcommon\tw_p50\tw_p90\tw_p99\tw_max\tvec_p50\tvec_p90\tvec_p99\tvec_max\n")
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\t%.6f\n", d.Slot, d.Added,
+			d.Removed, d.Common, d.WDrift.P50, d.WDrift.P90, d.WDrift.P99, d.WDrift.Max, d.VecDrift.P50,
+			d.VecDrift.P90, d.VecDrift.P99, d.VecDrift.Max)
+	}
+}
+
+// histBuckets are the upper bounds of the norm histograms, the last bucket is open
+var histBuckets = []float64{1e-4, 1e-3, 1e-2, 1e-1, 1, 10}
+
+// SlotStats describes the keys of one slot
+type SlotStats struct {
+	Slot     uint16
+	Keys     int
+	ZeroW    int // keys whose linear weight is zero, e.g. cut by l1
+	ZeroVec  int // keys whose embedding is all zero
+	WHist    []int
+	VecHist  []int
+	MeanAbsW float64
+}
+
+// Sparsity is the ratio of zero linear weights
+func (s *SlotStats) Sparsity() float64 {
+	if s.Keys == 0 {
+		return 0
+	}
+	return float64(s.ZeroW) / float64(s.Keys)
+}
+
+func histIndex(x float64) int {
+	for i, b := range histBuckets {
+		if x < b {
+			return i
+		}
+	}
+	return len(histBuckets)
+}
+
+// Stats counts the keys of every slot, in slot order
+func Stats(m *ModelFile) []SlotStats {
+	slots := make(map[uint16]*SlotStats)
+	for _, e := range m.Entries {
+		s, ok := slots[e.Slot]
+		if !ok {
+			s = &SlotStats{Slot: e.Slot, WHist: make([]int, len(histBuckets)+1),
+				VecHist: make([]int, len(histBuckets)+1)}
+			slots[e.Slot] = s
+		}
+		s.Keys++
+		w := math.Abs(float64(e.W))
+		if w == 0 {
+			s.ZeroW++
+		}
+		s.MeanAbsW += w
+		s.WHist[histIndex(w)]++
+		norm := math.Sqrt(float64(base.VecNorm32(e.Vec)))
+		if norm == 0 {
+			s.ZeroVec++
+		}
+		s.VecHist[histIndex(norm)]++
+	}
+	stats := make([]SlotStats, 0, len(slots))
+	for _, s := range slots {
+		s.MeanAbsW /= float64(s.Keys)
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Slot < stats[j].Slot
+	})
+	return stats
+}
+
+func PrintStats(w io.Writer, m *ModelFile, stats []SlotStats) {
+	fmt.Fprintf(w, "meta: %s\nbias: %.6f\nkeys: %d\n", m.Meta, m.Bias, len(m.Entries))
+	header := "<1e-4"
+	for i := 1; i < len(histBuckets); i++ {
+		header += fmt.Sprintf(" <%g", histBuckets[i])
+	}
+	header += fmt.Sprintf(" >=%g", histBuckets[len(histBuckets)-1])
+	fmt.Fprintf(w, "slot\tkeys\tsparsity\tzero_vec\tmean_abs_w\t|w| histogram [%s]\t|vec| histogram\n", header)
+	for i := range stats {
+		s := &stats[i]
+		fmt.Fprintf(w, "%d\t%d\t%.4f\t%d\t%.6f\t%v\t%v\n", s.Slot, s.Keys, s.Sparsity(), s.ZeroVec, s.MeanAbsW,
+			s.WHist, s.VecHist)
+	}
+}
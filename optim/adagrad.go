@@ -0,0 +1,45 @@
+package optim
+
+import (
+	"linearmodel/base"
+)
+
+// AdaGrad scales the step by the accumulated squared gradient, state = [sum g^2].
+// With l1 (adagrad_l1) a proximal soft threshold is applied after every step.
+type AdaGrad struct {
+	hyper
+	withL1 bool
+}
+
+func (ada *AdaGrad) Update(grad float32, parameter *base.Parameter) {
+	h := ada.forSlot(parameter.Slot)
+	parameter.State = state(parameter.State, 1)
+	alpha := h.alpha * ada.schedule.Rate()
+	parameter.W, parameter.State[0] = ada.update(grad, parameter.W, parameter.State[0], alpha, h.beta, h.l1, h.l2)
+}
+
+func (ada *AdaGrad) UpdateEmb(gradVec []float32, parameter *base.Parameter) {
+	h := ada.forSlot(parameter.Slot)
+	n := len(parameter.VecW)
+	parameter.VecState = state(parameter.VecState, n)
+	alpha := h.embAlpha * ada.schedule.Rate()
+	for i := 0; i < n; i++ {
+		parameter.VecW[i], parameter.VecState[i] = ada.update(gradVec[i], parameter.VecW[i], parameter.VecState[i],
+			alpha, h.embBeta, h.embL1, h.embL2)
+	}
+}
+
+func (ada *AdaGrad) StateSize(n int) (int, int) {
+	return 1, n
+}
+
+func (ada *AdaGrad) update(grad, w, acc, alpha, beta, l1, l2 float32) (float32, float32) {
+	grad += l2 * w
+	acc += grad * grad
+	lr := alpha / (beta + sqrt32(acc))
+	w -= lr * grad
+	if ada.withL1 {
+		w = softThreshold(w, lr*l1)
+	}
+	return w, acc
+}
@@ -0,0 +1,47 @@
+package optim
+
+import (
+	"linearmodel/base"
+)
+
+// Adam with lazy sparse updates: moments and the bias correction step only advance
+// when the feature shows up, state = [m, v, t], embedding state = [m..., v..., t].
+type Adam struct {
+	hyper
+}
+
+func (adam *Adam) Update(grad float32, parameter *base.Parameter) {
+	h := adam.forSlot(parameter.Slot)
+	s := state(parameter.State, 3)
+	s[2] += 1
+	alpha := h.alpha * adam.schedule.Rate()
+	parameter.W, s[0], s[1] = adam.update(grad, parameter.W, s[0], s[1], s[2], alpha, h.l2, h)
+	parameter.State = s
+}
+
+func (adam *Adam) UpdateEmb(gradVec []float32, parameter *base.Parameter) {
+	h := adam.forSlot(parameter.Slot)
+	n := len(parameter.VecW)
+	s := state(parameter.VecState, 2*n+1)
+	s[2*n] += 1
+	t := s[2*n]
+	alpha := h.embAlpha * adam.schedule.Rate()
+	for i := 0; i < n; i++ {
+		parameter.VecW[i], s[i], s[n+i] = adam.update(gradVec[i], parameter.VecW[i], s[i], s[n+i], t, alpha, h.embL2, h)
+	}
+	parameter.VecState = s
+}
+
+func (adam *Adam) StateSize(n int) (int, int) {
+	return 3, 2*n + 1
+}
+
+func (adam *Adam) update(grad, w, m, v, t, alpha, l2 float32, h *hyper) (float32, float32, float32) {
+	grad += l2 * w
+	m = h.beta1*m + (1.0-h.beta1)*grad
+	v = h.beta2*v + (1.0-h.beta2)*grad*grad
+	mHat := m / (1.0 - pow32(h.beta1, t))
+	vHat := v / (1.0 - pow32(h.beta2, t))
+	w -= alpha * mHat / (sqrt32(vHat) + h.epsilon)
+	return w, m, v
+}
@@ -7,6 +7,9 @@ import (
 	"linearmodel/conf"
 )
 
+// Ftrl keeps z and n in the Z, N, VecZ and VecN fields of the parameter rather than in the State layout of the
+// other optimizers, which leaves the columns of saved models as they were. A slot alpha overrides the alpha of
+// linear weights only, embeddings keep emb_alpha.
 type Ftrl struct {
 	alpha    float32
 	beta     float32
@@ -17,6 +20,11 @@ type Ftrl struct {
 	embL1    float32
 	embL2    float32
 	embSize  uint32
+
+	schedule *Schedule
+
+	// per slot hyper parameters, read only after InitSlots
+	slots map[uint16]*Ftrl
 }
 
 func (ftrl *Ftrl) Init(conf *conf.OptimConfig) {
@@ -31,8 +39,52 @@ func (ftrl *Ftrl) Init(conf *conf.OptimConfig) {
 	ftrl.embSize = conf.EmbSize
 }
 
+func (ftrl *Ftrl) InitSlots(features []*conf.FeatureConfig) {
+	ftrl.slots = make(map[uint16]*Ftrl)
+	for _, x := range features {
+		if x.L1 == nil && x.L2 == nil && x.Alpha == nil && x.EmbL2 == nil {
+			continue
+		}
+		slotFtrl := *ftrl
+		slotFtrl.slots = nil
+		if x.L1 != nil {
+			slotFtrl.l1 = *x.L1
+		}
+		if x.L2 != nil {
+			slotFtrl.l2 = *x.L2
+		}
+		if x.Alpha != nil {
+			slotFtrl.alpha = *x.Alpha
+		}
+		if x.EmbL2 != nil {
+			slotFtrl.embL2 = *x.EmbL2
+		}
+		ftrl.slots[uint16(x.SlotId)] = &slotFtrl
+	}
+}
+
+func (ftrl *Ftrl) SetSchedule(schedule *Schedule) {
+	ftrl.schedule = schedule
+}
+
+func (ftrl *Ftrl) Schedule() *Schedule {
+	return ftrl.schedule
+}
+
+// forSlot returns the optimizer holding hyper parameters of the slot
+func (ftrl *Ftrl) forSlot(slot uint16) *Ftrl {
+	if p, ok := ftrl.slots[slot]; ok {
+		return p
+	}
+	return ftrl
+}
+
+// Update keeps z and n on the unscheduled alpha, the schedule only scales alpha in the weight computed from
+// them, so that a rate change does not bend the sigma already summed in z
 func (ftrl *Ftrl) Update(grad float32, parameter *base.Parameter) {
-	parameter.Z, parameter.N, parameter.W = ftrl.update(grad, parameter.Z, parameter.N, parameter.W)
+	opt := ftrl.forSlot(parameter.Slot)
+	rate := ftrl.schedule.Rate()
+	parameter.Z, parameter.N, parameter.W = opt.update(grad, parameter.Z, parameter.N, parameter.W, opt.alpha, rate)
 }
 
 func (ftrl *Ftrl) UpdateEmb(gradVec []float32, parameter *base.Parameter) {
@@ -40,14 +92,21 @@ func (ftrl *Ftrl) UpdateEmb(gradVec []float32, parameter *base.Parameter) {
 		glog.Fatalf("update embedding error, size not equal: grad=%d, emb_w=%d, emb_n=%d, emb_z=%d",
 			len(gradVec), len(parameter.VecW), len(parameter.VecN), len(parameter.VecZ))
 	}
+	opt := ftrl.forSlot(parameter.Slot)
+	rate := ftrl.schedule.Rate()
 	for i := 0; i < len(parameter.VecW); i++ {
 		z, n, w, g := parameter.VecZ[i], parameter.VecN[i], parameter.VecW[i], gradVec[i]
-		parameter.VecZ[i], parameter.VecN[i], parameter.VecW[i] = ftrl.updateEmb(g, z, n, w)
+		parameter.VecZ[i], parameter.VecN[i], parameter.VecW[i] = opt.updateEmb(g, z, n, w, opt.embAlpha, rate)
 	}
 }
 
-func (ftrl *Ftrl) update(grad, z, n, w float32) (float32, float32, float32) {
-	sigma := (sqrt32(n+grad*grad) - sqrt32(n)) / ftrl.alpha
+// StateSize is zero, ftrl keeps z and n in the parameter itself
+func (ftrl *Ftrl) StateSize(n int) (int, int) {
+	return 0, 0
+}
+
+func (ftrl *Ftrl) update(grad, z, n, w, alpha, rate float32) (float32, float32, float32) {
+	sigma := (sqrt32(n+grad*grad) - sqrt32(n)) / alpha
 	z += grad - sigma*w
 	n += grad * grad
 	sgn := float32(1.0)
@@ -57,13 +116,13 @@ func (ftrl *Ftrl) update(grad, z, n, w float32) (float32, float32, float32) {
 	if sgn*z < ftrl.l1 {
 		w = 0
 	} else {
-		w = -(z - sgn*ftrl.l1) / ((ftrl.beta+sqrt32(n))/ftrl.alpha + ftrl.l2)
+		w = -(z - sgn*ftrl.l1) / ((ftrl.beta+sqrt32(n))/(alpha*rate) + ftrl.l2)
 	}
 	return z, n, w
 }
 
-func (ftrl *Ftrl) updateEmb(grad, z, n, w float32) (float32, float32, float32) {
-	sigma := (sqrt32(n+grad*grad) - sqrt32(n)) / ftrl.embAlpha
+func (ftrl *Ftrl) updateEmb(grad, z, n, w, alpha, rate float32) (float32, float32, float32) {
+	sigma := (sqrt32(n+grad*grad) - sqrt32(n)) / alpha
 	z += grad - sigma*w
 	n += grad * grad
 	sgn := float32(1.0)
@@ -73,7 +132,7 @@ func (ftrl *Ftrl) updateEmb(grad, z, n, w float32) (float32, float32, float32) {
 	if sgn*z < ftrl.embL1 {
 		w = 0
 	} else {
-		w = -(z - sgn*ftrl.embL1) / ((ftrl.embBeta+sqrt32(n))/ftrl.embAlpha + ftrl.embL2)
+		w = -(z - sgn*ftrl.embL1) / ((ftrl.embBeta+sqrt32(n))/(alpha*rate) + ftrl.embL2)
 	}
 	return z, n, w
 }
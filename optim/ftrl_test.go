@@ -57,3 +57,41 @@ func TestFtrl_UpdateEmb(t *testing.T) {
 		t.Error("update2 embedding error")
 	}
 }
+
+func TestFtrl_InitSlots(t *testing.T) {
+	config := &conf.OptimConfig{Alpha: 0.1, Beta: 1.0, L1: 0.1, L2: 0.1,
+		EmbAlpha: 0.1, EmbBeta: 1.0, EmbL1: 0.1, EmbL2: 0.1, EmbSize: 2}
+	l1, alpha := float32(0.0), float32(0.2)
+	ftrl := Ftrl{}
+	ftrl.Init(config)
+	ftrl.InitSlots([]*conf.FeatureConfig{{SlotId: 101}, {SlotId: 102, L1: &l1, Alpha: &alpha}})
+	if ftrl.forSlot(101) != &ftrl || ftrl.forSlot(103) != &ftrl {
+		t.Error("slot without override should use global config")
+	}
+	opt := ftrl.forSlot(102)
+	if opt.l1 != 0.0 || opt.alpha != 0.2 || opt.l2 != 0.1 || opt.embL2 != 0.1 {
+		t.Error("slot override error: ", opt)
+	}
+	// slot 102 updates with alpha=0.2 and no l1
+	parameter := &base.Parameter{Slot: 101, W: 1.0}
+	ftrl.Update(0.1, parameter)
+	slotParameter := &base.Parameter{Slot: 102, W: 1.0}
+	ftrl.Update(0.1, slotParameter)
+	if base.NEQFloat32(parameter.W, 0.0720721) || base.NEQFloat32(slotParameter.W, 0.0714286) {
+		t.Error("update with slot config error: ", parameter.W, slotParameter.W)
+	}
+}
+
+func TestFtrl_Schedule(t *testing.T) {
+	config := &conf.OptimConfig{Alpha: 0.1, Beta: 1.0, L1: 0.1, L2: 0.1}
+	ftrl := Ftrl{}
+	ftrl.Init(config)
+	ftrl.SetSchedule(NewSchedule(&conf.OptimConfig{WarmupSteps: 2}))
+	parameter := &base.Parameter{W: 1.0}
+	ftrl.Update(0.1, parameter)
+	// z and n are those of the unscheduled update, w takes alpha 0.1 * 0.5 at warmup step 0
+	if base.NEQFloat32(parameter.Z, -0.9) || base.NEQFloat32(parameter.N, 0.01) ||
+		base.NEQFloat32(parameter.W, 0.8/(1.1/0.05+0.1)) {
+		t.Error("scheduled ftrl error: ", parameter.Z, parameter.N, parameter.W)
+	}
+}
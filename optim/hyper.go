@@ -0,0 +1,110 @@
+package optim
+
+import (
+	"math"
+
+	"linearmodel/conf"
+)
+
+// hyper holds the hyper parameters of the adaptive optimizers and their per slot overrides, a slot alpha
+// overrides the alpha of linear weights only
+type hyper struct {
+	alpha    float32
+	beta     float32
+	l1       float32
+	l2       float32
+	embAlpha float32
+	embBeta  float32
+	embL1    float32
+	embL2    float32
+	beta1    float32
+	beta2    float32
+	epsilon  float32
+	rho      float32
+	schedule *Schedule
+
+	slots map[uint16]*hyper
+}
+
+func (h *hyper) Init(conf *conf.OptimConfig) {
+	h.alpha = conf.Alpha
+	h.beta = conf.Beta
+	h.l1 = conf.L1
+	h.l2 = conf.L2
+	h.embAlpha = conf.EmbAlpha
+	h.embBeta = conf.EmbBeta
+	h.embL1 = conf.EmbL1
+	h.embL2 = conf.EmbL2
+	h.beta1 = defaultValue(conf.Beta1, 0.9)
+	h.beta2 = defaultValue(conf.Beta2, 0.999)
+	h.epsilon = defaultValue(conf.Epsilon, 1e-8)
+	h.rho = defaultValue(conf.Rho, 0.9)
+}
+
+func (h *hyper) InitSlots(features []*conf.FeatureConfig) {
+	h.slots = make(map[uint16]*hyper)
+	for _, x := range features {
+		if x.L1 == nil && x.L2 == nil && x.Alpha == nil && x.EmbL2 == nil {
+			continue
+		}
+		slotHyper := *h
+		slotHyper.slots = nil
+		if x.L1 != nil {
+			slotHyper.l1 = *x.L1
+		}
+		if x.L2 != nil {
+			slotHyper.l2 = *x.L2
+		}
+		if x.Alpha != nil {
+			slotHyper.alpha = *x.Alpha
+		}
+		if x.EmbL2 != nil {
+			slotHyper.embL2 = *x.EmbL2
+		}
+		h.slots[uint16(x.SlotId)] = &slotHyper
+	}
+}
+
+func (h *hyper) SetSchedule(schedule *Schedule) {
+	h.schedule = schedule
+}
+
+func (h *hyper) Schedule() *Schedule {
+	return h.schedule
+}
+
+func (h *hyper) forSlot(slot uint16) *hyper {
+	if p, ok := h.slots[slot]; ok {
+		return p
+	}
+	return h
+}
+
+func defaultValue(v, d float32) float32 {
+	if v == 0 {
+		return d
+	}
+	return v
+}
+
+// state returns s if it has the layout size n, otherwise a new zero state
+func state(s []float32, n int) []float32 {
+	if len(s) != n {
+		return make([]float32, n)
+	}
+	return s
+}
+
+func softThreshold(w, t float32) float32 {
+	if w > t {
+		return w - t
+	}
+	if w < -t {
+		return w + t
+	}
+	return 0
+}
+
+func pow32(x float32, n float32) float32 {
+	return float32(math.Pow(float64(x), float64(n)))
+}
@@ -1,12 +1,110 @@
 package optim
 
 import (
+	"github.com/golang/glog"
+
 	"linearmodel/base"
 	"linearmodel/conf"
 )
 
 type Optimizer interface {
 	Init(config *conf.OptimConfig)
+	InitSlots(features []*conf.FeatureConfig)
+	SetSchedule(schedule *Schedule)
+	Schedule() *Schedule
 	Update(grad float32, p *base.Parameter)
 	UpdateEmb(grad []float32, p *base.Parameter)
+	// StateSize is the length of State and VecState of an embedding of size n
+	StateSize(n int) (int, int)
+}
+
+// NewOptimizer creates the optimizers of linear weights and embeddings selected in config,
+// both follow the learning rate schedule, which may be nil.
+func NewOptimizer(config *conf.OptimConfig, features []*conf.FeatureConfig, schedule *Schedule) Optimizer {
+	name, embName := config.Optimizer, config.EmbOptimizer
+	if embName == "" {
+		embName = name
+	}
+	// sgd has no denominator for beta to smooth
+	if normName(name) == "sgd" && config.Beta != 0 {
+		glog.Fatalf("sgd takes no beta, got %g", config.Beta)
+	}
+	if normName(embName) == "sgd" && config.EmbBeta != 0 {
+		glog.Fatalf("sgd takes no emb_beta, got %g", config.EmbBeta)
+	}
+	var opt Optimizer
+	if normName(name) == normName(embName) {
+		opt = newOptimizer(name)
+	} else {
+		opt = &Mixed{linear: newOptimizer(name), emb: newOptimizer(embName)}
+	}
+	opt.Init(config)
+	opt.InitSlots(features)
+	opt.SetSchedule(schedule)
+	return opt
+}
+
+func normName(name string) string {
+	if name == "" {
+		return "ftrl"
+	}
+	return name
+}
+
+func newOptimizer(name string) Optimizer {
+	switch normName(name) {
+	case "ftrl":
+		return &Ftrl{}
+	case "sgd":
+		return &SGD{}
+	case "adagrad":
+		return &AdaGrad{}
+	case "adagrad_l1":
+		return &AdaGrad{withL1: true}
+	case "adam":
+		return &Adam{}
+	case "rmsprop":
+		return &RMSProp{}
+	}
+	glog.Fatalf("unknown optimizer: %s", name)
+	return nil
+}
+
+// Mixed updates linear weights and embeddings with different optimizers
+type Mixed struct {
+	linear Optimizer
+	emb    Optimizer
+}
+
+func (m *Mixed) Init(config *conf.OptimConfig) {
+	m.linear.Init(config)
+	m.emb.Init(config)
+}
+
+func (m *Mixed) InitSlots(features []*conf.FeatureConfig) {
+	m.linear.InitSlots(features)
+	m.emb.InitSlots(features)
+}
+
+func (m *Mixed) SetSchedule(schedule *Schedule) {
+	m.linear.SetSchedule(schedule)
+	m.emb.SetSchedule(schedule)
+}
+
+func (m *Mixed) Schedule() *Schedule {
+	return m.linear.Schedule()
+}
+
+func (m *Mixed) Update(grad float32, p *base.Parameter) {
+	m.linear.Update(grad, p)
+}
+
+func (m *Mixed) UpdateEmb(grad []float32, p *base.Parameter) {
+	m.emb.UpdateEmb(grad, p)
+}
+
+func (m *Mixed) StateSize(n int) (int, int) {
+	s, _ := m.linear.StateSize(n)
+	_, vs := m.emb.StateSize(n)
+	return s, vs
 }
@@ -0,0 +1,128 @@
+package optim
+
+import (
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+func _gen_optim_config(name string) *conf.OptimConfig {
+	config := &conf.OptimConfig{Alpha: 0.1, Beta: 1.0, L1: 0.1, L2: 0.1,
+		EmbAlpha: 0.1, EmbBeta: 1.0, EmbL1: 0.1, EmbL2: 0.1, EmbSize: 2, Optimizer: name}
+	if name == "sgd" {
+		config.Beta, config.EmbBeta = 0, 0
+	}
+	return config
+}
+
+func TestNewOptimizer(t *testing.T) {
+	if _, ok := NewOptimizer(_gen_optim_config(""), nil, nil).(*Ftrl); !ok {
+		t.Error("default optimizer should be ftrl")
+	}
+	config := _gen_optim_config("ftrl")
+	config.EmbOptimizer = "adam"
+	mixed, ok := NewOptimizer(config, nil, nil).(*Mixed)
+	if !ok {
+		t.Fatal("different linear and embedding optimizer should be mixed")
+	}
+	if _, ok := mixed.emb.(*Adam); !ok {
+		t.Error("embedding optimizer should be adam")
+	}
+}
+
+func TestOptimizer_Update(t *testing.T) {
+	cases := []struct {
+		name  string
+		w     float32
+		state []float32
+	}{
+		{"adagrad", 0.9833333, []float32{0.04}},
+		{"adagrad_l1", 0.975, []float32{0.04}},
+		{"adam", 0.9, []float32{0.02, 0.00004, 1}},
+		{"rmsprop", 0.6837722, []float32{0.004}},
+	}
+	for _, c := range cases {
+		opt := NewOptimizer(_gen_optim_config(c.name), nil, nil)
+		parameter := &base.Parameter{W: 1.0, VecW: []float32{1.0, 1.0}}
+		opt.Update(0.1, parameter)
+		if base.NEQFloat32(parameter.W, c.w) || base.NEQSliceFloat32(parameter.State, c.state) {
+			t.Errorf("%s update error: w=%f, state=%v", c.name, parameter.W, parameter.State)
+		}
+		opt.UpdateEmb([]float32{0.1, 0.1}, parameter)
+		if base.NEQSliceFloat32(parameter.VecW, []float32{c.w, c.w}) {
+			t.Errorf("%s update embedding error: w=%v, state=%v", c.name, parameter.VecW, parameter.VecState)
+		}
+	}
+}
+
+func TestOptimizer_StateSize(t *testing.T) {
+	for _, name := range []string{"ftrl", "sgd", "adagrad", "adagrad_l1", "adam", "rmsprop"} {
+		config := _gen_optim_config(name)
+		config.SgdDecay = 0.1
+		opt := NewOptimizer(config, nil, nil)
+		parameter := &base.Parameter{W: 1.0, VecW: make([]float32, 3), VecZ: make([]float32, 3), VecN: make([]float32, 3)}
+		opt.Update(0.1, parameter)
+		opt.UpdateEmb([]float32{0.1, 0.1, 0.1}, parameter)
+		s, vs := opt.StateSize(3)
+		if len(parameter.State) != s || len(parameter.VecState) != vs {
+			t.Errorf("%s state size %d, %d, want %d, %d", name, len(parameter.State), len(parameter.VecState), s, vs)
+		}
+	}
+}
+
+func TestAdam_LazyStep(t *testing.T) {
+	opt := NewOptimizer(_gen_optim_config("adam"), nil, nil)
+	p1 := &base.Parameter{W: 1.0}
+	p2 := &base.Parameter{W: 1.0}
+	opt.Update(0.1, p1)
+	opt.Update(0.1, p1)
+	opt.Update(0.1, p2)
+	if p1.State[2] != 2 || p2.State[2] != 1 {
+		t.Error("adam step should only advance for updated parameter")
+	}
+	if base.NEQFloat32(p2.W, 0.9) {
+		t.Error("adam bias correction of a new parameter error: ", p2.W)
+	}
+}
+
+func TestSGD_SlotEmbL2(t *testing.T) {
+	embL2 := float32(0.5)
+	features := []*conf.FeatureConfig{{SlotId: 101, EmbL2: &embL2}}
+	config := _gen_optim_config("sgd")
+	config.EmbL1 = 0
+	opt := NewOptimizer(config, features, nil)
+	for slot, want := range map[uint16]float32{101: 0.9, 102: 0.98} {
+		parameter := &base.Parameter{Slot: slot, VecW: []float32{1.0}}
+		opt.UpdateEmb([]float32{0.0}, parameter)
+		// (1 - 2 * emb_l2 * alpha) * w, emb_l2 is l2 unless the slot sets it
+		if base.NEQFloat32(parameter.VecW[0], want) {
+			t.Errorf("slot %d: sgd emb_l2 error: %v", slot, parameter.VecW)
+		}
+	}
+}
+
+func TestSGD_L1AndEmbAlpha(t *testing.T) {
+	config := _gen_optim_config("sgd")
+	config.L2, config.EmbL2 = 0, 0
+	config.EmbAlpha = 0.5
+	for _, l1 := range []float32{0, 0.1} {
+		config.L1, config.EmbL1 = l1, l1
+		opt := NewOptimizer(config, nil, nil)
+		parameter := &base.Parameter{W: 1.0, VecW: []float32{1.0, 0.01}}
+		opt.Update(0.0, parameter)
+		// w - grad * alpha, soft thresholded by l1 * alpha
+		if want := 1.0 - l1*0.1; base.NEQFloat32(parameter.W, want) {
+			t.Errorf("l1 %g: sgd w=%f, want %f", l1, parameter.W, want)
+		}
+		opt.UpdateEmb([]float32{0.2, 0.0}, parameter)
+		want := []float32{0.9, 0.01}
+		if l1 > 0 {
+			// the step takes emb_alpha, and l1 * emb_alpha zeroes the small weight
+			want = []float32{0.85, 0}
+		}
+		if base.NEQSliceFloat32(parameter.VecW, want) {
+			t.Errorf("l1 %g: sgd embedding %v, want %v", l1, parameter.VecW, want)
+		}
+	}
+}
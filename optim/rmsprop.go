@@ -0,0 +1,39 @@
+package optim
+
+import (
+	"linearmodel/base"
+)
+
+// RMSProp scales the step by a moving average of squared gradient, state = [v]
+type RMSProp struct {
+	hyper
+}
+
+func (rms *RMSProp) Update(grad float32, parameter *base.Parameter) {
+	h := rms.forSlot(parameter.Slot)
+	parameter.State = state(parameter.State, 1)
+	alpha := h.alpha * rms.schedule.Rate()
+	parameter.W, parameter.State[0] = rms.update(grad, parameter.W, parameter.State[0], alpha, h.l2, h)
+}
+
+func (rms *RMSProp) UpdateEmb(gradVec []float32, parameter *base.Parameter) {
+	h := rms.forSlot(parameter.Slot)
+	n := len(parameter.VecW)
+	parameter.VecState = state(parameter.VecState, n)
+	alpha := h.embAlpha * rms.schedule.Rate()
+	for i := 0; i < n; i++ {
+		parameter.VecW[i], parameter.VecState[i] = rms.update(gradVec[i], parameter.VecW[i], parameter.VecState[i],
+			alpha, h.embL2, h)
+	}
+}
+
+func (rms *RMSProp) StateSize(n int) (int, int) {
+	return 1, n
+}
+
+func (rms *RMSProp) update(grad, w, v, alpha, l2 float32, h *hyper) (float32, float32) {
+	grad += l2 * w
+	v = h.rho*v + (1.0-h.rho)*grad*grad
+	w -= alpha * grad / (sqrt32(v) + h.epsilon)
+	return w, v
+}
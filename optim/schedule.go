@@ -0,0 +1,97 @@
+package optim
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"linearmodel/conf"
+)
+
+// Schedule scales the learning rate by a global step shared by all training workers.
+// A nil schedule keeps the rate constant.
+type Schedule struct {
+	step       int64
+	kind       string
+	warmup     float64
+	decaySteps float64
+	decayRate  float64
+	totalSteps float64
+	minRate    float64
+}
+
+func NewSchedule(config *conf.OptimConfig) *Schedule {
+	s := &Schedule{
+		kind:       config.LrSchedule,
+		warmup:     float64(config.WarmupSteps),
+		decaySteps: float64(config.DecaySteps),
+		decayRate:  float64(config.DecayRate),
+		totalSteps: float64(config.TotalSteps),
+		minRate:    float64(config.MinLrRate),
+	}
+	switch s.kind {
+	case "", "constant":
+	case "step":
+		if s.decaySteps == 0 || s.decayRate == 0 {
+			glog.Fatal("step schedule needs decay_steps and decay_rate")
+		}
+	case "cosine":
+		if s.totalSteps == 0 {
+			glog.Fatal("cosine schedule needs total_steps")
+		}
+	case "inverse_sqrt":
+		if s.decaySteps == 0 {
+			s.decaySteps = math.Max(s.warmup, 1.0)
+		}
+	default:
+		glog.Fatalf("unknown lr schedule: %s", s.kind)
+	}
+	return s
+}
+
+// Advance moves the global step by n trained instances
+func (s *Schedule) Advance(n int) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.step, int64(n))
+}
+
+// SetStep restores the global step of a saved model
+func (s *Schedule) SetStep(step int64) {
+	if s == nil {
+		return
+	}
+	atomic.StoreInt64(&s.step, step)
+}
+
+func (s *Schedule) Step() int64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&s.step)
+}
+
+// Rate is the multiplier of the learning rate at the current step
+func (s *Schedule) Rate() float32 {
+	if s == nil {
+		return 1.0
+	}
+	step := float64(s.Step())
+	if step < s.warmup {
+		return float32((step + 1.0) / s.warmup)
+	}
+	t := step - s.warmup
+	rate := 1.0
+	switch s.kind {
+	case "step":
+		rate = math.Pow(s.decayRate, math.Floor(t/s.decaySteps))
+	case "cosine":
+		rate = 0.5 * (1.0 + math.Cos(math.Pi*math.Min(t, s.totalSteps)/s.totalSteps))
+		rate = s.minRate + (1.0-s.minRate)*rate
+	case "inverse_sqrt":
+		rate = 1.0 / math.Sqrt(1.0+t/s.decaySteps)
+	}
+	return float32(math.Max(rate, s.minRate))
+}
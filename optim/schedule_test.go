@@ -0,0 +1,69 @@
+package optim
+
+import (
+	"sync"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+func TestSchedule_Rate(t *testing.T) {
+	cases := []struct {
+		config *conf.OptimConfig
+		step   int
+		rate   float32
+	}{
+		{&conf.OptimConfig{WarmupSteps: 10}, 0, 0.1},
+		{&conf.OptimConfig{WarmupSteps: 10}, 4, 0.5},
+		{&conf.OptimConfig{WarmupSteps: 10}, 10, 1.0},
+		{&conf.OptimConfig{LrSchedule: "step", DecaySteps: 100, DecayRate: 0.5}, 250, 0.25},
+		{&conf.OptimConfig{LrSchedule: "cosine", TotalSteps: 100, MinLrRate: 0.1}, 50, 0.55},
+		{&conf.OptimConfig{LrSchedule: "cosine", TotalSteps: 100, MinLrRate: 0.1}, 200, 0.1},
+		{&conf.OptimConfig{LrSchedule: "inverse_sqrt", DecaySteps: 100}, 300, 0.5},
+		{&conf.OptimConfig{LrSchedule: "inverse_sqrt", WarmupSteps: 100}, 400, 0.5},
+	}
+	for _, c := range cases {
+		s := NewSchedule(c.config)
+		s.Advance(c.step)
+		if rate := s.Rate(); base.NEQFloat32(rate, c.rate) {
+			t.Errorf("%s schedule at step %d: rate=%f, true rate=%f", c.config.LrSchedule, c.step, rate, c.rate)
+		}
+	}
+	var s *Schedule
+	if s.Rate() != 1.0 {
+		t.Error("nil schedule should keep rate constant")
+	}
+}
+
+func TestSchedule_Advance(t *testing.T) {
+	s := NewSchedule(&conf.OptimConfig{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Advance(2)
+			}
+		}()
+	}
+	wg.Wait()
+	if s.Step() != 2000 {
+		t.Error("global step error: ", s.Step())
+	}
+}
+
+func TestSGD_Decay(t *testing.T) {
+	config := &conf.OptimConfig{Alpha: 0.1, SgdDecay: 1.0, Optimizer: "sgd"}
+	schedule := NewSchedule(&conf.OptimConfig{WarmupSteps: 2})
+	opt := NewOptimizer(config, nil, schedule)
+	parameter := &base.Parameter{W: 0.0}
+	opt.Update(1.0, parameter)
+	schedule.Advance(2)
+	opt.Update(1.0, parameter)
+	// rate 0.05 at warmup step 0, then 0.1 / (1 + 1) after one update
+	if base.NEQFloat32(parameter.W, -0.1) || parameter.State[0] != 2 {
+		t.Error("sgd decay error: ", parameter.W, parameter.State)
+	}
+}
@@ -5,27 +5,100 @@ import (
 	"linearmodel/conf"
 )
 
+// SGD steps against the gradient with l2 weight decay, then soft thresholds the weight by l1 times the rate.
+// Embeddings use emb_alpha and emb_l1. There is no beta, NewOptimizer rejects one.
 type SGD struct {
-	alpha float32
-	beta  float32
-	l1    float32
-	l2    float32
+	alpha    float32
+	l1       float32
+	l2       float32
+	embAlpha float32
+	embL1    float32
+	embL2    float32 // l2 of embeddings, l2 unless a slot sets emb_l2
+	decay    float32
+
+	schedule *Schedule
+	slots    map[uint16]*SGD
 }
 
 func (sgd *SGD) Init(conf *conf.OptimConfig) {
-	sgd.alpha = float32(conf.Alpha)
-	sgd.beta = float32(conf.Beta)
-	sgd.l1 = float32(conf.L1)
-	sgd.l2 = float32(conf.L2)
+	sgd.alpha = conf.Alpha
+	sgd.l1 = conf.L1
+	sgd.l2 = conf.L2
+	sgd.embAlpha = conf.EmbAlpha
+	sgd.embL1 = conf.EmbL1
+	sgd.embL2 = sgd.l2
+	sgd.decay = conf.SgdDecay
+}
+
+func (sgd *SGD) SetSchedule(schedule *Schedule) {
+	sgd.schedule = schedule
+}
+
+func (sgd *SGD) Schedule() *Schedule {
+	return sgd.schedule
+}
+
+func (sgd *SGD) InitSlots(features []*conf.FeatureConfig) {
+	sgd.slots = make(map[uint16]*SGD)
+	for _, x := range features {
+		if x.L1 == nil && x.L2 == nil && x.Alpha == nil && x.EmbL2 == nil {
+			continue
+		}
+		slotSgd := *sgd
+		slotSgd.slots = nil
+		if x.L1 != nil {
+			slotSgd.l1 = *x.L1
+		}
+		if x.L2 != nil {
+			slotSgd.l2 = *x.L2
+			slotSgd.embL2 = *x.L2
+		}
+		if x.Alpha != nil {
+			slotSgd.alpha = *x.Alpha
+		}
+		if x.EmbL2 != nil {
+			slotSgd.embL2 = *x.EmbL2
+		}
+		sgd.slots[uint16(x.SlotId)] = &slotSgd
+	}
+}
+
+func (sgd *SGD) forSlot(slot uint16) *SGD {
+	if p, ok := sgd.slots[slot]; ok {
+		return p
+	}
+	return sgd
 }
 
 func (sgd *SGD) Update(grad float32, parameter *base.Parameter) {
-	parameter.W = (1.0-2.0*sgd.l2*sgd.alpha)*parameter.W - grad*sgd.alpha
+	opt := sgd.forSlot(parameter.Slot)
+	alpha := opt.alpha * sgd.schedule.Rate()
+	if sgd.decay > 0 {
+		// state = [updates]
+		parameter.State = state(parameter.State, 1)
+		alpha /= 1.0 + sgd.decay*parameter.State[0]
+		parameter.State[0] += 1
+	}
+	parameter.W = softThreshold((1.0-2.0*opt.l2*alpha)*parameter.W-grad*alpha, opt.l1*alpha)
 }
 
 func (sgd *SGD) UpdateEmb(gradVec []float32, parameter *base.Parameter) {
+	opt := sgd.forSlot(parameter.Slot)
+	alpha := opt.embAlpha * sgd.schedule.Rate()
+	if sgd.decay > 0 {
+		parameter.VecState = state(parameter.VecState, 1)
+		alpha /= 1.0 + sgd.decay*parameter.VecState[0]
+		parameter.VecState[0] += 1
+	}
 	for i := 0; i < len(parameter.VecW); i++ {
 		grad := gradVec[i]
-		parameter.VecW[i] = (1.0-2.0*sgd.l2*sgd.alpha)*parameter.VecW[i] - grad*sgd.alpha
+		parameter.VecW[i] = softThreshold((1.0-2.0*opt.embL2*alpha)*parameter.VecW[i]-grad*alpha, opt.embL1*alpha)
+	}
+}
+
+func (sgd *SGD) StateSize(n int) (int, int) {
+	if sgd.decay > 0 {
+		return 1, 1
 	}
+	return 0, 0
 }
@@ -0,0 +1,54 @@
+package profile
+
+import (
+	"math"
+	"math/bits"
+)
+
+// hllPrecision sets 2^p registers, the relative error of the count is about 1.04/sqrt(2^p)
+const hllPrecision = 14
+
+// hyperLogLog counts distinct keys in 2^hllPrecision bytes
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// mix spreads the bits of a key, signed inputs have small keys that are not hashes
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (h *hyperLogLog) add(key uint64) {
+	x := mix(key)
+	i := x >> (64 - hllPrecision)
+	rho := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rho > h.registers[i] {
+		h.registers[i] = rho
+	}
+}
+
+func (h *hyperLogLog) count() float64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for few keys
+		e = m * math.Log(m/float64(zeros))
+	}
+	return e
+}
@@ -0,0 +1,191 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+// topCapacity is the number of keys tracked per slot for every top key reported
+const topCapacity = 50
+
+// Profile describes the instances of training files, slot by slot
+type Profile struct {
+	Instances int64
+	LabelSum  float64
+	top       int
+	listed    map[uint16]bool
+	slots     map[uint16]*slotProfile
+	feaCounts map[int]int64 // instances by their feature count
+}
+
+type slotProfile struct {
+	instances int64 // instances with a feature of the slot
+	features  int64
+	labelSum  float64 // labels of the instances with the slot
+	keys      *hyperLogLog
+	topKeys   *topKeys
+}
+
+// New profiles the slots of config's feature list and the slots out of it, top is the number of
+// most frequent keys reported per slot
+func New(config *conf.AllConfig, top int) *Profile {
+	p := &Profile{top: top, listed: make(map[uint16]bool), slots: make(map[uint16]*slotProfile),
+		feaCounts: make(map[int]int64)}
+	for _, x := range config.FeatureList {
+		p.listed[uint16(x.SlotId)] = true
+	}
+	return p
+}
+
+func (p *Profile) Add(ins *base.Instance) {
+	p.Instances++
+	p.LabelSum += float64(ins.Label)
+	p.feaCounts[len(ins.Feas)]++
+	seen := make(map[uint16]bool, 16)
+	for _, x := range ins.Feas {
+		s, ok := p.slots[x.Slot]
+		if !ok {
+			s = &slotProfile{keys: newHyperLogLog(), topKeys: newTopKeys(maxInt(topCapacity*p.top, 1000))}
+			p.slots[x.Slot] = s
+		}
+		if !seen[x.Slot] {
+			seen[x.Slot] = true
+			s.instances++
+			s.labelSum += float64(ins.Label)
+		}
+		s.features++
+		s.keys.add(x.Fea)
+		s.topKeys.add(x.Fea, x.Text, ins.Label)
+	}
+}
+
+// SlotProfile describes the features of a slot
+type SlotProfile struct {
+	Slot        uint16
+	Listed      bool    // in the feature list, other slots are dropped by the loader
+	Coverage    float64 // share of instances with a feature of the slot
+	BagSize     float64 // mean features of the slot in an instance that has it
+	Cardinality float64 // estimated distinct keys
+	LabelMean   float64 // mean label of the instances with the slot
+	Top         []TopKey
+}
+
+// TopKey is a frequent key of a slot, Count is an upper bound that may be overestimated
+// when the slot has many more keys than are tracked
+type TopKey struct {
+	Text      string
+	Key       uint64
+	Count     int64
+	LabelMean float64 // mean label of the instances having the key
+}
+
+// Slots describes every slot seen and every slot of the feature list, in slot order
+func (p *Profile) Slots() []SlotProfile {
+	res := make([]SlotProfile, 0, len(p.slots))
+	for slot, s := range p.slots {
+		x := SlotProfile{Slot: slot, Listed: p.listed[slot], BagSize: float64(s.features) / float64(s.instances),
+			Cardinality: s.keys.count(), LabelMean: s.labelSum / float64(s.instances)}
+		if p.Instances > 0 {
+			x.Coverage = float64(s.instances) / float64(p.Instances)
+		}
+		for _, item := range s.topKeys.top(p.top) {
+			x.Top = append(x.Top, TopKey{Text: item.text, Key: item.key, Count: item.count,
+				LabelMean: item.labelSum / float64(item.seen)})
+		}
+		res = append(res, x)
+	}
+	for slot := range p.listed {
+		if _, ok := p.slots[slot]; !ok {
+			res = append(res, SlotProfile{Slot: slot, Listed: true})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Slot < res[j].Slot
+	})
+	return res
+}
+
+// Quantiles summarizes the features per instance
+type Quantiles struct {
+	Mean               float64
+	P50, P90, P99, Max int
+}
+
+// FeatureCounts is the distribution of features per instance
+func (p *Profile) FeatureCounts() Quantiles {
+	var q Quantiles
+	if p.Instances == 0 {
+		return q
+	}
+	counts := make([]int, 0, len(p.feaCounts))
+	for n := range p.feaCounts {
+		counts = append(counts, n)
+	}
+	sort.Ints(counts)
+	at := func(r float64) int {
+		rank := int64(r * float64(p.Instances-1))
+		for _, n := range counts {
+			if rank < p.feaCounts[n] {
+				return n
+			}
+			rank -= p.feaCounts[n]
+		}
+		return counts[len(counts)-1]
+	}
+	for _, n := range counts {
+		q.Mean += float64(n) * float64(p.feaCounts[n])
+	}
+	q.Mean /= float64(p.Instances)
+	q.P50, q.P90, q.P99, q.Max = at(0.5), at(0.9), at(0.99), counts[len(counts)-1]
+	return q
+}
+
+func (p *Profile) Print(w io.Writer) {
+	labelMean := 0.0
+	if p.Instances > 0 {
+		labelMean = p.LabelSum / float64(p.Instances)
+	}
+	q := p.FeatureCounts()
+	fmt.Fprintf(w, "instances: %d\nlabel mean: %.6f\nfeatures per instance: mean %.2f p50 %d p90 %d p99 %d max %d\n",
+		p.Instances, labelMean, q.Mean, q.P50, q.P90, q.P99, q.Max)
+	slots := p.Slots()
+	fmt.Fprintf(w, "slot\tlisted\tcoverage\tbag_size\tcardinality\tlabel_mean\n")
+	var missing, unlisted []uint16
+	for _, s := range slots {
+		fmt.Fprintf(w, "%d\t%v\t%.4f\t%.2f\t%.0f\t%.6f\n", s.Slot, s.Listed, s.Coverage, s.BagSize, s.Cardinality,
+			s.LabelMean)
+		if s.Coverage == 0 {
+			missing = append(missing, s.Slot)
+		}
+		if !s.Listed {
+			unlisted = append(unlisted, s.Slot)
+		}
+	}
+	fmt.Fprintf(w, "slots of the feature list missing in the data: %v\n", missing)
+	fmt.Fprintf(w, "slots in the data out of the feature list, dropped in training: %v\n", unlisted)
+	for _, s := range slots {
+		if len(s.Top) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "slot %d top keys\ntext\tcount\tshare\tlabel_mean\n", s.Slot)
+		for _, x := range s.Top {
+			text := x.Text
+			if text == "" {
+				text = strconv.FormatUint(x.Key, 10)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%.4f\t%.6f\n", text, x.Count, float64(x.Count)/float64(p.Instances), x.LabelMean)
+		}
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,100 @@
+package profile
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"linearmodel/base"
+	"linearmodel/conf"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{10, 1000, 200000} {
+		h := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			// keys of signed input are small and repeated
+			h.add(uint64(i))
+			h.add(uint64(i))
+		}
+		if c := h.count(); math.Abs(c-float64(n)) > 0.03*float64(n)+1 {
+			t.Errorf("%d keys counted as %.0f", n, c)
+		}
+	}
+}
+
+func TestTopKeys(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	top := newTopKeys(100)
+	counts := make(map[uint64]int64)
+	for i := 0; i < 100000; i++ {
+		// keys 0..9 make half of the stream, the rest are spread over 100000 keys
+		key := uint64(r.Intn(10))
+		if r.Intn(2) == 0 {
+			key = uint64(10 + r.Intn(100000))
+		}
+		counts[key]++
+		label := float32(0)
+		if key == 0 {
+			label = 1
+		}
+		top.add(key, strconv.FormatUint(key, 10), label)
+	}
+	items := top.top(10)
+	if len(items) != 10 {
+		t.Fatalf("%d top keys", len(items))
+	}
+	for _, x := range items {
+		if x.key >= 10 || x.count < counts[x.key] {
+			t.Errorf("top key %d of count %d, counted %d", x.key, x.count, counts[x.key])
+		}
+		if rate := x.labelSum / float64(x.seen); (x.key == 0) != (rate == 1) {
+			t.Errorf("label mean of key %d is %f", x.key, rate)
+		}
+	}
+}
+
+func _ins(label float32, feas ...base.Feature) *base.Instance {
+	z := &base.Instance{Label: label}
+	for i := range feas {
+		feas[i].Encode()
+		z.Feas = append(z.Feas, &feas[i])
+	}
+	return z
+}
+
+func TestProfile(t *testing.T) {
+	config := &conf.AllConfig{FeatureList: []*conf.FeatureConfig{{SlotId: 101}, {SlotId: 102}, {SlotId: 105}}}
+	p := New(config, 2)
+	p.Add(_ins(1, base.Feature{Slot: 101, Text: "a"}, base.Feature{Slot: 102, Text: "x"},
+		base.Feature{Slot: 102, Text: "y"}, base.Feature{Slot: 103, Text: "z"}))
+	p.Add(_ins(0, base.Feature{Slot: 101, Text: "a"}, base.Feature{Slot: 102, Text: "x"}))
+	p.Add(_ins(0, base.Feature{Slot: 101, Text: "b"}))
+	p.Add(_ins(1, base.Feature{Slot: 101, Text: "a"}))
+
+	slots := p.Slots()
+	if len(slots) != 4 {
+		t.Fatalf("slots %+v", slots)
+	}
+	s := slots[0]
+	if s.Slot != 101 || !s.Listed || s.Coverage != 1 || s.BagSize != 1 || math.Round(s.Cardinality) != 2 ||
+		s.LabelMean != 0.5 {
+		t.Errorf("slot 101 %+v", s)
+	}
+	if len(s.Top) != 2 || s.Top[0].Text != "a" || s.Top[0].Count != 3 || math.Abs(s.Top[0].LabelMean-2.0/3) > 1e-9 {
+		t.Errorf("top keys of slot 101 %+v", s.Top)
+	}
+	if s := slots[1]; s.Slot != 102 || s.Coverage != 0.5 || s.BagSize != 1.5 {
+		t.Errorf("slot 102 %+v", s)
+	}
+	if s := slots[2]; s.Slot != 103 || s.Listed || s.Coverage != 0.25 {
+		t.Errorf("slot 103 out of the feature list %+v", s)
+	}
+	if s := slots[3]; s.Slot != 105 || !s.Listed || s.Coverage != 0 {
+		t.Errorf("slot 105 missing in the data %+v", s)
+	}
+	if q := p.FeatureCounts(); q.Mean != 2 || q.P50 != 1 || q.Max != 4 {
+		t.Errorf("features per instance %+v", q)
+	}
+}
@@ -0,0 +1,90 @@
+package profile
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// topKeys keeps the most frequent keys of a slot in bounded memory with the space saving
+// algorithm: a new key takes the place of the least frequent one and inherits its count, so
+// counts are upper bounds that exceed the truth by at most the count inherited
+type topKeys struct {
+	capacity int
+	items    map[uint64]*topItem
+	heap     topHeap
+}
+
+type topItem struct {
+	key      uint64
+	text     string
+	count    int64   // occurrences, including those of the keys replaced
+	seen     int64   // occurrences since the key took its place
+	labelSum float64 // labels of the seen occurrences
+	index    int
+}
+
+func newTopKeys(capacity int) *topKeys {
+	return &topKeys{capacity: capacity, items: make(map[uint64]*topItem)}
+}
+
+func (t *topKeys) add(key uint64, text string, label float32) {
+	if x, ok := t.items[key]; ok {
+		x.count++
+		x.seen++
+		x.labelSum += float64(label)
+		heap.Fix(&t.heap, x.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		x := &topItem{key: key, text: text, count: 1, seen: 1, labelSum: float64(label)}
+		t.items[key] = x
+		heap.Push(&t.heap, x)
+		return
+	}
+	x := t.heap[0]
+	delete(t.items, x.key)
+	x.key, x.text = key, text
+	x.count++
+	x.seen, x.labelSum = 1, float64(label)
+	t.items[key] = x
+	heap.Fix(&t.heap, 0)
+}
+
+// top returns the n most frequent keys, most frequent first
+func (t *topKeys) top(n int) []*topItem {
+	items := append([]*topItem(nil), t.heap...)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].count != items[j].count {
+			return items[i].count > items[j].count
+		}
+		return items[i].key < items[j].key
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+// topHeap is a min heap of counts
+type topHeap []*topItem
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h topHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topHeap) Push(x interface{}) {
+	item := x.(*topItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/golang/glog"
 
 	"linearmodel/base"
+	"linearmodel/conf"
 	"linearmodel/dataloader"
+	"linearmodel/loss"
 	"linearmodel/metric"
 	"linearmodel/model"
 )
@@ -35,17 +37,24 @@ func Test(p string) error {
 	return nil
 }
 
+// ParsePath expands the globs of s and checks that the files can be opened, - is stdin
 func ParsePath(s []string) ([]string, error) {
 	rs := []string{}
 	for _, si := range s {
+		if si == dataloader.Stdin {
+			rs = append(rs, si)
+			continue
+		}
 		ps, err := CheckDir(si)
 		if err != nil {
 			return nil, err
 		}
 		for _, p := range ps {
-			err := Test(p)
-			if err != nil {
-				return nil, err
+			// opening a named pipe to check it would make its writer see the reader go
+			if !dataloader.IsStream(p) {
+				if err := Test(p); err != nil {
+					return nil, err
+				}
 			}
 			rs = append(rs, p)
 		}
@@ -72,11 +81,12 @@ func run_test(test_list []string, m model.IModel, loader dataloader.IDataLoader,
 	return auc, loss, gauc, float64(len(pred)), pred
 }
 
-func TrainParallel(m model.IModel, loader dataloader.IDataLoader, parallel int, path string) {
+// TrainParallel trains m on path, the error tells that the loader is over its error budget
+func TrainParallel(m model.IModel, loader dataloader.IDataLoader, parallel int, path string) error {
 	dataChan, err := loader.ReadFile(path)
 	if err != nil {
 		glog.Error("open file error: ", err)
-		return
+		return loader.Err()
 	}
 
 	group := sync.WaitGroup{}
@@ -86,15 +96,15 @@ func TrainParallel(m model.IModel, loader dataloader.IDataLoader, parallel int,
 			defer group.Done()
 			glog.V(3).Info("start worker: ", i)
 			for p := range dataChan {
-				err := m.Train(loader.ParseIns(p))
-				if err != nil {
-					glog.Error(err)
+				ins := loader.ParseIns(p)
+				if err := m.Train(ins); err != nil {
+					loader.CountError(dataloader.ErrTrain, len(ins), err)
 				}
 			}
 		}(i)
 	}
 	group.Wait()
-
+	return loader.Err()
 }
 
 func PredictParallel(m model.IModel, loader dataloader.IDataLoader, parallel int, path string) []base.Result {
@@ -127,8 +137,47 @@ func PredictParallel(m model.IModel, loader dataloader.IDataLoader, parallel int
 	return res
 }
 
-func EvalParallel(m model.IModel, loader dataloader.IDataLoader, evalList []string, parallel int) {
+// TaskResult picks the label and score of one task from multi-task results
+func TaskResult(preds []base.Result, task int) []base.Result {
+	res := make([]base.Result, 0, len(preds))
+	for _, x := range preds {
+		if task >= len(x.Scores) || task >= len(x.Labels) {
+			continue
+		}
+		res = append(res, base.Result{UserId: x.UserId, Label: x.Labels[task], Score: x.Scores[task]})
+	}
+	return res
+}
+
+// EvalParallel logs the metrics of m on predict_list, unless the loader is over its error budget
+func EvalParallel(m model.IModel, loader dataloader.IDataLoader, config *conf.AllConfig, parallel int) error {
 	m.Eval(true)
-	auc, loss, gauc, _, preds := run_test(evalList, m, loader, parallel)
-	glog.Infof("test samples count=%d\nauc=%.5f\ngauc=%.5f\nloss=%.5f\n", len(preds), auc, gauc, loss)
+	auc, logloss, gauc, _, preds := run_test(config.PredictList, m, loader, parallel)
+	if err := loader.Err(); err != nil {
+		return err
+	}
+	if len(preds) == 0 {
+		return nil
+	}
+	if loss.IsRegression(config.LossConfig) {
+		glog.Infof("test samples count=%d\nrmse=%.5f\nmae=%.5f\npoisson_deviance=%.5f\n", len(preds),
+			metric.RMSE(preds), metric.MAE(preds), metric.PoissonDeviance(preds))
+		for i, name := range config.MultiTaskConfig.GetTaskName() {
+			taskPreds := TaskResult(preds, i)
+			glog.Infof("task %s: rmse=%.5f\nmae=%.5f\npoisson_deviance=%.5f\n", name,
+				metric.RMSE(taskPreds), metric.MAE(taskPreds), metric.PoissonDeviance(taskPreds))
+		}
+		return nil
+	}
+	glog.Infof("test samples count=%d\nauc=%.5f\ngauc=%.5f\nloss=%.5f\n", len(preds), auc, gauc, logloss)
+	for i, name := range config.MultiTaskConfig.GetTaskName() {
+		taskPreds := TaskResult(preds, i)
+		glog.Infof("task %s: auc=%.5f\ngauc=%.5f\nloss=%.5f\n", name,
+			metric.AUC(taskPreds), metric.GroupAUC(taskPreds), metric.Losses(taskPreds))
+	}
+	if loss.IsRanking(config.LossConfig) {
+		k := int(config.LossConfig.GetRankTopK())
+		glog.Infof("ndcg@%d=%.5f\nmrr=%.5f\n", k, metric.NDCG(preds, k), metric.MRR(preds))
+	}
+	return nil
 }